@@ -1,12 +1,15 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/thc/runna-backend/internal/auth"
+	"github.com/thc/runna-backend/internal/crypto"
 	"github.com/thc/runna-backend/internal/database"
 	"github.com/thc/runna-backend/internal/handlers"
 	"github.com/thc/runna-backend/internal/middleware"
@@ -25,41 +28,85 @@ func main() {
 	}
 	defer db.Close()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(db, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		if err := runRotateKeys(db, os.Args[2:]); err != nil {
+			log.Fatalf("Key rotation failed: %v", err)
+		}
+		return
+	}
+
 	if err := db.Init(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	authSecret := os.Getenv("AUTH_SECRET")
+	if len(authSecret) < auth.MinSecretLength {
+		log.Fatalf("AUTH_SECRET environment variable must be at least %d bytes", auth.MinSecretLength)
+	}
+	requireAuth := middleware.Auth(authSecret)
+
+	// Strava tokens are stored encrypted with the active key; retired keys still decrypt
+	keyring, err := crypto.KeyringFromEnv()
+	if err != nil {
+		log.Fatalf("Invalid encryption keys: %v", err)
+	}
+
 	h := handlers.New(db)
+	h.SetAuthSecret(authSecret)
+	h.SetKeyring(keyring)
 
 	// Initialize Strava service
-	stravaService := services.NewStravaService(db)
+	stravaService := services.NewStravaService(db, services.NewStravaClient(services.StravaAPIBase, services.StravaTokenURL), keyring)
 	h.SetStravaService(stravaService)
 
+	// Work off stored Strava webhook events, retrying failures
+	webhookWorkers := 4
+	if v := os.Getenv("WEBHOOK_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			log.Fatalf("WEBHOOK_WORKERS must be a positive integer, got %q", v)
+		}
+		webhookWorkers = n
+	}
+	webhookWorker := services.NewWebhookWorker(db, stravaService, webhookWorkers, 5*time.Second)
+	h.SetWebhookQueue(webhookWorker)
+	go webhookWorker.Run(context.Background())
+
+	// Permanently remove sessions that have been in the trash past the retention window
+	trashRetentionDays := 30
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			log.Fatalf("TRASH_RETENTION_DAYS must be a positive integer, got %q", v)
+		}
+		trashRetentionDays = days
+	}
+	purger := services.NewTrashPurger(db, time.Duration(trashRetentionDays)*24*time.Hour, time.Hour)
+	go purger.Run(context.Background())
+
+	// Record a daily progress snapshot of every active goal
+	snapshotter := services.NewGoalSnapshotter(db, time.Hour)
+	go snapshotter.Run(context.Background())
+
+	// Admin routes, only served when an operator token is configured
+	var requireAdmin func(http.HandlerFunc) http.HandlerFunc
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		requireAdmin = middleware.AdminToken(adminToken)
+	} else {
+		log.Println("ADMIN_TOKEN not set, admin routes disabled")
+	}
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /api/sessions", h.CreateSession)
-	mux.HandleFunc("GET /api/sessions", h.GetSessions)
-	mux.HandleFunc("GET /api/sessions/{id}", h.GetSession)
-	mux.HandleFunc("PUT /api/sessions/{id}", h.UpdateSession)
-
-	// Goal routes
-	mux.HandleFunc("POST /api/goals", h.CreateGoal)
-	mux.HandleFunc("GET /api/goals", h.GetGoals)
-	mux.HandleFunc("GET /api/goals/{id}", h.GetGoal)
-	mux.HandleFunc("DELETE /api/goals/{id}", h.DeleteGoal)
-
-	// Strava webhook routes
-	mux.HandleFunc("GET /api/webhooks/strava", h.VerifyWebhook)
-	mux.HandleFunc("POST /api/webhooks/strava", h.ReceiveWebhook)
-
-	// Strava OAuth routes
-	mux.HandleFunc("POST /api/strava/connect", h.ConnectStrava)
-	mux.HandleFunc("GET /api/strava/status", h.GetStravaStatus)
-	mux.HandleFunc("DELETE /api/strava/disconnect", h.DisconnectStrava)
-
-	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
-	})
+	for _, route := range h.Routes(requireAuth, requireAdmin) {
+		mux.HandleFunc(route.Pattern, route.Handler)
+	}
 
 	// Apply middleware: logging first, then CORS
 	handler := middleware.Logging(enableCORS(mux))
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/thc/runna-backend/internal/database"
+)
+
+const migrateUsage = "usage: api migrate <up|down [steps]|status>"
+
+// runMigrate handles the "migrate" subcommand
+func runMigrate(db *database.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	switch args[0] {
+	case "up":
+		if err := db.Migrate(); err != nil {
+			return err
+		}
+		fmt.Println("Migrations applied")
+		return nil
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("steps must be a positive integer, got %q", args[1])
+			}
+			steps = n
+		}
+		if err := db.MigrateDown(steps); err != nil {
+			return err
+		}
+		fmt.Printf("Reverted up to %d migration(s)\n", steps)
+		return nil
+
+	case "status":
+		statuses, err := db.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return nil
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
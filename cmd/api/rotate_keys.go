@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thc/runna-backend/internal/crypto"
+	"github.com/thc/runna-backend/internal/database"
+)
+
+const rotateKeysUsage = "usage: api rotate-keys"
+
+// runRotateKeys handles the "rotate-keys" subcommand, re-encrypting every stored Strava token
+// with the active encryption key so retired keys can be dropped
+func runRotateKeys(db *database.DB, args []string) error {
+	if len(args) != 0 {
+		return errors.New(rotateKeysUsage)
+	}
+
+	keyring, err := crypto.KeyringFromEnv()
+	if err != nil {
+		return err
+	}
+
+	rotated, skipped, err := db.RotateStravaTokens(keyring.Rotate)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Re-encrypted the tokens of %d Strava connection(s)\n", rotated)
+	if skipped > 0 {
+		fmt.Printf("%d connection(s) were refreshed meanwhile; run rotate-keys again to check them\n", skipped)
+	}
+	return nil
+}
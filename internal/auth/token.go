@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinSecretLength is the minimum accepted length of the token signing secret
+const MinSecretLength = 32
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// tokenHeader is the fixed JWT header for HS256 tokens
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type claims struct {
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// IssueToken creates an HS256-signed JWT identifying userID, valid for ttl
+func IssueToken(userID int64, secret string, ttl time.Duration) (string, time.Time, error) {
+	if len(secret) < MinSecretLength {
+		return "", time.Time{}, fmt.Errorf("auth secret must be at least %d bytes, got %d", MinSecretLength, len(secret))
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	payload, err := json.Marshal(claims{
+		Subject:   strconv.FormatInt(userID, 10),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to encode claims: %w", err)
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + sign(unsigned, secret), expiresAt, nil
+}
+
+// ParseToken verifies the signature and expiry of token and returns its user ID
+func ParseToken(token, secret string) (int64, error) {
+	if len(secret) < MinSecretLength {
+		return 0, fmt.Errorf("auth secret must be at least %d bytes, got %d", MinSecretLength, len(secret))
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return 0, ErrInvalidToken
+	}
+
+	expected := sign(parts[0]+"."+parts[1], secret)
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return 0, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return 0, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= c.ExpiresAt {
+		return 0, ErrExpiredToken
+	}
+
+	userID, err := strconv.ParseInt(c.Subject, 10, 64)
+	if err != nil || userID <= 0 {
+		return 0, ErrInvalidToken
+	}
+
+	return userID, nil
+}
+
+// sign returns the base64url HMAC-SHA256 signature of data
+func sign(data, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
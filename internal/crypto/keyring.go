@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultKeyID identifies ENCRYPTION_KEY when ENCRYPTION_KEY_ID is not set
+const DefaultKeyID = "1"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Keyring encrypts with its active key and decrypts with any of its keys. Ciphertexts are
+// prefixed with the ID of the key that encrypted them, as in "2:base64...", so retired keys
+// keep working until every value has been re-encrypted under the active one. Ciphertexts
+// from before key IDs carry no prefix and are tried against every key.
+type Keyring struct {
+	activeID string
+	keys     map[string]string
+}
+
+// NewKeyring builds a keyring from the active key and the retired keys, keyed by ID
+func NewKeyring(activeID, activeKey string, retired map[string]string) (*Keyring, error) {
+	keys := make(map[string]string, len(retired)+1)
+	for id, key := range retired {
+		keys[id] = key
+	}
+	if _, ok := keys[activeID]; ok {
+		return nil, fmt.Errorf("key ID %q is used by both the active and a retired key", activeID)
+	}
+	keys[activeID] = activeKey
+
+	for id, key := range keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key ID %q: use letters, digits, '.', '_' or '-'", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %q must be 32 bytes, got %d", id, len(key))
+		}
+	}
+
+	return &Keyring{activeID: activeID, keys: keys}, nil
+}
+
+// KeyringFromEnv builds the keyring configured by ENCRYPTION_KEY, the active key;
+// ENCRYPTION_KEY_ID, its ID; and ENCRYPTION_RETIRED_KEYS, a comma-separated list of
+// id:key pairs still accepted for decryption
+func KeyringFromEnv() (*Keyring, error) {
+	activeKey := os.Getenv("ENCRYPTION_KEY")
+	if activeKey == "" {
+		return nil, errors.New("ENCRYPTION_KEY not set")
+	}
+
+	activeID := os.Getenv("ENCRYPTION_KEY_ID")
+	if activeID == "" {
+		activeID = DefaultKeyID
+	}
+
+	retired := make(map[string]string)
+	if v := os.Getenv("ENCRYPTION_RETIRED_KEYS"); v != "" {
+		for _, pair := range strings.Split(v, ",") {
+			id, key, ok := strings.Cut(strings.TrimSpace(pair), ":")
+			if !ok {
+				return nil, errors.New("ENCRYPTION_RETIRED_KEYS entries must be id:key pairs")
+			}
+			if _, dup := retired[id]; dup {
+				return nil, fmt.Errorf("ENCRYPTION_RETIRED_KEYS lists key ID %q twice", id)
+			}
+			retired[id] = key
+		}
+	}
+
+	return NewKeyring(activeID, activeKey, retired)
+}
+
+// Encrypt encrypts plaintext with the active key
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	ciphertext, err := Encrypt(plaintext, k.keys[k.activeID])
+	if err != nil {
+		return "", err
+	}
+
+	return k.activeID + ":" + ciphertext, nil
+}
+
+// Decrypt decrypts ciphertext with the key it names, or with whichever key opens it if
+// it names none
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
+	id, data, ok := strings.Cut(ciphertext, ":")
+	if ok {
+		key, known := k.keys[id]
+		if !known {
+			return "", fmt.Errorf("unknown encryption key %q", id)
+		}
+		return Decrypt(data, key)
+	}
+
+	// The active key is the likeliest, so it goes first
+	plaintext, err := Decrypt(ciphertext, k.keys[k.activeID])
+	if err == nil {
+		return plaintext, nil
+	}
+	for id, key := range k.keys {
+		if id == k.activeID {
+			continue
+		}
+		if plaintext, err := Decrypt(ciphertext, key); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return "", err
+}
+
+// Rotate re-encrypts ciphertext with the active key, returning it unchanged if the active
+// key already encrypted it
+func (k *Keyring) Rotate(ciphertext string) (string, error) {
+	if strings.HasPrefix(ciphertext, k.activeID+":") {
+		return ciphertext, nil
+	}
+
+	plaintext, err := k.Decrypt(ciphertext)
+	if err != nil {
+		return "", err
+	}
+
+	return k.Encrypt(plaintext)
+}
@@ -0,0 +1,161 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+const (
+	oldKey = "12345678901234567890123456789012"
+	newKey = "abcdefghijklmnopqrstuvwxyz123456"
+)
+
+func TestKeyringEncryptDecrypt(t *testing.T) {
+	keyring, err := NewKeyring("2", newKey, map[string]string{"1": oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted, err := keyring.Encrypt("strava_access_token_12345")
+	if err != nil {
+		t.Fatalf("Encryption failed: %v", err)
+	}
+	if !strings.HasPrefix(encrypted, "2:") {
+		t.Fatalf("Expected the active key ID as prefix, got %s", encrypted)
+	}
+
+	decrypted, err := keyring.Decrypt(encrypted)
+	if err != nil || decrypted != "strava_access_token_12345" {
+		t.Fatalf("Expected the original plaintext, got %q (%v)", decrypted, err)
+	}
+}
+
+func TestKeyringDecryptRetiredAndLegacy(t *testing.T) {
+	old, err := NewKeyring("1", oldKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retired, err := old.Encrypt("retired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := Encrypt("legacy", oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring, err := NewKeyring("2", newKey, map[string]string{"1": oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := keyring.Decrypt(retired); err != nil || got != "retired" {
+		t.Errorf("Expected a retired key to decrypt, got %q (%v)", got, err)
+	}
+	if got, err := keyring.Decrypt(legacy); err != nil || got != "legacy" {
+		t.Errorf("Expected a ciphertext without key ID to decrypt, got %q (%v)", got, err)
+	}
+
+	// Once the old key is dropped neither decrypts
+	current, err := NewKeyring("2", newKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := current.Decrypt(retired); err == nil || !strings.Contains(err.Error(), "unknown encryption key") {
+		t.Errorf("Expected an unknown key error, got %v", err)
+	}
+	if _, err := current.Decrypt(legacy); err == nil {
+		t.Error("Expected a legacy ciphertext of a dropped key to fail")
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	keyring, err := NewKeyring("2", newKey, map[string]string{"1": oldKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := Encrypt("token", oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := keyring.Rotate(legacy)
+	if err != nil {
+		t.Fatalf("Rotation failed: %v", err)
+	}
+	if !strings.HasPrefix(rotated, "2:") {
+		t.Fatalf("Expected the active key ID as prefix, got %s", rotated)
+	}
+	if got, err := keyring.Decrypt(rotated); err != nil || got != "token" {
+		t.Errorf("Expected the rotated token to decrypt, got %q (%v)", got, err)
+	}
+
+	// Already current ciphertexts are left alone
+	if again, err := keyring.Rotate(rotated); err != nil || again != rotated {
+		t.Errorf("Expected a current ciphertext to be unchanged, got %q (%v)", again, err)
+	}
+
+	if _, err := keyring.Rotate("9:" + legacy); err == nil {
+		t.Error("Expected rotating a ciphertext of an unknown key to fail")
+	}
+}
+
+func TestNewKeyringErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		key     string
+		retired map[string]string
+		wantErr string
+	}{
+		{"Short key", "1", "tooshort", nil, "must be 32 bytes"},
+		{"Short retired key", "2", newKey, map[string]string{"1": "tooshort"}, "must be 32 bytes"},
+		{"Empty ID", "", newKey, nil, "invalid key ID"},
+		{"ID with separator", "a:b", newKey, nil, "invalid key ID"},
+		{"Duplicate ID", "1", newKey, map[string]string{"1": oldKey}, "used by both"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.id, tt.key, tt.retired)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestKeyringFromEnv(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", "")
+	if _, err := KeyringFromEnv(); err == nil {
+		t.Error("Expected an error without ENCRYPTION_KEY")
+	}
+
+	// Without an ID the key is DefaultKeyID
+	t.Setenv("ENCRYPTION_KEY", oldKey)
+	keyring, err := KeyringFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := keyring.Encrypt("token")
+	if err != nil || !strings.HasPrefix(old, DefaultKeyID+":") {
+		t.Fatalf("Expected the default key ID as prefix, got %s (%v)", old, err)
+	}
+
+	t.Setenv("ENCRYPTION_KEY", newKey)
+	t.Setenv("ENCRYPTION_KEY_ID", "2")
+	t.Setenv("ENCRYPTION_RETIRED_KEYS", "1:"+oldKey+", 0:"+strings.Repeat("x", 32))
+	keyring, err = KeyringFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := keyring.Decrypt(old); err != nil || got != "token" {
+		t.Errorf("Expected the retired key to decrypt, got %q (%v)", got, err)
+	}
+
+	for _, retired := range []string{oldKey, "1:" + oldKey + ",1:" + oldKey} {
+		t.Setenv("ENCRYPTION_RETIRED_KEYS", retired)
+		if _, err := KeyringFromEnv(); err == nil {
+			t.Errorf("Expected ENCRYPTION_RETIRED_KEYS=%q to be rejected", retired)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package database
 
 import (
 	"database/sql"
+	"log"
+	"strings"
 	"time"
 
 	_ "github.com/tursodatabase/libsql-client-go/libsql"
@@ -10,11 +12,27 @@ import (
 )
 
 type DB struct {
-	conn *sql.DB
+	conn    *sqlConn
+	dialect dialect
 }
 
+// New connects to the database at dbURL: a libsql server such as Turso for libsql:// and
+// http(s):// URLs, an embedded SQLite file for file: URLs such as file:./runna.db, or a
+// Postgres server for postgres:// and postgresql:// URLs
 func New(dbURL string) (*DB, error) {
-	conn, err := sql.Open("libsql", dbURL)
+	driver, dsn, d := "libsql", dbURL, dialectSQLite
+	switch {
+	case isSQLiteURL(dbURL):
+		var err error
+		driver = "sqlite"
+		if dsn, err = sqliteDSN(dbURL); err != nil {
+			return nil, err
+		}
+	case isPostgresURL(dbURL):
+		driver, d = "pgx", dialectPostgres
+	}
+
+	conn, err := sql.Open(driver, dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -23,97 +41,186 @@ func New(dbURL string) (*DB, error) {
 		return nil, err
 	}
 
-	return &DB{conn: conn}, nil
+	return &DB{conn: &sqlConn{db: conn, dialect: d}, dialect: d}, nil
 }
 
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
+// Init brings the schema up to date by applying any pending migrations, then backfills the best
+// efforts of sessions imported before they were stored
 func (db *DB) Init() error {
-	query := `
-		CREATE TABLE IF NOT EXISTS sessions (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			date DATETIME NOT NULL,
-			distance REAL NOT NULL,
-			duration INTEGER NOT NULL,
-			notes TEXT,
-			strava_activity_id INTEGER UNIQUE,
-			source TEXT DEFAULT 'manual',
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE TABLE IF NOT EXISTS goals (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			target_distance REAL NOT NULL,
-			start_date DATETIME NOT NULL,
-			end_date DATETIME NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
-
-		CREATE TABLE IF NOT EXISTS strava_connections (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			user_id INTEGER,
-			strava_athlete_id INTEGER NOT NULL UNIQUE,
-			access_token TEXT NOT NULL,
-			refresh_token TEXT NOT NULL,
-			token_expires_at DATETIME NOT NULL,
-			connected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			last_sync DATETIME
-		);
-	`
-	_, err := db.conn.Exec(query)
-	return err
+	if err := db.Migrate(); err != nil {
+		return err
+	}
+	return db.backfillBestEfforts()
 }
 
-func (db *DB) CreateSession(req models.CreateSessionRequest) (*models.Session, error) {
-	query := `
-		INSERT INTO sessions (date, distance, duration, notes, source, created_at, updated_at)
-		VALUES (?, ?, ?, ?, 'manual', ?, ?)
-		RETURNING id, date, distance, duration, notes, strava_activity_id, source, created_at, updated_at
-	`
+// deleteChildRows deletes the rows of tables whose column points at a parent row selected by
+// parents, a subquery or ? list taking args. Every child table declares ON DELETE CASCADE, but
+// libsql servers don't enforce foreign keys, so parents are only deleted after their children.
+func deleteChildRows(tx *sqlTx, tables []string, column, parents string, args ...any) error {
+	for _, table := range tables {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE `+column+` IN (`+parents+`)`, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	now := time.Now()
-	var session models.Session
+// sessionsChanged refreshes the data derived from a user's sessions after the ones with the
+// given IDs were created, edited, deleted or restored; nil stands for any of them. Bulk writes
+// call it once for all of their sessions. The session write has already succeeded, so
+// failures are logged rather than returned.
+func (db *DB) sessionsChanged(userID int64, sessionIDs []int64) {
+	if err := db.RefreshPersonalRecords(userID); err != nil {
+		log.Printf("[ERROR] sessionsChanged: Failed to refresh personal records for user %d: %v", userID, err)
+	}
 
-	err := db.conn.QueryRow(
-		query,
-		req.Date,
-		req.Distance,
-		req.Duration,
-		req.Notes,
-		now,
-		now,
-	).Scan(
+	if err := db.refreshWorkoutMatches(userID); err != nil {
+		log.Printf("[ERROR] sessionsChanged: Failed to refresh workout matches for user %d: %v", userID, err)
+	}
+
+	if err := db.refreshTrainingLoad(userID, sessionIDs); err != nil {
+		log.Printf("[ERROR] sessionsChanged: Failed to refresh training load for user %d: %v", userID, err)
+	}
+}
+
+// getActiveSessions returns all of a user's sessions outside the trash in date order
+func (db *DB) getActiveSessions(userID int64) ([]models.Session, error) {
+	return db.queryActiveSessions(`user_id = ?`, userID)
+}
+
+// getActiveSessionsByID returns the user's sessions with the given IDs that are outside the trash, in date order
+func (db *DB) getActiveSessionsByID(userID int64, ids []int64) ([]models.Session, error) {
+	in, args := inList(ids)
+	return db.queryActiveSessions(`user_id = ? AND id IN (`+in+`)`, append([]any{userID}, args...)...)
+}
+
+// queryActiveSessions returns the sessions outside the trash matching condition, in date order
+func (db *DB) queryActiveSessions(condition string, args ...any) ([]models.Session, error) {
+	rows, err := db.conn.Query(`
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE `+condition+` AND deleted_at IS NULL
+		ORDER BY `+db.dialect.utc("date")+`, id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// inList returns a ? placeholder per ID for an IN clause, with the IDs as its arguments. An
+// empty list matches nothing.
+func inList(ids []int64) (string, []any) {
+	if len(ids) == 0 {
+		return "NULL", nil
+	}
+
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// sessionColumns is the column list selected for every session query, in scanSession order
+const sessionColumns = `id, user_id, date, utc_offset, distance, duration, notes, elevation_gain, avg_heart_rate, max_heart_rate, strava_activity_id, source, created_at, updated_at, deleted_at`
+
+// scanner is satisfied by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// utcOffset returns the offset of t's zone in seconds east of UTC, stored with a session's date
+func utcOffset(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
+}
+
+// scanSession reads a session, returning its date in the offset it was logged with, which
+// Postgres TIMESTAMPTZ doesn't keep
+func scanSession(row scanner) (*models.Session, error) {
+	var session models.Session
+	var offset int
+	err := row.Scan(
 		&session.ID,
+		&session.UserID,
 		&session.Date,
+		&offset,
 		&session.Distance,
 		&session.Duration,
 		&session.Notes,
+		&session.ElevationGain,
+		&session.AvgHeartRate,
+		&session.MaxHeartRate,
 		&session.StravaActivityID,
 		&session.Source,
 		&session.CreatedAt,
 		&session.UpdatedAt,
+		&session.DeletedAt,
 	)
-
 	if err != nil {
 		return nil, err
 	}
 
+	session.Date = session.Date.In(time.FixedZone("", offset))
 	return &session, nil
 }
 
-func (db *DB) GetSessions(startDate, endDate time.Time) ([]models.Session, error) {
+func (db *DB) CreateSession(userID int64, req models.CreateSessionRequest) (*models.Session, error) {
+	query := `
+		INSERT INTO sessions (user_id, date, utc_offset, distance, duration, notes, source, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, 'manual', ?, ?)
+		RETURNING ` + sessionColumns
+
+	now := time.Now()
+	session, err := scanSession(db.conn.QueryRow(
+		query,
+		userID,
+		req.Date,
+		utcOffset(req.Date),
+		req.Distance,
+		req.Duration,
+		req.Notes,
+		now,
+		now,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	db.sessionsChanged(userID, []int64{session.ID})
+	return session, nil
+}
+
+func (db *DB) GetSessions(userID int64, startDate, endDate time.Time) ([]models.Session, error) {
+	date := db.dialect.utc("date")
 	query := `
-		SELECT id, date, distance, duration, notes, strava_activity_id, source, created_at, updated_at
+		SELECT ` + sessionColumns + `
 		FROM sessions
-		WHERE date >= ? AND date <= ?
-		ORDER BY date DESC
+		WHERE user_id = ? AND ` + date + ` >= ? AND ` + date + ` <= ? AND deleted_at IS NULL
+		ORDER BY ` + date + ` DESC
 	`
 
-	rows, err := db.conn.Query(query, startDate, endDate)
+	rows, err := db.conn.Query(query, userID, db.dialect.utcArg(startDate), db.dialect.utcArg(endDate))
 	if err != nil {
 		return nil, err
 	}
@@ -121,22 +228,11 @@ func (db *DB) GetSessions(startDate, endDate time.Time) ([]models.Session, error
 
 	var sessions []models.Session
 	for rows.Next() {
-		var session models.Session
-		err := rows.Scan(
-			&session.ID,
-			&session.Date,
-			&session.Distance,
-			&session.Duration,
-			&session.Notes,
-			&session.StravaActivityID,
-			&session.Source,
-			&session.CreatedAt,
-			&session.UpdatedAt,
-		)
+		session, err := scanSession(rows)
 		if err != nil {
 			return nil, err
 		}
-		sessions = append(sessions, session)
+		sessions = append(sessions, *session)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -146,67 +242,104 @@ func (db *DB) GetSessions(startDate, endDate time.Time) ([]models.Session, error
 	return sessions, nil
 }
 
-func (db *DB) GetSession(id int) (*models.Session, error) {
+func (db *DB) GetSession(userID int64, id int) (*models.Session, error) {
 	query := `
-		SELECT id, date, distance, duration, notes, strava_activity_id, source, created_at, updated_at
+		SELECT ` + sessionColumns + `
 		FROM sessions
-		WHERE id = ?
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
 	`
 
-	var session models.Session
-	err := db.conn.QueryRow(query, id).Scan(
-		&session.ID,
-		&session.Date,
-		&session.Distance,
-		&session.Duration,
-		&session.Notes,
-		&session.StravaActivityID,
-		&session.Source,
-		&session.CreatedAt,
-		&session.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &session, nil
+	return scanSession(db.conn.QueryRow(query, id, userID))
 }
 
-func (db *DB) UpdateSession(id int, req models.CreateSessionRequest) (*models.Session, error) {
+func (db *DB) UpdateSession(userID int64, id int, req models.CreateSessionRequest) (*models.Session, error) {
 	query := `
 		UPDATE sessions
-		SET date = ?, distance = ?, duration = ?, notes = ?, updated_at = ?
-		WHERE id = ?
-		RETURNING id, date, distance, duration, notes, strava_activity_id, source, created_at, updated_at
-	`
+		SET date = ?, utc_offset = ?, distance = ?, duration = ?, notes = ?, updated_at = ?
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+		RETURNING ` + sessionColumns
 
-	now := time.Now()
-	var session models.Session
-
-	err := db.conn.QueryRow(
+	session, err := scanSession(db.conn.QueryRow(
 		query,
 		req.Date,
+		utcOffset(req.Date),
 		req.Distance,
 		req.Duration,
 		req.Notes,
-		now,
+		time.Now(),
 		id,
-	).Scan(
-		&session.ID,
-		&session.Date,
-		&session.Distance,
-		&session.Duration,
-		&session.Notes,
-		&session.StravaActivityID,
-		&session.Source,
-		&session.CreatedAt,
-		&session.UpdatedAt,
-	)
+		userID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	db.sessionsChanged(userID, []int64{session.ID})
+	return session, nil
+}
+
+// FindSessionByStartTime returns a user's session starting within tolerance of start, or nil if none
+func (db *DB) FindSessionByStartTime(userID int64, start time.Time, tolerance time.Duration) (*models.Session, error) {
+	date := db.dialect.utc("date")
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = ? AND ` + date + ` >= ? AND ` + date + ` <= ? AND deleted_at IS NULL
+		ORDER BY ` + date + `
+		LIMIT 1
+	`
+
+	session, err := scanSession(db.conn.QueryRow(query, userID, db.dialect.utcArg(start.Add(-tolerance)), db.dialect.utcArg(start.Add(tolerance))))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &session, nil
+	return session, nil
+}
+
+// CreateSessions creates several sessions with the given source in one transaction,
+// so a bulk import either fully succeeds or leaves nothing behind
+func (db *DB) CreateSessions(userID int64, source string, reqs []models.CreateSessionRequest) ([]models.Session, error) {
+	query := `
+		INSERT INTO sessions (user_id, date, utc_offset, distance, duration, notes, source, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING ` + sessionColumns
+
+	sessions := make([]models.Session, 0, len(reqs))
+	err := db.inTx(func(tx *sqlTx) error {
+		now := time.Now()
+		for _, req := range reqs {
+			session, err := scanSession(tx.QueryRow(
+				query,
+				userID,
+				req.Date,
+				utcOffset(req.Date),
+				req.Distance,
+				req.Duration,
+				req.Notes,
+				source,
+				now,
+				now,
+			))
+			if err != nil {
+				return err
+			}
+			sessions = append(sessions, *session)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID
+	}
+	db.sessionsChanged(userID, ids)
+	return sessions, nil
 }
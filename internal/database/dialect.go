@@ -0,0 +1,170 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// dialect is the SQL flavour of a backend. Queries and migrations are written for SQLite,
+// with ? placeholders, and translated where Postgres differs.
+type dialect int
+
+const (
+	dialectSQLite dialect = iota // libsql servers and embedded SQLite files
+	dialectPostgres
+)
+
+// rebind rewrites the ? placeholders of a query as $1, $2, ... for Postgres
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 16)
+	n := 0
+	quoted := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
+
+// postgresTypePattern matches the SQLite column types used by the migrations
+var postgresTypePattern = regexp.MustCompile(`\b(INTEGER PRIMARY KEY AUTOINCREMENT|INTEGER|REAL|DATETIME)\b`)
+
+// postgresTypes are the Postgres equivalents of the SQLite column types. SQLite integers and
+// reals are 64-bit, and Strava IDs already overflow a Postgres INTEGER.
+var postgresTypes = map[string]string{
+	"INTEGER PRIMARY KEY AUTOINCREMENT": "BIGSERIAL PRIMARY KEY",
+	"INTEGER":                           "BIGINT",
+	"REAL":                              "DOUBLE PRECISION",
+	"DATETIME":                          "TIMESTAMPTZ",
+}
+
+// schema translates the column types of a migration's statements
+func (d dialect) schema(statements string) string {
+	if d != dialectPostgres {
+		return statements
+	}
+
+	return postgresTypePattern.ReplaceAllStringFunc(statements, func(t string) string {
+		return postgresTypes[t]
+	})
+}
+
+// utc wraps a time column so it compares in UTC against utcArg values. SQLite stores times
+// as text with the offset they were written in, so datetime() normalizes them first.
+func (d dialect) utc(column string) string {
+	if d == dialectPostgres {
+		return column
+	}
+	return "datetime(" + column + ")"
+}
+
+// utcArg is the query argument for a time compared against a utc column
+func (d dialect) utcArg(t time.Time) any {
+	if d == dialectPostgres {
+		return t
+	}
+	return t.UTC().Format(sqlDateTimeLayout)
+}
+
+// utcParam is the placeholder of a utcArg whose type nothing else in the query determines,
+// such as one in a VALUES list
+func (d dialect) utcParam() string {
+	if d == dialectPostgres {
+		return "CAST(? AS TIMESTAMPTZ)"
+	}
+	return "?"
+}
+
+// sqlConn is a connection pool that rebinds every query for its dialect
+type sqlConn struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (c *sqlConn) Exec(query string, args ...any) (sql.Result, error) {
+	return c.db.Exec(c.dialect.rebind(query), args...)
+}
+
+func (c *sqlConn) Query(query string, args ...any) (*sql.Rows, error) {
+	return c.db.Query(c.dialect.rebind(query), args...)
+}
+
+func (c *sqlConn) QueryRow(query string, args ...any) *sql.Row {
+	return c.db.QueryRow(c.dialect.rebind(query), args...)
+}
+
+func (c *sqlConn) Begin() (*sqlTx, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx: tx, dialect: c.dialect}, nil
+}
+
+func (c *sqlConn) Close() error {
+	return c.db.Close()
+}
+
+// sqlTx is a transaction that rebinds every query for its dialect
+type sqlTx struct {
+	tx      *sql.Tx
+	dialect dialect
+}
+
+func (t *sqlTx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.tx.Exec(t.dialect.rebind(query), args...)
+}
+
+func (t *sqlTx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.tx.Query(t.dialect.rebind(query), args...)
+}
+
+func (t *sqlTx) QueryRow(query string, args ...any) *sql.Row {
+	return t.tx.QueryRow(t.dialect.rebind(query), args...)
+}
+
+func (t *sqlTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// isUniqueViolation reports whether err is a backend rejecting a row that breaks a UNIQUE
+// constraint. libsql servers only report it as text.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+	}
+
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
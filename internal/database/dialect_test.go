@@ -0,0 +1,51 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect dialect
+		query   string
+		want    string
+	}{
+		{"SQLite unchanged", dialectSQLite, `SELECT id FROM sessions WHERE user_id = ? AND date >= ?`, `SELECT id FROM sessions WHERE user_id = ? AND date >= ?`},
+		{"Numbered in order", dialectPostgres, `SELECT id FROM sessions WHERE user_id = ? AND date >= ?`, `SELECT id FROM sessions WHERE user_id = $1 AND date >= $2`},
+		{"Quoted mark kept", dialectPostgres, `SELECT '?', ? FROM users`, `SELECT '?', $1 FROM users`},
+		{"Escaped quote", dialectPostgres, `SELECT 'it''s?' WHERE a = ?`, `SELECT 'it''s?' WHERE a = $1`},
+		{"LIKE escape", dialectPostgres, `WHERE LOWER(notes) LIKE ? ESCAPE '\' AND id < ?`, `WHERE LOWER(notes) LIKE $1 ESCAPE '\' AND id < $2`},
+		{"No placeholders", dialectPostgres, `SELECT COUNT(*) FROM users`, `SELECT COUNT(*) FROM users`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.rebind(tt.query); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPostgresSchema(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	for _, m := range migrations {
+		for _, translated := range []string{m.up(dialectPostgres), m.down(dialectPostgres)} {
+			for _, sqliteOnly := range []string{"AUTOINCREMENT", "DATETIME", " REAL", " INTEGER"} {
+				if strings.Contains(translated, sqliteOnly) {
+					t.Errorf("Migration %04d_%s still uses %s on Postgres", m.Version, m.Name, strings.TrimSpace(sqliteOnly))
+				}
+			}
+		}
+	}
+
+	if got := dialectPostgres.schema("id INTEGER PRIMARY KEY AUTOINCREMENT, strava_activity_id INTEGER UNIQUE, distance REAL, date DATETIME"); got != "id BIGSERIAL PRIMARY KEY, strava_activity_id BIGINT UNIQUE, distance DOUBLE PRECISION, date TIMESTAMPTZ" {
+		t.Errorf("Unexpected translation %q", got)
+	}
+}
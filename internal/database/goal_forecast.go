@@ -0,0 +1,120 @@
+package database
+
+import (
+	"math"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+const (
+	// forecastHistoryWeeks is how far back weekly totals are taken to estimate variance
+	forecastHistoryWeeks = 12
+	// forecastRecentDays is the window of the recent run rate used for projections
+	forecastRecentDays = 28
+	// forecastMinDays keeps a brand-new history from producing an inflated daily rate
+	forecastMinDays = 7
+)
+
+// computeGoalForecast projects a cumulative goal from the user's recent sessions.
+// History holds sessions from the forecastHistoryWeeks before now, regardless of the goal
+// period. The chance of reaching the target treats the remaining weeks as independent
+// draws from the runner's weekly totals, approximated by a normal distribution.
+func computeGoalForecast(goal models.Goal, current float64, history []models.Session, now time.Time) *models.GoalForecast {
+	if goal.GoalType == models.GoalTypePace {
+		return nil
+	}
+
+	from := now
+	if from.Before(goal.StartDate) {
+		from = goal.StartDate
+	}
+	daysRemaining := math.Max(goal.EndDate.Sub(from).Hours()/24, 0)
+	remaining := math.Max(goal.TargetValue-current, 0)
+
+	// Only count weeks since the first session, so new runners aren't judged on empty weeks
+	first := now
+	for _, s := range history {
+		if s.Date.Before(first) {
+			first = s.Date
+		}
+	}
+	historyDays := math.Min(now.Sub(first).Hours()/24, forecastHistoryWeeks*7)
+
+	recentDays := math.Max(math.Min(historyDays, forecastRecentDays), forecastMinDays)
+	recentStart := now.Add(-time.Duration(recentDays * 24 * float64(time.Hour)))
+	var recent []models.Session
+	for _, s := range history {
+		if !s.Date.Before(recentStart) {
+			recent = append(recent, s)
+		}
+	}
+	rate := goalValue(goal.GoalType, recent) / recentDays
+
+	forecast := &models.GoalForecast{
+		DaysRemaining:   round2(daysRemaining),
+		RecentDailyRate: round2(rate),
+		ProjectedValue:  round2(current + rate*daysRemaining),
+	}
+
+	switch {
+	case remaining == 0:
+		forecast.Confidence = 1
+		return forecast
+	case daysRemaining == 0:
+		forecast.Confidence = 0
+		return forecast
+	}
+
+	forecast.RequiredPerDay = round2(remaining / daysRemaining)
+	forecast.RequiredPerWeek = round2(remaining / daysRemaining * 7)
+
+	weeks := max(int(math.Ceil(historyDays/7)), 1)
+	totals := make([]float64, weeks)
+	for i := range totals {
+		end := now.AddDate(0, 0, -7*i)
+		start := end.AddDate(0, 0, -7)
+		var week []models.Session
+		for _, s := range history {
+			if !s.Date.Before(start) && s.Date.Before(end) {
+				week = append(week, s)
+			}
+		}
+		totals[i] = goalValue(goal.GoalType, week)
+	}
+
+	var mean float64
+	for _, v := range totals {
+		mean += v
+	}
+	mean /= float64(weeks)
+
+	var variance float64
+	for _, v := range totals {
+		variance += (v - mean) * (v - mean)
+	}
+	if weeks > 1 {
+		variance /= float64(weeks - 1)
+	}
+
+	remainingWeeks := daysRemaining / 7
+	expected := mean * remainingWeeks
+	spread := math.Sqrt(variance * remainingWeeks)
+
+	if spread == 0 {
+		if expected >= remaining {
+			forecast.Confidence = 1
+		}
+		return forecast
+	}
+
+	// P(total >= remaining) under N(expected, spread²)
+	z := (remaining - expected) / spread
+	forecast.Confidence = round2(0.5 * math.Erfc(z/math.Sqrt2))
+
+	return forecast
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+func TestComputeGoalForecast(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	goal := models.Goal{
+		GoalType:    models.GoalTypeDistance,
+		TargetValue: 100,
+		StartDate:   time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2024, 3, 29, 12, 0, 0, 0, time.UTC),
+	}
+
+	// A steady 20km every week for the last 12 weeks
+	var steady []models.Session
+	for week := 0; week < forecastHistoryWeeks; week++ {
+		steady = append(steady, models.Session{Date: now.AddDate(0, 0, -7*week-3), Distance: 20, Duration: 6000})
+	}
+
+	t.Run("steady runner on pace", func(t *testing.T) {
+		f := computeGoalForecast(goal, 40, steady, now)
+		if f.DaysRemaining != 14 {
+			t.Errorf("Expected 14 days remaining, got %.2f", f.DaysRemaining)
+		}
+		if f.RecentDailyRate != 2.86 {
+			t.Errorf("Expected a daily rate of 2.86, got %.2f", f.RecentDailyRate)
+		}
+		if f.ProjectedValue != 80 {
+			t.Errorf("Expected a projection of 80, got %.2f", f.ProjectedValue)
+		}
+		if f.RequiredPerDay != 4.29 || f.RequiredPerWeek != 30 {
+			t.Errorf("Expected 4.29/day and 30/week required, got %.2f and %.2f", f.RequiredPerDay, f.RequiredPerWeek)
+		}
+		if f.Confidence != 0 {
+			t.Errorf("Expected no chance without variance, got %.2f", f.Confidence)
+		}
+	})
+
+	t.Run("variable runner", func(t *testing.T) {
+		var variable []models.Session
+		for week := 0; week < forecastHistoryWeeks; week++ {
+			distance := 15.0
+			if week%2 == 0 {
+				distance = 35
+			}
+			variable = append(variable, models.Session{Date: now.AddDate(0, 0, -7*week-3), Distance: distance, Duration: 6000})
+		}
+
+		f := computeGoalForecast(goal, 50, variable, now)
+		if f.Confidence <= 0.4 || f.Confidence >= 0.6 {
+			t.Errorf("Expected roughly even odds when the average matches the need, got %.2f", f.Confidence)
+		}
+	})
+
+	t.Run("target reached", func(t *testing.T) {
+		f := computeGoalForecast(goal, 120, steady, now)
+		if f.Confidence != 1 || f.RequiredPerDay != 0 {
+			t.Errorf("Expected certainty and nothing required, got %+v", f)
+		}
+	})
+
+	t.Run("no history", func(t *testing.T) {
+		f := computeGoalForecast(goal, 0, nil, now)
+		if f.Confidence != 0 || f.RecentDailyRate != 0 || f.RequiredPerWeek != 50 {
+			t.Errorf("Unexpected forecast without history: %+v", f)
+		}
+	})
+
+	t.Run("pace goals", func(t *testing.T) {
+		paceGoal := goal
+		paceGoal.GoalType = models.GoalTypePace
+		if f := computeGoalForecast(paceGoal, 300, steady, now); f != nil {
+			t.Errorf("Expected no forecast for pace goals, got %+v", f)
+		}
+	})
+}
@@ -0,0 +1,306 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// goalPeriodColumns is the column list selected for every period query, in scanGoalPeriod order
+const goalPeriodColumns = `id, goal_id, period_start, period_end, target_value, final_value, status, closed_at`
+
+func scanGoalPeriod(row scanner) (*models.GoalPeriod, error) {
+	var period models.GoalPeriod
+	err := row.Scan(
+		&period.ID,
+		&period.GoalID,
+		&period.PeriodStart,
+		&period.PeriodEnd,
+		&period.TargetValue,
+		&period.FinalValue,
+		&period.Status,
+		&period.ClosedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &period, nil
+}
+
+// nextGoalPeriod returns the period following a recurring goal's current one. The gap between
+// the end of a period and the start of the next is kept, so a period ending at 23:59:59 is
+// followed by one ending at 23:59:59 too, whatever the length of the month.
+func nextGoalPeriod(goal models.Goal) (time.Time, time.Time) {
+	start := models.AdvanceRecurrence(goal.StartDate, goal.Recurrence, goal.RecurrenceDays)
+	gap := start.Sub(goal.EndDate)
+	end := models.AdvanceRecurrence(start, goal.Recurrence, goal.RecurrenceDays).Add(-gap)
+	return start, end
+}
+
+// goalStreaks counts the completed periods leading up to now and the longest run of them.
+// Periods must be ordered oldest first; currentCompleted extends the streak with the
+// period in progress once its target is already met.
+func goalStreaks(periods []models.GoalPeriod, currentCompleted bool) (int, int) {
+	streak, best := 0, 0
+	for _, p := range periods {
+		if p.Status == "Completed" {
+			streak++
+		} else {
+			streak = 0
+		}
+		best = max(best, streak)
+	}
+
+	if currentCompleted {
+		streak++
+		best = max(best, streak)
+	}
+
+	return streak, best
+}
+
+// closeGoalPeriods works out the outcome of every period of a recurring goal that ended before
+// now, using sessions to list the user's sessions between two times, and returns them oldest
+// first with the goal moved to its current period. The sessions of all the periods are listed
+// at once.
+func closeGoalPeriods(goal models.Goal, now time.Time, sessions func(start, end time.Time) ([]models.Session, error)) (models.Goal, []models.GoalPeriod, error) {
+	var ended []models.Goal
+	for now.After(goal.EndDate) {
+		ended = append(ended, goal)
+		goal.StartDate, goal.EndDate = nextGoalPeriod(goal)
+		goal.UpdatedAt = now
+	}
+	if len(ended) == 0 {
+		return goal, nil, nil
+	}
+
+	all, err := sessions(ended[0].StartDate, ended[len(ended)-1].EndDate)
+	if err != nil {
+		return goal, nil, err
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Date.Before(all[j].Date) })
+
+	periods := make([]models.GoalPeriod, 0, len(ended))
+	next := 0
+	for _, period := range ended {
+		// Periods follow each other, so sessions before this one belong to none of the rest
+		for next < len(all) && all[next].Date.Before(period.StartDate) {
+			next++
+		}
+		last := next
+		for last < len(all) && !all[last].Date.After(period.EndDate) {
+			last++
+		}
+
+		final := computeGoalProgress(period, all[next:last], period.EndDate)
+		status := "Missed"
+		if final.Status == "Completed" {
+			status = "Completed"
+		}
+
+		periods = append(periods, models.GoalPeriod{
+			GoalID:      period.ID,
+			PeriodStart: period.StartDate,
+			PeriodEnd:   period.EndDate,
+			TargetValue: period.TargetValue,
+			FinalValue:  final.CurrentValue,
+			Status:      status,
+			ClosedAt:    now,
+		})
+		next = last
+	}
+
+	return goal, periods, nil
+}
+
+// sessionsOf lists a user's sessions in a period for closeGoalPeriods
+func (db *DB) sessionsOf(userID int64) func(start, end time.Time) ([]models.Session, error) {
+	return func(start, end time.Time) ([]models.Session, error) {
+		return db.GetSessions(userID, start, end)
+	}
+}
+
+// rollGoal records the outcome of every period of a recurring goal that ended before now and
+// moves the goal to its current period, reporting whether it did. A goal rolled concurrently
+// elsewhere is returned as stored.
+func (db *DB) rollGoal(goal models.Goal, now time.Time) (models.Goal, bool, error) {
+	current, periods, err := closeGoalPeriods(goal, now, db.sessionsOf(goal.UserID))
+	if err != nil || len(periods) == 0 {
+		return goal, false, err
+	}
+
+	rolled := false
+	err = db.inTx(func(tx *sqlTx) error {
+		// Only the roll that moves the goal on from the period it was read in records the outcomes
+		result, err := tx.Exec(`
+			UPDATE goals SET start_date = ?, end_date = ?, updated_at = ?
+			WHERE id = ? AND `+db.dialect.utc("start_date")+` = ?`,
+			current.StartDate,
+			current.EndDate,
+			now,
+			goal.ID,
+			db.dialect.utcArg(goal.StartDate),
+		)
+		if err != nil {
+			return err
+		}
+
+		updated, err := result.RowsAffected()
+		if err != nil || updated == 0 {
+			return err
+		}
+
+		// A period recorded before UpdateGoal cleared edited ones is replaced by the edited goal's outcome
+		for _, p := range periods {
+			_, err := tx.Exec(`
+				INSERT INTO goal_periods (goal_id, period_start, period_end, target_value, final_value, status, closed_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (goal_id, period_start) DO UPDATE
+				SET period_end = excluded.period_end, target_value = excluded.target_value,
+					final_value = excluded.final_value, status = excluded.status, closed_at = excluded.closed_at`,
+				p.GoalID,
+				p.PeriodStart,
+				p.PeriodEnd,
+				p.TargetValue,
+				p.FinalValue,
+				p.Status,
+				p.ClosedAt,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		rolled = true
+		return nil
+	})
+	if err != nil {
+		return goal, false, err
+	}
+
+	if !rolled {
+		stored, err := scanGoal(db.conn.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = ?`, goal.ID))
+		if err != nil {
+			return goal, false, err
+		}
+		return *stored, false, nil
+	}
+
+	return current, true, nil
+}
+
+// RollRecurringGoals moves every recurring goal whose period has ended, across all users,
+// into its current period and returns how many goals were rolled
+func (db *DB) RollRecurringGoals(now time.Time) (int, error) {
+	query := `
+		SELECT ` + goalColumns + `
+		FROM goals
+		WHERE user_id IS NOT NULL AND recurrence <> '' AND ` + db.dialect.utc("end_date") + ` < ?
+	`
+
+	rows, err := db.conn.Query(query, db.dialect.utcArg(now))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	// Collect goals first so the connection is free for the progress queries
+	var goals []models.Goal
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return 0, err
+		}
+		goals = append(goals, *g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, g := range goals {
+		_, rolled, err := db.rollGoal(g, now)
+		if err != nil {
+			return count, err
+		}
+		if rolled {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// getGoalPeriods lists the closed periods of a goal, oldest first
+func (db *DB) getGoalPeriods(goalID int64) ([]models.GoalPeriod, error) {
+	query := `
+		SELECT ` + goalPeriodColumns + `
+		FROM goal_periods
+		WHERE goal_id = ?
+		ORDER BY period_start
+	`
+
+	rows, err := db.conn.Query(query, goalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []models.GoalPeriod
+	for rows.Next() {
+		period, err := scanGoalPeriod(rows)
+		if err != nil {
+			return nil, err
+		}
+		periods = append(periods, *period)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return periods, nil
+}
+
+// goalPeriodsAsOf returns the goal moved to its current period with the outcomes of all of its
+// periods so far, oldest first. Periods that ended since the goal was last rolled are worked
+// out without being recorded; RollRecurringGoals records them.
+func (db *DB) goalPeriodsAsOf(goal models.Goal, now time.Time) (models.Goal, []models.GoalPeriod, error) {
+	current, pending, err := closeGoalPeriods(goal, now, db.sessionsOf(goal.UserID))
+	if err != nil {
+		return goal, nil, err
+	}
+
+	periods, err := db.getGoalPeriods(goal.ID)
+	if err != nil {
+		return goal, nil, err
+	}
+
+	// A roll between reading the goal and its periods has recorded some of the pending ones
+	for _, p := range pending {
+		if len(periods) == 0 || p.PeriodStart.After(periods[len(periods)-1].PeriodStart) {
+			periods = append(periods, p)
+		}
+	}
+
+	return current, periods, nil
+}
+
+// GetGoalPeriods lists the outcomes of a user's recurring goal, oldest first.
+// Returns sql.ErrNoRows if the goal doesn't exist.
+func (db *DB) GetGoalPeriods(userID int64, goalID int) ([]models.GoalPeriod, error) {
+	goal, err := scanGoal(db.conn.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = ? AND user_id = ?`, goalID, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	if goal.Recurrence == "" {
+		return db.getGoalPeriods(goal.ID)
+	}
+
+	_, periods, err := db.goalPeriodsAsOf(*goal, time.Now())
+	return periods, err
+}
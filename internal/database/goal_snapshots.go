@@ -0,0 +1,128 @@
+package database
+
+import (
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// goalSnapshotColumns is the column list selected for every snapshot query, in scanGoalSnapshot order
+const goalSnapshotColumns = `id, goal_id, snapshot_date, current_value, expected_value, progress_percentage, status, recorded_at`
+
+func scanGoalSnapshot(row scanner) (*models.GoalSnapshot, error) {
+	var snapshot models.GoalSnapshot
+	err := row.Scan(
+		&snapshot.ID,
+		&snapshot.GoalID,
+		&snapshot.Date,
+		&snapshot.Current,
+		&snapshot.Expected,
+		&snapshot.ProgressPercentage,
+		&snapshot.Status,
+		&snapshot.RecordedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// RecordGoalSnapshots stores today's progress of every goal, across all users, whose period
+// includes now or ended within the last day, so the final status is kept too. A goal's
+// snapshot for a day is overwritten until the day is over. Returns how many were recorded.
+func (db *DB) RecordGoalSnapshots(now time.Time) (int, error) {
+	query := `
+		SELECT ` + goalColumns + `
+		FROM goals
+		WHERE user_id IS NOT NULL AND ` + db.dialect.utc("start_date") + ` <= ? AND ` + db.dialect.utc("end_date") + ` >= ?
+	`
+
+	rows, err := db.conn.Query(query, db.dialect.utcArg(now), db.dialect.utcArg(now.Add(-24*time.Hour)))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	// Collect goals first so the connection is free for the progress queries
+	var goals []models.Goal
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return 0, err
+		}
+		goals = append(goals, *g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	date := now.UTC().Format("2006-01-02")
+	for _, g := range goals {
+		progress, err := db.calculateGoalProgress(g)
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = db.conn.Exec(`
+			INSERT INTO goal_snapshots (goal_id, snapshot_date, current_value, expected_value, progress_percentage, status, recorded_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (goal_id, snapshot_date) DO UPDATE SET
+				current_value = excluded.current_value,
+				expected_value = excluded.expected_value,
+				progress_percentage = excluded.progress_percentage,
+				status = excluded.status,
+				recorded_at = excluded.recorded_at`,
+			g.ID,
+			date,
+			progress.CurrentValue,
+			progress.ExpectedValue,
+			progress.ProgressPercentage,
+			progress.Status,
+			now,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(goals), nil
+}
+
+// GetGoalSnapshots lists the daily snapshots of a user's goal, oldest first.
+// Returns sql.ErrNoRows if the goal doesn't exist.
+func (db *DB) GetGoalSnapshots(userID int64, goalID int) ([]models.GoalSnapshot, error) {
+	var id int64
+	if err := db.conn.QueryRow(`SELECT id FROM goals WHERE id = ? AND user_id = ?`, goalID, userID).Scan(&id); err != nil {
+		return nil, err
+	}
+
+	query := `
+		SELECT ` + goalSnapshotColumns + `
+		FROM goal_snapshots
+		WHERE goal_id = ?
+		ORDER BY snapshot_date
+	`
+
+	rows, err := db.conn.Query(query, goalID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []models.GoalSnapshot
+	for rows.Next() {
+		snapshot, err := scanGoalSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
@@ -8,32 +8,24 @@ import (
 	"github.com/thc/runna-backend/internal/models"
 )
 
-func (db *DB) CreateGoal(req models.CreateGoalRequest) (*models.Goal, error) {
-	query := `
-		INSERT INTO goals (target_distance, start_date, end_date, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?)
-		RETURNING id, target_distance, start_date, end_date, created_at, updated_at
-	`
+// goalColumns is the column list selected for every goal query, in scanGoal order
+const goalColumns = `id, user_id, goal_type, target_value, target_distance, start_date, end_date, recurrence, recurrence_days, created_at, updated_at`
 
-	now := time.Now()
+func scanGoal(row scanner) (*models.Goal, error) {
 	var goal models.Goal
-
-	err := db.conn.QueryRow(
-		query,
-		req.TargetDistance,
-		req.StartDate,
-		req.EndDate,
-		now,
-		now,
-	).Scan(
+	err := row.Scan(
 		&goal.ID,
+		&goal.UserID,
+		&goal.GoalType,
+		&goal.TargetValue,
 		&goal.TargetDistance,
 		&goal.StartDate,
 		&goal.EndDate,
+		&goal.Recurrence,
+		&goal.RecurrenceDays,
 		&goal.CreatedAt,
 		&goal.UpdatedAt,
 	)
-
 	if err != nil {
 		return nil, err
 	}
@@ -41,33 +33,58 @@ func (db *DB) CreateGoal(req models.CreateGoalRequest) (*models.Goal, error) {
 	return &goal, nil
 }
 
-func (db *DB) GetGoals() ([]models.GoalProgress, error) {
+func (db *DB) CreateGoal(userID int64, req models.CreateGoalRequest) (*models.Goal, error) {
 	query := `
-		SELECT id, target_distance, start_date, end_date, created_at, updated_at
+		INSERT INTO goals (user_id, goal_type, target_value, target_distance, start_date, end_date, recurrence, recurrence_days, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING ` + goalColumns
+
+	now := time.Now()
+	return scanGoal(db.conn.QueryRow(
+		query,
+		userID,
+		req.GoalType,
+		req.TargetValue,
+		req.TargetDistance,
+		req.StartDate,
+		req.EndDate,
+		req.Recurrence,
+		req.RecurrenceDays,
+		now,
+		now,
+	))
+}
+
+func (db *DB) GetGoals(userID int64) ([]models.GoalProgress, error) {
+	query := `
+		SELECT ` + goalColumns + `
 		FROM goals
+		WHERE user_id = ?
 		ORDER BY created_at DESC
 	`
 
-	rows, err := db.conn.Query(query)
+	rows, err := db.conn.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var goals []models.GoalProgress
+	// Collect goals first so the connection is free for the progress queries
+	var list []models.Goal
 	for rows.Next() {
-		var g models.Goal
-		if err := rows.Scan(
-			&g.ID,
-			&g.TargetDistance,
-			&g.StartDate,
-			&g.EndDate,
-			&g.CreatedAt,
-			&g.UpdatedAt,
-		); err != nil {
+		g, err := scanGoal(rows)
+		if err != nil {
 			return nil, err
 		}
+		list = append(list, *g)
+	}
 
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var goals []models.GoalProgress
+	for _, g := range list {
 		// Calculate progress
 		progress, err := db.calculateGoalProgress(g)
 		if err != nil {
@@ -79,100 +96,220 @@ func (db *DB) GetGoals() ([]models.GoalProgress, error) {
 	return goals, nil
 }
 
-func (db *DB) GetGoal(id int) (*models.GoalProgress, error) {
+func (db *DB) GetGoal(userID int64, id int) (*models.GoalProgress, error) {
 	query := `
-		SELECT id, target_distance, start_date, end_date, created_at, updated_at
+		SELECT ` + goalColumns + `
 		FROM goals
-		WHERE id = ?
+		WHERE id = ? AND user_id = ?
 	`
 
-	var goal models.Goal
-	err := db.conn.QueryRow(query, id).Scan(
-		&goal.ID,
-		&goal.TargetDistance,
-		&goal.StartDate,
-		&goal.EndDate,
-		&goal.CreatedAt,
-		&goal.UpdatedAt,
-	)
-
+	goal, err := scanGoal(db.conn.QueryRow(query, id, userID))
 	if err != nil {
 		return nil, err
 	}
 
-	return db.calculateGoalProgress(goal)
+	return db.calculateGoalProgress(*goal)
 }
 
-func (db *DB) DeleteGoal(id int) error {
-	query := `DELETE FROM goals WHERE id = ?`
-	result, err := db.conn.Exec(query, id)
-	if err != nil {
-		return err
-	}
+// UpdateGoal changes a user's goal type, target, period and recurrence, returning sql.ErrNoRows if it doesn't exist.
+// Recorded periods from the new start on are cleared, so they are closed again as the edited goal.
+func (db *DB) UpdateGoal(userID int64, id int, req models.CreateGoalRequest) (*models.Goal, error) {
+	query := `
+		UPDATE goals
+		SET goal_type = ?, target_value = ?, target_distance = ?, start_date = ?, end_date = ?, recurrence = ?, recurrence_days = ?, updated_at = ?
+		WHERE id = ? AND user_id = ?
+		RETURNING ` + goalColumns
 
-	rows, err := result.RowsAffected()
-	if err != nil {
+	var goal *models.Goal
+	err := db.inTx(func(tx *sqlTx) error {
+		g, err := scanGoal(tx.QueryRow(
+			query,
+			req.GoalType,
+			req.TargetValue,
+			req.TargetDistance,
+			req.StartDate,
+			req.EndDate,
+			req.Recurrence,
+			req.RecurrenceDays,
+			time.Now(),
+			id,
+			userID,
+		))
+		if err != nil {
+			return err
+		}
+		goal = g
+
+		_, err = tx.Exec(
+			`DELETE FROM goal_periods WHERE goal_id = ? AND `+db.dialect.utc("period_start")+` >= ?`,
+			goal.ID,
+			db.dialect.utcArg(goal.StartDate),
+		)
 		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if rows == 0 {
-		return sql.ErrNoRows
-	}
+	return goal, nil
+}
 
-	return nil
+func (db *DB) DeleteGoal(userID int64, id int) error {
+	return db.inTx(func(tx *sqlTx) error {
+		result, err := tx.Exec(`DELETE FROM goals WHERE id = ? AND user_id = ?`, id, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return sql.ErrNoRows
+		}
+
+		return deleteChildRows(tx, []string{"goal_snapshots", "goal_periods"}, "goal_id", "?", id)
+	})
 }
 
 func (db *DB) calculateGoalProgress(goal models.Goal) (*models.GoalProgress, error) {
+	now := time.Now()
+
+	// Recurring goals are evaluated in the period containing now, whether or not they have been rolled into it
+	var periods []models.GoalPeriod
+	if goal.Recurrence != "" {
+		current, closed, err := db.goalPeriodsAsOf(goal, now)
+		if err != nil {
+			return nil, err
+		}
+		goal, periods = current, closed
+	}
+
 	// Get sessions within the goal period
-	sessions, err := db.GetSessions(goal.StartDate, goal.EndDate)
+	sessions, err := db.GetSessions(goal.UserID, goal.StartDate, goal.EndDate)
 	if err != nil {
 		return nil, err
 	}
 
-	var totalDistance float64
-	for _, s := range sessions {
-		totalDistance += s.Distance
-	}
+	progress := computeGoalProgress(goal, sessions, now)
 
-	now := time.Now()
-	// If current date is past end date, use end date for calculation
-	calcDate := now
-	if calcDate.After(goal.EndDate) {
-		calcDate = goal.EndDate
+	if goal.GoalType != models.GoalTypePace {
+		history, err := db.GetSessions(goal.UserID, now.AddDate(0, 0, -7*forecastHistoryWeeks), now)
+		if err != nil {
+			return nil, err
+		}
+		progress.Forecast = computeGoalForecast(goal, goalValue(goal.GoalType, sessions), history, now)
 	}
-	// If current date is before start date, use start date (progress 0)
-	if calcDate.Before(goal.StartDate) {
-		calcDate = goal.StartDate
+
+	if goal.Recurrence != "" {
+		progress.Streak, progress.BestStreak = goalStreaks(periods, progress.Status == "Completed")
 	}
 
-	totalDuration := goal.EndDate.Sub(goal.StartDate).Hours()
-	elapsedDuration := calcDate.Sub(goal.StartDate).Hours()
+	return &progress, nil
+}
+
+// goalValue measures sessions in the unit of a goal type. Pace goals get the average pace,
+// or 0 without any distance run.
+func goalValue(goalType string, sessions []models.Session) float64 {
+	var distance, duration, elevation float64
+	for _, s := range sessions {
+		distance += s.Distance
+		duration += float64(s.Duration)
+		if s.ElevationGain != nil {
+			elevation += *s.ElevationGain
+		}
+	}
 
-	var expectedDistance float64
-	if totalDuration > 0 {
-		expectedDistance = (elapsedDuration / totalDuration) * goal.TargetDistance
+	switch goalType {
+	case models.GoalTypeDuration:
+		return duration
+	case models.GoalTypeRunCount:
+		return float64(len(sessions))
+	case models.GoalTypeElevation:
+		return elevation
+	case models.GoalTypePace:
+		if distance == 0 {
+			return 0
+		}
+		return duration / distance
+	default:
+		return distance
 	}
+}
 
-	progressPercentage := (totalDistance / goal.TargetDistance) * 100
-	if progressPercentage > 100 {
-		progressPercentage = 100
+// computeGoalProgress evaluates a goal against the sessions in its period as of now
+func computeGoalProgress(goal models.Goal, sessions []models.Session, now time.Time) models.GoalProgress {
+	var totalDistance float64
+	for _, s := range sessions {
+		totalDistance += s.Distance
 	}
 
-	status := "On Track"
-	if totalDistance >= goal.TargetDistance {
-		status = "Completed"
-	} else if totalDistance < expectedDistance {
-		status = "Behind"
-	} else if totalDistance > expectedDistance*1.1 { // 10% buffer for "Ahead"
-		status = "Ahead"
+	current := goalValue(goal.GoalType, sessions)
+
+	var expected, progressPercentage float64
+	var status string
+
+	if goal.GoalType == models.GoalTypePace {
+		// Pace is an average rather than a running total, so the target applies throughout the period
+		expected = goal.TargetValue
+		if current > 0 {
+			progressPercentage = math.Min(goal.TargetValue/current*100, 100)
+		}
+
+		switch {
+		case current == 0 || current > goal.TargetValue:
+			status = "Behind"
+		case !now.Before(goal.EndDate):
+			status = "Completed"
+		case current <= goal.TargetValue*0.95: // 5% faster than target for "Ahead"
+			status = "Ahead"
+		default:
+			status = "On Track"
+		}
+	} else {
+		// If current date is past end date, use end date for calculation
+		calcDate := now
+		if calcDate.After(goal.EndDate) {
+			calcDate = goal.EndDate
+		}
+		// If current date is before start date, use start date (progress 0)
+		if calcDate.Before(goal.StartDate) {
+			calcDate = goal.StartDate
+		}
+
+		totalDuration := goal.EndDate.Sub(goal.StartDate).Hours()
+		elapsedDuration := calcDate.Sub(goal.StartDate).Hours()
+
+		if totalDuration > 0 {
+			expected = (elapsedDuration / totalDuration) * goal.TargetValue
+		}
+
+		progressPercentage = math.Min(current/goal.TargetValue*100, 100)
+
+		status = "On Track"
+		if current >= goal.TargetValue {
+			status = "Completed"
+		} else if current < expected {
+			status = "Behind"
+		} else if current > expected*1.1 { // 10% buffer for "Ahead"
+			status = "Ahead"
+		}
 	}
 
-	return &models.GoalProgress{
+	progress := models.GoalProgress{
 		Goal:               goal,
+		CurrentValue:       math.Round(current*100) / 100,
+		ExpectedValue:      math.Round(expected*100) / 100,
 		CurrentDistance:    math.Round(totalDistance*100) / 100,
 		ProgressPercentage: math.Round(progressPercentage*100) / 100,
 		Status:             status,
-		ExpectedDistance:   math.Round(expectedDistance*100) / 100,
 		Sessions:           sessions,
-	}, nil
+	}
+	if goal.GoalType == models.GoalTypeDistance {
+		progress.ExpectedDistance = progress.ExpectedValue
+	}
+
+	return progress
 }
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+func TestComputeGoalProgress(t *testing.T) {
+	start := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 10)
+	halfway := start.AddDate(0, 0, 5)
+	climb := 120.0
+
+	sessions := []models.Session{
+		{Distance: 10, Duration: 3000, ElevationGain: &climb},
+		{Distance: 5, Duration: 1600},
+	}
+
+	tests := []struct {
+		name         string
+		goalType     string
+		target       float64
+		sessions     []models.Session
+		now          time.Time
+		wantCurrent  float64
+		wantExpected float64
+		wantStatus   string
+	}{
+		{"distance on track", models.GoalTypeDistance, 30, sessions, halfway, 15, 15, "On Track"},
+		{"distance behind", models.GoalTypeDistance, 40, sessions, halfway, 15, 20, "Behind"},
+		{"duration ahead", models.GoalTypeDuration, 7200, sessions, halfway, 4600, 3600, "Ahead"},
+		{"run count completed", models.GoalTypeRunCount, 2, sessions, halfway, 2, 1, "Completed"},
+		{"elevation behind", models.GoalTypeElevation, 500, sessions, halfway, 120, 250, "Behind"},
+		{"pace on track", models.GoalTypePace, 310, sessions, halfway, 306.67, 310, "On Track"},
+		{"pace ahead", models.GoalTypePace, 330, sessions, halfway, 306.67, 330, "Ahead"},
+		{"pace behind", models.GoalTypePace, 300, sessions, halfway, 306.67, 300, "Behind"},
+		{"pace completed", models.GoalTypePace, 310, sessions, end, 306.67, 310, "Completed"},
+		{"pace without runs", models.GoalTypePace, 310, nil, halfway, 0, 310, "Behind"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goal := models.Goal{
+				GoalType:    tt.goalType,
+				TargetValue: tt.target,
+				StartDate:   start,
+				EndDate:     end,
+			}
+
+			progress := computeGoalProgress(goal, tt.sessions, tt.now)
+
+			if progress.CurrentValue != tt.wantCurrent {
+				t.Errorf("Expected current %.2f, got %.2f", tt.wantCurrent, progress.CurrentValue)
+			}
+			if progress.ExpectedValue != tt.wantExpected {
+				t.Errorf("Expected expected value %.2f, got %.2f", tt.wantExpected, progress.ExpectedValue)
+			}
+			if progress.Status != tt.wantStatus {
+				t.Errorf("Expected status %q, got %q", tt.wantStatus, progress.Status)
+			}
+			if progress.ProgressPercentage > 100 {
+				t.Errorf("Expected progress capped at 100%%, got %.2f", progress.ProgressPercentage)
+			}
+		})
+	}
+}
+
+func TestNextGoalPeriod(t *testing.T) {
+	tests := []struct {
+		name       string
+		recurrence string
+		days       int
+		start      time.Time
+		end        time.Time
+		wantStart  time.Time
+		wantEnd    time.Time
+	}{
+		{
+			name:       "weekly",
+			recurrence: models.GoalRecurrenceWeekly,
+			start:      time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC),
+			end:        time.Date(2024, 3, 10, 23, 59, 59, 0, time.UTC),
+			wantStart:  time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2024, 3, 17, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:       "monthly keeps the end on the last day of the month",
+			recurrence: models.GoalRecurrenceMonthly,
+			start:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			end:        time.Date(2024, 1, 31, 23, 59, 59, 0, time.UTC),
+			wantStart:  time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2024, 2, 29, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:       "custom interval",
+			recurrence: models.GoalRecurrenceCustom,
+			days:       14,
+			start:      time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			end:        time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+			wantStart:  time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+			wantEnd:    time.Date(2024, 3, 24, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := nextGoalPeriod(models.Goal{
+				StartDate:      tt.start,
+				EndDate:        tt.end,
+				Recurrence:     tt.recurrence,
+				RecurrenceDays: tt.days,
+			})
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("Expected %s - %s, got %s - %s", tt.wantStart, tt.wantEnd, start, end)
+			}
+		})
+	}
+}
+
+func TestGoalStreaks(t *testing.T) {
+	periods := func(statuses ...string) []models.GoalPeriod {
+		var list []models.GoalPeriod
+		for _, s := range statuses {
+			list = append(list, models.GoalPeriod{Status: s})
+		}
+		return list
+	}
+
+	tests := []struct {
+		name             string
+		periods          []models.GoalPeriod
+		currentCompleted bool
+		wantStreak       int
+		wantBest         int
+	}{
+		{"no periods", nil, false, 0, 0},
+		{"current period completed", nil, true, 1, 1},
+		{"broken streak", periods("Completed", "Completed", "Completed", "Missed", "Completed"), false, 1, 3},
+		{"streak extended by current", periods("Missed", "Completed", "Completed"), true, 3, 3},
+		{"last period missed", periods("Completed", "Missed"), false, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streak, best := goalStreaks(tt.periods, tt.currentCompleted)
+			if streak != tt.wantStreak || best != tt.wantBest {
+				t.Errorf("Expected streak %d and best %d, got %d and %d", tt.wantStreak, tt.wantBest, streak, best)
+			}
+		})
+	}
+}
+
+func TestCloseGoalPeriodsFarInThePast(t *testing.T) {
+	// A daily goal left five years behind, as stored before starts were capped
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	start := now.AddDate(-5, 0, 0).Truncate(24 * time.Hour)
+	goal := models.Goal{
+		ID:             1,
+		GoalType:       models.GoalTypeRunCount,
+		TargetValue:    1,
+		StartDate:      start,
+		EndDate:        start.Add(24*time.Hour - time.Second),
+		Recurrence:     models.GoalRecurrenceCustom,
+		RecurrenceDays: 1,
+	}
+
+	// Runs on the first day and on the day before the current one, plus one between two periods
+	sessions := []models.Session{
+		{Date: start.Add(8 * time.Hour), Distance: 5, Duration: 1500},
+		{Date: start.Add(24*time.Hour - time.Second/2), Distance: 5, Duration: 1500},
+		{Date: now.AddDate(0, 0, -1), Distance: 5, Duration: 1500},
+	}
+	queries := 0
+	list := func(from, to time.Time) ([]models.Session, error) {
+		queries++
+		var in []models.Session
+		for _, s := range sessions {
+			if !s.Date.Before(from) && !s.Date.After(to) {
+				in = append(in, s)
+			}
+		}
+		return in, nil
+	}
+
+	current, periods, err := closeGoalPeriods(goal, now, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queries != 1 {
+		t.Errorf("Expected the sessions of every period to be listed at once, got %d queries", queries)
+	}
+
+	days := int(now.Truncate(24*time.Hour).Sub(start).Hours() / 24)
+	if len(periods) != days {
+		t.Fatalf("Expected %d closed periods, got %d", days, len(periods))
+	}
+	if !current.StartDate.Equal(now.Truncate(24 * time.Hour)) {
+		t.Errorf("Expected the goal to move to today, got %s", current.StartDate)
+	}
+
+	completed := 0
+	for _, p := range periods {
+		if p.Status == "Completed" {
+			completed++
+		}
+	}
+	if completed != 2 || periods[0].Status != "Completed" || periods[len(periods)-1].Status != "Completed" {
+		t.Errorf("Expected the first and last periods completed, got %d completed (first %s, last %s)", completed, periods[0].Status, periods[len(periods)-1].Status)
+	}
+	if periods[0].FinalValue != 1 {
+		t.Errorf("Expected the run between two periods to count for neither, got %v in the first", periods[0].FinalValue)
+	}
+}
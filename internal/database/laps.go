@@ -0,0 +1,170 @@
+package database
+
+import (
+	"strings"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// recordBatchSize keeps multi-row record inserts well under SQLite's bound parameter limit
+const recordBatchSize = 50
+
+// CreateSessionWithRecords creates an imported session with its laps and device records in one transaction
+func (db *DB) CreateSessionWithRecords(session models.Session, laps []models.Lap, records []models.SessionRecord) (*models.Session, error) {
+	var created *models.Session
+
+	err := db.inTx(func(tx *sqlTx) error {
+		s, err := insertImportedSession(tx, session)
+		if err != nil {
+			return err
+		}
+		created = s
+
+		for _, lap := range laps {
+			_, err := tx.Exec(`
+				INSERT INTO session_laps (session_id, lap_index, start_time, distance, duration, elapsed_time, elevation_gain, avg_heart_rate, max_heart_rate, avg_cadence, avg_power)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				created.ID,
+				lap.LapIndex,
+				lap.StartTime,
+				lap.Distance,
+				lap.Duration,
+				lap.ElapsedTime,
+				lap.ElevationGain,
+				lap.AvgHeartRate,
+				lap.MaxHeartRate,
+				lap.AvgCadence,
+				lap.AvgPower,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := insertSessionRecords(tx, created.ID, records); err != nil {
+			return err
+		}
+		return insertBestEfforts(tx, created.ID, recordBestEfforts(records))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db.sessionsChanged(created.UserID, []int64{created.ID})
+	return created, nil
+}
+
+// insertSessionRecords writes records in batches, numbering them in slice order
+func insertSessionRecords(tx *sqlTx, sessionID int64, records []models.SessionRecord) error {
+	for start := 0; start < len(records); start += recordBatchSize {
+		end := min(start+recordBatchSize, len(records))
+		batch := records[start:end]
+
+		placeholders := make([]string, len(batch))
+		args := make([]any, 0, len(batch)*11)
+		for i, r := range batch {
+			placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+			args = append(args,
+				sessionID, start+i, r.Time,
+				r.Latitude, r.Longitude, r.Altitude, r.Distance, r.Speed,
+				r.HeartRate, r.Cadence, r.Power,
+			)
+		}
+
+		query := `INSERT INTO session_records (session_id, seq, time, latitude, longitude, altitude, distance, speed, heart_rate, cadence, power) VALUES ` +
+			strings.Join(placeholders, ", ")
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetLaps retrieves the laps of a user's session in order
+func (db *DB) GetLaps(userID int64, sessionID int) ([]models.Lap, error) {
+	query := `
+		SELECT l.lap_index, l.start_time, l.distance, l.duration, l.elapsed_time,
+			l.elevation_gain, l.avg_heart_rate, l.max_heart_rate, l.avg_cadence, l.avg_power
+		FROM session_laps l
+		JOIN sessions s ON s.id = l.session_id
+		WHERE l.session_id = ? AND s.user_id = ?
+		ORDER BY l.lap_index
+	`
+
+	rows, err := db.conn.Query(query, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var laps []models.Lap
+	for rows.Next() {
+		var l models.Lap
+		err := rows.Scan(
+			&l.LapIndex,
+			&l.StartTime,
+			&l.Distance,
+			&l.Duration,
+			&l.ElapsedTime,
+			&l.ElevationGain,
+			&l.AvgHeartRate,
+			&l.MaxHeartRate,
+			&l.AvgCadence,
+			&l.AvgPower,
+		)
+		if err != nil {
+			return nil, err
+		}
+		laps = append(laps, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return laps, nil
+}
+
+// GetSessionRecords retrieves the device records of a user's session in order
+func (db *DB) GetSessionRecords(userID int64, sessionID int) ([]models.SessionRecord, error) {
+	query := `
+		SELECT r.time, r.latitude, r.longitude, r.altitude, r.distance, r.speed, r.heart_rate, r.cadence, r.power
+		FROM session_records r
+		JOIN sessions s ON s.id = r.session_id
+		WHERE r.session_id = ? AND s.user_id = ?
+		ORDER BY r.seq
+	`
+
+	rows, err := db.conn.Query(query, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.SessionRecord
+	for rows.Next() {
+		var r models.SessionRecord
+		err := rows.Scan(
+			&r.Time,
+			&r.Latitude,
+			&r.Longitude,
+			&r.Altitude,
+			&r.Distance,
+			&r.Speed,
+			&r.HeartRate,
+			&r.Cadence,
+			&r.Power,
+		)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
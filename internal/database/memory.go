@@ -0,0 +1,800 @@
+package database
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// MemoryStore keeps sessions, goals and Strava connections in memory, for tests of the code
+// built on them. It behaves like DB for these, with a few exceptions: no training plans are
+// known, so MatchSession never matches, and no goal snapshots are recorded.
+type MemoryStore struct {
+	mu sync.Mutex
+
+	sessions    []models.Session
+	tracks      map[int64][]models.TrackPoint
+	laps        map[int64][]models.Lap
+	records     map[int64][]models.SessionRecord
+	goals       []*models.Goal
+	periods     map[int64][]models.GoalPeriod
+	connections []*models.StravaConnection
+	lastID      int64
+}
+
+var (
+	_ SessionStore = (*MemoryStore)(nil)
+	_ GoalStore    = (*MemoryStore)(nil)
+	_ StravaStore  = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore returns an empty store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tracks:  make(map[int64][]models.TrackPoint),
+		laps:    make(map[int64][]models.Lap),
+		records: make(map[int64][]models.SessionRecord),
+		periods: make(map[int64][]models.GoalPeriod),
+	}
+}
+
+// nextID hands out row IDs, unique across everything in the store
+func (m *MemoryStore) nextID() int64 {
+	m.lastID++
+	return m.lastID
+}
+
+// insertSession stores a new session, filling in its ID and timestamps
+func (m *MemoryStore) insertSession(session models.Session) *models.Session {
+	now := time.Now()
+	session.ID = m.nextID()
+	session.CreatedAt = now
+	session.UpdatedAt = now
+	session.DeletedAt = nil
+
+	m.sessions = append(m.sessions, session)
+	return &session
+}
+
+// findSession returns the stored session matching fn, or nil
+func (m *MemoryStore) findSession(fn func(s *models.Session) bool) *models.Session {
+	for i := range m.sessions {
+		if fn(&m.sessions[i]) {
+			return &m.sessions[i]
+		}
+	}
+	return nil
+}
+
+// activeSession returns a user's session outside the trash, or nil
+func (m *MemoryStore) activeSession(userID int64, id int) *models.Session {
+	return m.findSession(func(s *models.Session) bool {
+		return s.ID == int64(id) && s.UserID == userID && s.DeletedAt == nil
+	})
+}
+
+// ownsSession reports whether a session, in the trash or not, belongs to the user
+func (m *MemoryStore) ownsSession(userID int64, id int) bool {
+	return m.findSession(func(s *models.Session) bool {
+		return s.ID == int64(id) && s.UserID == userID
+	}) != nil
+}
+
+// deleteSession permanently removes a session with its track, laps and records
+func (m *MemoryStore) deleteSession(id int64) {
+	m.sessions = slices.DeleteFunc(m.sessions, func(s models.Session) bool { return s.ID == id })
+	delete(m.tracks, id)
+	delete(m.laps, id)
+	delete(m.records, id)
+}
+
+// sessionsBetween returns a user's sessions outside the trash dated within start and end,
+// most recent first
+func (m *MemoryStore) sessionsBetween(userID int64, start, end time.Time) []models.Session {
+	var sessions []models.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.DeletedAt == nil && !s.Date.Before(start) && !s.Date.After(end) {
+			sessions = append(sessions, s)
+		}
+	}
+
+	slices.SortStableFunc(sessions, func(a, b models.Session) int { return b.Date.Compare(a.Date) })
+	return sessions
+}
+
+func (m *MemoryStore) CreateSession(userID int64, req models.CreateSessionRequest) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.insertSession(models.Session{
+		UserID:   userID,
+		Date:     req.Date,
+		Distance: req.Distance,
+		Duration: req.Duration,
+		Notes:    req.Notes,
+		Source:   "manual",
+	}), nil
+}
+
+func (m *MemoryStore) CreateSessions(userID int64, source string, reqs []models.CreateSessionRequest) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := make([]models.Session, 0, len(reqs))
+	for _, req := range reqs {
+		session := m.insertSession(models.Session{
+			UserID:   userID,
+			Date:     req.Date,
+			Distance: req.Distance,
+			Duration: req.Duration,
+			Notes:    req.Notes,
+			Source:   source,
+		})
+		sessions = append(sessions, *session)
+	}
+
+	return sessions, nil
+}
+
+func (m *MemoryStore) CreateSessionWithTrack(session models.Session, points []models.TrackPoint) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session.StravaActivityID = nil
+	created := m.insertSession(session)
+	m.tracks[created.ID] = slices.Clone(points)
+	return created, nil
+}
+
+func (m *MemoryStore) CreateSessionWithRecords(session models.Session, laps []models.Lap, records []models.SessionRecord) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session.StravaActivityID = nil
+	created := m.insertSession(session)
+	m.laps[created.ID] = slices.Clone(laps)
+	m.records[created.ID] = slices.Clone(records)
+	return created, nil
+}
+
+func (m *MemoryStore) GetSession(userID int64, id int) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.activeSession(userID, id)
+	if session == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	s := *session
+	return &s, nil
+}
+
+func (m *MemoryStore) GetSessions(userID int64, startDate, endDate time.Time) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sessionsBetween(userID, startDate, endDate), nil
+}
+
+func (m *MemoryStore) ListSessions(userID int64, q models.SessionQuery) ([]models.Session, *string, error) {
+	if _, ok := sessionSortKeys[q.Sort]; !ok {
+		return nil, nil, errors.New("unsupported sort: " + q.Sort)
+	}
+
+	// Mirror the SQL ordering: by sort key, then ID, both in the requested direction, with
+	// sessions without pace last
+	direction := -1
+	if q.Order == "asc" {
+		direction = 1
+	}
+	order := func(s models.Session, key any, id int64) int {
+		own := sortKey(s, q.Sort)
+		switch {
+		case own == nil && key != nil:
+			return 1
+		case own != nil && key == nil:
+			return -1
+		}
+
+		c := 0
+		if own != nil {
+			c = compareSortKey(s, q.Sort, key)
+		}
+		if c == 0 {
+			c = cmp.Compare(s.ID, id)
+		}
+		return c * direction
+	}
+
+	var after func(s models.Session) bool
+	if q.Cursor != "" {
+		value, id, err := decodeSessionCursor(q.Cursor, q.Sort, q.Order)
+		if err != nil {
+			return nil, nil, err
+		}
+		after = func(s models.Session) bool {
+			return order(s, value, id) > 0
+		}
+	}
+
+	m.mu.Lock()
+	var sessions []models.Session
+	for _, s := range m.sessionsBetween(userID, q.StartDate, q.EndDate) {
+		switch {
+		case q.Source != "" && s.Source != q.Source:
+		case q.MinDistance != nil && s.Distance < *q.MinDistance:
+		case q.MaxDistance != nil && s.Distance > *q.MaxDistance:
+		case q.Search != "" && !strings.Contains(strings.ToLower(s.Notes), strings.ToLower(q.Search)):
+		case after != nil && !after(s):
+		default:
+			sessions = append(sessions, s)
+		}
+	}
+	m.mu.Unlock()
+
+	slices.SortFunc(sessions, func(a, b models.Session) int {
+		return order(a, sortKey(b, q.Sort), b.ID)
+	})
+
+	if len(sessions) <= q.Limit {
+		return sessions, nil, nil
+	}
+
+	sessions = sessions[:q.Limit]
+	cursor, err := encodeSessionCursor(sessions[len(sessions)-1], q.Sort, q.Order)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sessions, &cursor, nil
+}
+
+// sortKey returns the sort key of a session in the type decodeSessionCursor gives it
+func sortKey(s models.Session, sort string) any {
+	switch sort {
+	case "date":
+		return s.Date
+	case "duration":
+		return s.Duration
+	case "distance":
+		return s.Distance
+	default:
+		if s.Distance == 0 {
+			return nil
+		}
+		return float64(s.Duration) / s.Distance
+	}
+}
+
+// compareSortKey compares a session's sort key with a key as returned by sortKey
+func compareSortKey(s models.Session, sort string, key any) int {
+	switch k := key.(type) {
+	case time.Time:
+		return s.Date.Compare(k)
+	case int:
+		return cmp.Compare(s.Duration, k)
+	default:
+		return cmp.Compare(sortKey(s, sort).(float64), k.(float64))
+	}
+}
+
+func (m *MemoryStore) FindSessionByStartTime(userID int64, start time.Time, tolerance time.Duration) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := m.sessionsBetween(userID, start.Add(-tolerance), start.Add(tolerance))
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+
+	// sessionsBetween returns the most recent first
+	return &sessions[len(sessions)-1], nil
+}
+
+func (m *MemoryStore) UpdateSession(userID int64, id int, req models.CreateSessionRequest) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.activeSession(userID, id)
+	if session == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	session.Date = req.Date
+	session.Distance = req.Distance
+	session.Duration = req.Duration
+	session.Notes = req.Notes
+	session.UpdatedAt = time.Now()
+
+	s := *session
+	return &s, nil
+}
+
+func (m *MemoryStore) SoftDeleteSession(userID int64, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.activeSession(userID, id)
+	if session == nil {
+		return sql.ErrNoRows
+	}
+
+	now := time.Now()
+	session.DeletedAt = &now
+	return nil
+}
+
+func (m *MemoryStore) RestoreSession(userID int64, id int) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.findSession(func(s *models.Session) bool {
+		return s.ID == int64(id) && s.UserID == userID && s.DeletedAt != nil
+	})
+	if session == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	session.DeletedAt = nil
+	session.UpdatedAt = time.Now()
+
+	s := *session
+	return &s, nil
+}
+
+func (m *MemoryStore) GetDeletedSessions(userID int64) ([]models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sessions []models.Session
+	for _, s := range m.sessions {
+		if s.UserID == userID && s.DeletedAt != nil {
+			sessions = append(sessions, s)
+		}
+	}
+
+	slices.SortStableFunc(sessions, func(a, b models.Session) int { return b.DeletedAt.Compare(*a.DeletedAt) })
+	return sessions, nil
+}
+
+func (m *MemoryStore) GetTrackPoints(userID int64, sessionID int) ([]models.TrackPoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.ownsSession(userID, sessionID) {
+		return nil, nil
+	}
+	return slices.Clone(m.tracks[int64(sessionID)]), nil
+}
+
+func (m *MemoryStore) GetLaps(userID int64, sessionID int) ([]models.Lap, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.ownsSession(userID, sessionID) {
+		return nil, nil
+	}
+	return slices.Clone(m.laps[int64(sessionID)]), nil
+}
+
+func (m *MemoryStore) GetSessionRecords(userID int64, sessionID int) ([]models.SessionRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.ownsSession(userID, sessionID) {
+		return nil, nil
+	}
+	return slices.Clone(m.records[int64(sessionID)]), nil
+}
+
+// MatchSession never matches: the memory store holds no training plans
+func (m *MemoryStore) MatchSession(session *models.Session) (*models.PlannedWorkout, error) {
+	return nil, nil
+}
+
+// findGoal returns a user's stored goal, or nil
+func (m *MemoryStore) findGoal(userID int64, id int) *models.Goal {
+	for _, g := range m.goals {
+		if g.ID == int64(id) && g.UserID == userID {
+			return g
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) CreateGoal(userID int64, req models.CreateGoalRequest) (*models.Goal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	goal := &models.Goal{
+		ID:        m.nextID(),
+		UserID:    userID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	setGoal(goal, req)
+	m.goals = append(m.goals, goal)
+
+	g := *goal
+	return &g, nil
+}
+
+// setGoal copies the fields of a goal request to a goal
+func setGoal(goal *models.Goal, req models.CreateGoalRequest) {
+	goal.GoalType = req.GoalType
+	goal.TargetValue = req.TargetValue
+	goal.TargetDistance = req.TargetDistance
+	goal.StartDate = req.StartDate
+	goal.EndDate = req.EndDate
+	goal.Recurrence = req.Recurrence
+	goal.RecurrenceDays = req.RecurrenceDays
+}
+
+func (m *MemoryStore) GetGoals(userID int64) ([]models.GoalProgress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var list []*models.Goal
+	for _, g := range m.goals {
+		if g.UserID == userID {
+			list = append(list, g)
+		}
+	}
+	slices.SortStableFunc(list, func(a, b *models.Goal) int { return b.CreatedAt.Compare(a.CreatedAt) })
+
+	var goals []models.GoalProgress
+	for _, g := range list {
+		goals = append(goals, m.goalProgress(g))
+	}
+
+	return goals, nil
+}
+
+func (m *MemoryStore) GetGoal(userID int64, id int) (*models.GoalProgress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	goal := m.findGoal(userID, id)
+	if goal == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	progress := m.goalProgress(goal)
+	return &progress, nil
+}
+
+func (m *MemoryStore) UpdateGoal(userID int64, id int, req models.CreateGoalRequest) (*models.Goal, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	goal := m.findGoal(userID, id)
+	if goal == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	setGoal(goal, req)
+	goal.UpdatedAt = time.Now()
+	m.periods[goal.ID] = slices.DeleteFunc(m.periods[goal.ID], func(p models.GoalPeriod) bool {
+		return !p.PeriodStart.Before(goal.StartDate)
+	})
+
+	g := *goal
+	return &g, nil
+}
+
+func (m *MemoryStore) DeleteGoal(userID int64, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findGoal(userID, id) == nil {
+		return sql.ErrNoRows
+	}
+
+	m.goals = slices.DeleteFunc(m.goals, func(g *models.Goal) bool { return g.ID == int64(id) })
+	delete(m.periods, int64(id))
+	return nil
+}
+
+// GetGoalSnapshots returns no snapshots, since the memory store records none, or
+// sql.ErrNoRows if the goal doesn't exist
+func (m *MemoryStore) GetGoalSnapshots(userID int64, goalID int) ([]models.GoalSnapshot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findGoal(userID, goalID) == nil {
+		return nil, sql.ErrNoRows
+	}
+	return nil, nil
+}
+
+func (m *MemoryStore) GetGoalPeriods(userID int64, goalID int) ([]models.GoalPeriod, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findGoal(userID, goalID) == nil {
+		return nil, sql.ErrNoRows
+	}
+	return slices.Clone(m.periods[int64(goalID)]), nil
+}
+
+// goalProgress evaluates a stored goal as DB.calculateGoalProgress does. The memory store has no
+// background roller, so a recurring goal is moved to its current period here as
+// RollRecurringGoals would.
+func (m *MemoryStore) goalProgress(goal *models.Goal) models.GoalProgress {
+	now := time.Now()
+
+	if goal.Recurrence != "" {
+		current, closed, _ := closeGoalPeriods(*goal, now, func(start, end time.Time) ([]models.Session, error) {
+			return m.sessionsBetween(goal.UserID, start, end), nil
+		})
+		for _, p := range closed {
+			p.ID = m.nextID()
+			m.periods[goal.ID] = append(m.periods[goal.ID], p)
+		}
+		*goal = current
+	}
+
+	sessions := m.sessionsBetween(goal.UserID, goal.StartDate, goal.EndDate)
+	progress := computeGoalProgress(*goal, sessions, now)
+
+	if goal.GoalType != models.GoalTypePace {
+		history := m.sessionsBetween(goal.UserID, now.AddDate(0, 0, -7*forecastHistoryWeeks), now)
+		progress.Forecast = computeGoalForecast(*goal, goalValue(goal.GoalType, sessions), history, now)
+	}
+
+	if goal.Recurrence != "" {
+		progress.Streak, progress.BestStreak = goalStreaks(m.periods[goal.ID], progress.Status == "Completed")
+	}
+
+	return progress
+}
+
+// findConnection returns the stored connection matching fn, or nil
+func (m *MemoryStore) findConnection(fn func(c *models.StravaConnection) bool) *models.StravaConnection {
+	for _, c := range m.connections {
+		if fn(c) {
+			return c
+		}
+	}
+	return nil
+}
+
+// connectionOf returns the user's stored connection, or nil
+func (m *MemoryStore) connectionOf(userID int64) *models.StravaConnection {
+	return m.findConnection(func(c *models.StravaConnection) bool { return c.UserID == userID })
+}
+
+func (m *MemoryStore) CreateStravaConnection(conn models.StravaConnection) (*models.StravaConnection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.findConnection(func(c *models.StravaConnection) bool { return c.StravaAthleteID == conn.StravaAthleteID }) != nil {
+		return nil, fmt.Errorf("strava athlete %d is already connected", conn.StravaAthleteID)
+	}
+
+	stored := &models.StravaConnection{
+		ID:              m.nextID(),
+		UserID:          conn.UserID,
+		StravaAthleteID: conn.StravaAthleteID,
+		AccessToken:     conn.AccessToken,
+		RefreshToken:    conn.RefreshToken,
+		TokenExpiresAt:  conn.TokenExpiresAt,
+		ConnectedAt:     time.Now(),
+	}
+	m.connections = append(m.connections, stored)
+
+	c := *stored
+	return &c, nil
+}
+
+func (m *MemoryStore) GetStravaConnection(userID int64) (*models.StravaConnection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn := m.connectionOf(userID)
+	if conn == nil {
+		return nil, nil
+	}
+
+	c := *conn
+	return &c, nil
+}
+
+func (m *MemoryStore) GetStravaConnectionByAthleteID(athleteID int64) (*models.StravaConnection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn := m.findConnection(func(c *models.StravaConnection) bool {
+		return c.StravaAthleteID == athleteID && c.UserID != 0
+	})
+	if conn == nil {
+		return nil, nil
+	}
+
+	c := *conn
+	return &c, nil
+}
+
+func (m *MemoryStore) UpdateStravaTokens(athleteID int64, accessToken, refreshToken string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.connections {
+		if c.StravaAthleteID == athleteID {
+			c.AccessToken = accessToken
+			c.RefreshToken = refreshToken
+			c.TokenExpiresAt = expiresAt
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) DeleteStravaConnection(athleteID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.connections = slices.DeleteFunc(m.connections, func(c *models.StravaConnection) bool {
+		return c.StravaAthleteID == athleteID
+	})
+	return nil
+}
+
+func (m *MemoryStore) StartStravaSync(userID int64, now, staleBefore time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn := m.connectionOf(userID)
+	if conn == nil {
+		return sql.ErrNoRows
+	}
+
+	if conn.Sync.Status == models.StravaSyncRunning {
+		since := conn.Sync.StartedAt
+		if conn.Sync.ResumeAt != nil {
+			since = conn.Sync.ResumeAt
+		}
+		if since == nil || !since.Before(staleBefore) {
+			return ErrSyncInProgress
+		}
+	}
+
+	conn.Sync = models.StravaSync{Status: models.StravaSyncRunning, StartedAt: &now}
+	return nil
+}
+
+func (m *MemoryStore) UpdateStravaSyncProgress(userID int64, fetched, imported int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if conn := m.connectionOf(userID); conn != nil {
+		conn.Sync.Fetched = fetched
+		conn.Sync.Imported = imported
+	}
+	return nil
+}
+
+func (m *MemoryStore) PauseStravaSync(userID int64, resumeAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if conn := m.connectionOf(userID); conn != nil {
+		conn.Sync.ResumeAt = &resumeAt
+	}
+	return nil
+}
+
+func (m *MemoryStore) FinishStravaSync(userID int64, syncedAt time.Time, syncErr error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	conn := m.connectionOf(userID)
+	if conn == nil {
+		return nil
+	}
+
+	now := time.Now()
+	conn.Sync.FinishedAt = &now
+	conn.Sync.ResumeAt = nil
+	if syncErr != nil {
+		conn.Sync.Status = models.StravaSyncFailed
+		conn.Sync.Error = syncErr.Error()
+		return nil
+	}
+
+	conn.Sync.Status = models.StravaSyncCompleted
+	conn.LastSync = &syncedAt
+	return nil
+}
+
+// stravaSession returns the stored session of a Strava activity, or nil
+func (m *MemoryStore) stravaSession(activityID int64) *models.Session {
+	return m.findSession(func(s *models.Session) bool {
+		return s.StravaActivityID != nil && *s.StravaActivityID == activityID
+	})
+}
+
+func (m *MemoryStore) CreateStravaSession(session models.Session) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session.StravaActivityID != nil && m.stravaSession(*session.StravaActivityID) != nil {
+		return nil, nil
+	}
+
+	return m.insertSession(models.Session{
+		UserID:           session.UserID,
+		Date:             session.Date,
+		Distance:         session.Distance,
+		Duration:         session.Duration,
+		Notes:            session.Notes,
+		StravaActivityID: session.StravaActivityID,
+		Source:           "strava",
+	}), nil
+}
+
+func (m *MemoryStore) ImportStravaSessions(userID int64, sessions []models.Session) ([]models.Session, error) {
+	var created []models.Session
+	for _, session := range sessions {
+		session.UserID = userID
+		s, err := m.CreateStravaSession(session)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			created = append(created, *s)
+		}
+	}
+
+	return created, nil
+}
+
+func (m *MemoryStore) GetSessionByStravaActivityID(userID, activityID int64) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.stravaSession(activityID)
+	if session == nil || session.UserID != userID {
+		return nil, nil
+	}
+
+	s := *session
+	return &s, nil
+}
+
+func (m *MemoryStore) UpdateStravaSession(userID, activityID int64, session models.Session) (*models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored := m.stravaSession(activityID)
+	if stored == nil || stored.UserID != userID {
+		return nil, sql.ErrNoRows
+	}
+
+	stored.Date = session.Date
+	stored.Distance = session.Distance
+	stored.Duration = session.Duration
+	stored.Notes = session.Notes
+	stored.UpdatedAt = time.Now()
+
+	s := *stored
+	return &s, nil
+}
+
+func (m *MemoryStore) DeleteSessionByStravaActivityID(userID, activityID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if session := m.stravaSession(activityID); session != nil && session.UserID == userID {
+		m.deleteSession(session.ID)
+	}
+	return nil
+}
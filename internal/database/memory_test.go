@@ -0,0 +1,7 @@
+package database
+
+import "testing"
+
+func TestMemoryStoreSessionsWithoutPace(t *testing.T) {
+	checkSessionsWithoutPace(t, NewMemoryStore(), 1)
+}
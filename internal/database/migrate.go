@@ -0,0 +1,278 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationFiles are written for SQLite and shared by every backend; Postgres runs them with
+// their column types translated, or runs a NNNN_name.up.postgres.sql / .down.postgres.sql
+// file in their place where the two can't share a statement
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)(\.postgres)?\.sql$`)
+
+// Migration is a single versioned schema change loaded from the embedded migrations directory
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+
+	// PostgresUp and PostgresDown replace Up and Down on Postgres when set
+	PostgresUp   string
+	PostgresDown string
+}
+
+// up returns the statements applying the migration on a backend of dialect d
+func (m Migration) up(d dialect) string {
+	if d == dialectPostgres && m.PostgresUp != "" {
+		return m.PostgresUp
+	}
+	return d.schema(m.Up)
+}
+
+// down returns the statements reverting the migration on a backend of dialect d
+func (m Migration) down(d dialect) string {
+	if d == dialectPostgres && m.PostgresDown != "" {
+		return m.PostgresDown
+	}
+	return d.schema(m.Down)
+}
+
+// MigrationStatus reports whether a migration has been applied to the database
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads and validates the embedded migration files, ordered by version
+func loadMigrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		matches := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if matches == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", entry.Name(), err)
+		}
+
+		content, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		} else if m.Name != matches[2] {
+			return nil, fmt.Errorf("migration version %d has conflicting names: %s and %s", version, m.Name, matches[2])
+		}
+
+		switch {
+		case matches[3] == "up" && matches[4] == "":
+			m.Up = string(content)
+		case matches[3] == "up":
+			m.PostgresUp = string(content)
+		case matches[4] == "":
+			m.Down = string(content)
+		default:
+			m.PostgresDown = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing an up file", m.Version, m.Name)
+		}
+		if m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s is missing a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential starting at 1, found %d at position %d", m.Version, i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates the schema_migrations bookkeeping table
+func (db *DB) ensureMigrationsTable() error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL
+		)
+	`
+	_, err := db.conn.Exec(db.dialect.schema(query))
+	return err
+}
+
+// appliedMigrations returns the applied_at time of each applied migration keyed by version
+func (db *DB) appliedMigrations() (map[int]time.Time, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	rows, err := db.conn.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// Migrate applies every pending up migration in version order
+func (db *DB) Migrate() error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		log.Printf("[INFO] Migrate: Applying migration %04d_%s", m.Version, m.Name)
+		err := db.inTx(func(tx *sqlTx) error {
+			if _, err := tx.Exec(m.up(db.dialect)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(
+				`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version,
+				m.Name,
+				time.Now(),
+			)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+func (db *DB) MigrateDown(steps int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+
+		log.Printf("[INFO] Migrate: Reverting migration %04d_%s", m.Version, m.Name)
+		err := db.inTx(func(tx *sqlTx) error {
+			if _, err := tx.Exec(m.down(db.dialect)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("reverting migration %04d_%s failed: %w", m.Version, m.Name, err)
+		}
+		steps--
+	}
+
+	return nil
+}
+
+// MigrationStatus lists every known migration and when it was applied
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// inTx runs fn inside a transaction, rolling back if it returns an error
+func (db *DB) inTx(fn func(tx *sqlTx) error) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
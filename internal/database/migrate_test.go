@@ -0,0 +1,32 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("Expected at least one migration")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Fatalf("Expected migration version %d, got %d", i+1, m.Version)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Fatalf("Migration %d_%s is missing up or down SQL", m.Version, m.Name)
+		}
+	}
+
+	// SQLite rebuilds the tables 0002 added user_id to, Postgres drops the columns
+	users := migrations[1]
+	if !strings.Contains(users.down(dialectSQLite), "RENAME TO sessions") || !strings.Contains(users.down(dialectPostgres), "DROP COLUMN user_id") {
+		t.Errorf("Expected dialect specific down statements for 0002_%s", users.Name)
+	}
+}
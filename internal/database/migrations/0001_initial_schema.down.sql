@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS strava_connections;
+DROP TABLE IF EXISTS goals;
+DROP TABLE IF EXISTS sessions;
@@ -0,0 +1,33 @@
+-- Tables may already exist on databases created before migrations were introduced,
+-- so this baseline migration must stay idempotent.
+CREATE TABLE IF NOT EXISTS sessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	date DATETIME NOT NULL,
+	distance REAL NOT NULL,
+	duration INTEGER NOT NULL,
+	notes TEXT,
+	strava_activity_id INTEGER UNIQUE,
+	source TEXT DEFAULT 'manual',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS goals (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	target_distance REAL NOT NULL,
+	start_date DATETIME NOT NULL,
+	end_date DATETIME NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS strava_connections (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER,
+	strava_athlete_id INTEGER NOT NULL UNIQUE,
+	access_token TEXT NOT NULL,
+	refresh_token TEXT NOT NULL,
+	token_expires_at DATETIME NOT NULL,
+	connected_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_sync DATETIME
+);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_strava_connections_user;
+DROP INDEX IF EXISTS idx_goals_user;
+DROP INDEX IF EXISTS idx_sessions_user_date;
+
+ALTER TABLE goals DROP COLUMN user_id;
+ALTER TABLE sessions DROP COLUMN user_id;
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,36 @@
+DROP INDEX IF EXISTS idx_strava_connections_user;
+DROP INDEX IF EXISTS idx_goals_user;
+DROP INDEX IF EXISTS idx_sessions_user_date;
+
+-- SQLite can't always drop a column declared with REFERENCES, so both tables are rebuilt
+-- without user_id. Postgres drops the columns in 0002_users.down.postgres.sql instead.
+CREATE TABLE sessions_without_users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	date DATETIME NOT NULL,
+	distance REAL NOT NULL,
+	duration INTEGER NOT NULL,
+	notes TEXT,
+	strava_activity_id INTEGER UNIQUE,
+	source TEXT DEFAULT 'manual',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO sessions_without_users (id, date, distance, duration, notes, strava_activity_id, source, created_at, updated_at)
+SELECT id, date, distance, duration, notes, strava_activity_id, source, created_at, updated_at FROM sessions;
+DROP TABLE sessions;
+ALTER TABLE sessions_without_users RENAME TO sessions;
+
+CREATE TABLE goals_without_users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	target_distance REAL NOT NULL,
+	start_date DATETIME NOT NULL,
+	end_date DATETIME NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO goals_without_users (id, target_distance, start_date, end_date, created_at, updated_at)
+SELECT id, target_distance, start_date, end_date, created_at, updated_at FROM goals;
+DROP TABLE goals;
+ALTER TABLE goals_without_users RENAME TO goals;
+
+DROP TABLE IF EXISTS users;
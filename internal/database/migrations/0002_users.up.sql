@@ -0,0 +1,16 @@
+CREATE TABLE users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL UNIQUE,
+	name TEXT,
+	password_hash TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Rows created before accounts existed keep a NULL user_id until the first user signs up and claims them.
+ALTER TABLE sessions ADD COLUMN user_id INTEGER REFERENCES users(id);
+ALTER TABLE goals ADD COLUMN user_id INTEGER REFERENCES users(id);
+
+CREATE INDEX idx_sessions_user_date ON sessions(user_id, date);
+CREATE INDEX idx_goals_user ON goals(user_id);
+CREATE INDEX idx_strava_connections_user ON strava_connections(user_id);
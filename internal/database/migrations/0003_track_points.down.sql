@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_track_points_session;
+DROP TABLE IF EXISTS track_points;
+
+ALTER TABLE sessions DROP COLUMN elevation_gain;
@@ -0,0 +1,13 @@
+ALTER TABLE sessions ADD COLUMN elevation_gain REAL;
+
+CREATE TABLE track_points (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	seq INTEGER NOT NULL,
+	latitude REAL NOT NULL,
+	longitude REAL NOT NULL,
+	elevation REAL,
+	time DATETIME
+);
+
+CREATE INDEX idx_track_points_session ON track_points(session_id, seq);
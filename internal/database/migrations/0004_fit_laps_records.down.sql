@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_session_records_session;
+DROP TABLE IF EXISTS session_records;
+
+DROP INDEX IF EXISTS idx_session_laps_session;
+DROP TABLE IF EXISTS session_laps;
+
+ALTER TABLE sessions DROP COLUMN max_heart_rate;
+ALTER TABLE sessions DROP COLUMN avg_heart_rate;
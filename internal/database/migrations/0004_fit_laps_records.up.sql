@@ -0,0 +1,36 @@
+ALTER TABLE sessions ADD COLUMN avg_heart_rate INTEGER;
+ALTER TABLE sessions ADD COLUMN max_heart_rate INTEGER;
+
+CREATE TABLE session_laps (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	lap_index INTEGER NOT NULL,
+	start_time DATETIME NOT NULL,
+	distance REAL NOT NULL,
+	duration INTEGER NOT NULL,
+	elapsed_time INTEGER NOT NULL,
+	elevation_gain REAL,
+	avg_heart_rate INTEGER,
+	max_heart_rate INTEGER,
+	avg_cadence INTEGER,
+	avg_power INTEGER
+);
+
+CREATE INDEX idx_session_laps_session ON session_laps(session_id, lap_index);
+
+CREATE TABLE session_records (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	seq INTEGER NOT NULL,
+	time DATETIME NOT NULL,
+	latitude REAL,
+	longitude REAL,
+	altitude REAL,
+	distance REAL,
+	speed REAL,
+	heart_rate INTEGER,
+	cadence INTEGER,
+	power INTEGER
+);
+
+CREATE INDEX idx_session_records_session ON session_records(session_id, seq);
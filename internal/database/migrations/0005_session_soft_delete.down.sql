@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_sessions_deleted_at;
+
+-- Trashed sessions would reappear once the column is gone, so drop them with their child rows
+DELETE FROM track_points WHERE session_id IN (SELECT id FROM sessions WHERE deleted_at IS NOT NULL);
+DELETE FROM session_laps WHERE session_id IN (SELECT id FROM sessions WHERE deleted_at IS NOT NULL);
+DELETE FROM session_records WHERE session_id IN (SELECT id FROM sessions WHERE deleted_at IS NOT NULL);
+DELETE FROM sessions WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE sessions DROP COLUMN deleted_at;
@@ -0,0 +1,3 @@
+ALTER TABLE sessions ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX idx_sessions_deleted_at ON sessions(deleted_at);
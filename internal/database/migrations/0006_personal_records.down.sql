@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_personal_records_user;
+DROP TABLE IF EXISTS personal_records;
@@ -0,0 +1,12 @@
+CREATE TABLE personal_records (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	category TEXT NOT NULL,
+	session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	distance REAL NOT NULL,
+	duration INTEGER NOT NULL,
+	achieved_at DATETIME NOT NULL,
+	superseded_at DATETIME
+);
+
+CREATE INDEX idx_personal_records_user ON personal_records(user_id, category, achieved_at);
@@ -0,0 +1,11 @@
+CREATE TABLE goal_snapshots (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	goal_id INTEGER NOT NULL REFERENCES goals(id) ON DELETE CASCADE,
+	snapshot_date TEXT NOT NULL,
+	current_value REAL NOT NULL,
+	expected_value REAL NOT NULL,
+	progress_percentage REAL NOT NULL,
+	status TEXT NOT NULL,
+	recorded_at DATETIME NOT NULL,
+	UNIQUE (goal_id, snapshot_date)
+);
@@ -0,0 +1,6 @@
+-- Other goal types can't be expressed as a target distance, so drop them with their snapshots
+DELETE FROM goal_snapshots WHERE goal_id IN (SELECT id FROM goals WHERE goal_type <> 'distance');
+DELETE FROM goals WHERE goal_type <> 'distance';
+
+ALTER TABLE goals DROP COLUMN target_value;
+ALTER TABLE goals DROP COLUMN goal_type;
@@ -0,0 +1,4 @@
+ALTER TABLE goals ADD COLUMN goal_type TEXT NOT NULL DEFAULT 'distance';
+ALTER TABLE goals ADD COLUMN target_value REAL NOT NULL DEFAULT 0;
+
+UPDATE goals SET target_value = target_distance;
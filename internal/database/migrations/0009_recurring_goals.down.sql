@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS goal_periods;
+
+ALTER TABLE goals DROP COLUMN recurrence_days;
+ALTER TABLE goals DROP COLUMN recurrence;
@@ -0,0 +1,14 @@
+ALTER TABLE goals ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';
+ALTER TABLE goals ADD COLUMN recurrence_days INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE goal_periods (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	goal_id INTEGER NOT NULL REFERENCES goals(id) ON DELETE CASCADE,
+	period_start DATETIME NOT NULL,
+	period_end DATETIME NOT NULL,
+	target_value REAL NOT NULL,
+	final_value REAL NOT NULL,
+	status TEXT NOT NULL,
+	closed_at DATETIME NOT NULL,
+	UNIQUE (goal_id, period_start)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_planned_workouts_user_date;
+DROP INDEX IF EXISTS idx_planned_workouts_plan;
+DROP TABLE IF EXISTS planned_workouts;
+
+DROP INDEX IF EXISTS idx_training_plans_user;
+DROP TABLE IF EXISTS training_plans;
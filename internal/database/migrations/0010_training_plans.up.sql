@@ -0,0 +1,30 @@
+CREATE TABLE training_plans (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	name TEXT NOT NULL,
+	race_distance TEXT NOT NULL DEFAULT '',
+	race_date TEXT NOT NULL DEFAULT '',
+	start_date TEXT NOT NULL,
+	weekly_volume REAL NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_training_plans_user ON training_plans(user_id);
+
+CREATE TABLE planned_workouts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	plan_id INTEGER NOT NULL REFERENCES training_plans(id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	date TEXT NOT NULL,
+	workout_type TEXT NOT NULL,
+	distance REAL NOT NULL DEFAULT 0,
+	duration INTEGER,
+	target_pace REAL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL,
+	updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_planned_workouts_plan ON planned_workouts(plan_id, date);
+CREATE INDEX idx_planned_workouts_user_date ON planned_workouts(user_id, date);
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_planned_workouts_session;
+
+ALTER TABLE planned_workouts DROP COLUMN matched_at;
+ALTER TABLE planned_workouts DROP COLUMN compliance;
+ALTER TABLE planned_workouts DROP COLUMN pace_deviation;
+ALTER TABLE planned_workouts DROP COLUMN duration_deviation;
+ALTER TABLE planned_workouts DROP COLUMN distance_deviation;
+ALTER TABLE planned_workouts DROP COLUMN actual_duration;
+ALTER TABLE planned_workouts DROP COLUMN actual_distance;
+ALTER TABLE planned_workouts DROP COLUMN session_id;
@@ -0,0 +1,11 @@
+-- A planned workout is matched to at most one session run on its day
+ALTER TABLE planned_workouts ADD COLUMN session_id INTEGER;
+ALTER TABLE planned_workouts ADD COLUMN actual_distance REAL;
+ALTER TABLE planned_workouts ADD COLUMN actual_duration INTEGER;
+ALTER TABLE planned_workouts ADD COLUMN distance_deviation REAL;
+ALTER TABLE planned_workouts ADD COLUMN duration_deviation REAL;
+ALTER TABLE planned_workouts ADD COLUMN pace_deviation REAL;
+ALTER TABLE planned_workouts ADD COLUMN compliance REAL;
+ALTER TABLE planned_workouts ADD COLUMN matched_at DATETIME;
+
+CREATE INDEX idx_planned_workouts_session ON planned_workouts(session_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS training_load;
+DROP TABLE IF EXISTS session_stress;
@@ -0,0 +1,22 @@
+-- Stress of every active session, kept so a change can be traced to the first day it affects
+CREATE TABLE session_stress (
+	session_id INTEGER PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	day TEXT NOT NULL,
+	stress REAL NOT NULL,
+	intensity REAL NOT NULL,
+	method TEXT NOT NULL
+);
+
+CREATE INDEX idx_session_stress_user_day ON session_stress(user_id, day);
+
+-- One row per day from a user's first to last session day
+CREATE TABLE training_load (
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	day TEXT NOT NULL,
+	stress REAL NOT NULL,
+	atl REAL NOT NULL,
+	ctl REAL NOT NULL,
+	tsb REAL NOT NULL,
+	PRIMARY KEY (user_id, day)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE strava_connections DROP COLUMN sync_error;
+ALTER TABLE strava_connections DROP COLUMN sync_imported;
+ALTER TABLE strava_connections DROP COLUMN sync_fetched;
+ALTER TABLE strava_connections DROP COLUMN sync_finished_at;
+ALTER TABLE strava_connections DROP COLUMN sync_started_at;
+ALTER TABLE strava_connections DROP COLUMN sync_status;
@@ -0,0 +1,7 @@
+-- Progress of the latest activity backfill of each connection
+ALTER TABLE strava_connections ADD COLUMN sync_status TEXT NOT NULL DEFAULT '';
+ALTER TABLE strava_connections ADD COLUMN sync_started_at DATETIME;
+ALTER TABLE strava_connections ADD COLUMN sync_finished_at DATETIME;
+ALTER TABLE strava_connections ADD COLUMN sync_fetched INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE strava_connections ADD COLUMN sync_imported INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE strava_connections ADD COLUMN sync_error TEXT NOT NULL DEFAULT '';
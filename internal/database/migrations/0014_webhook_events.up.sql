@@ -0,0 +1,14 @@
+-- Strava webhook events, stored before they are acknowledged and worked off by the webhook worker
+CREATE TABLE webhook_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	payload TEXT NOT NULL,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	received_at DATETIME NOT NULL,
+	next_attempt_at DATETIME NOT NULL,
+	locked_at DATETIME,
+	processed_at DATETIME
+);
+
+CREATE INDEX idx_webhook_events_status ON webhook_events(status, next_attempt_at);
@@ -0,0 +1 @@
+ALTER TABLE strava_connections DROP COLUMN sync_resume_at;
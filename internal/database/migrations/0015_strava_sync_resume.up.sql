@@ -0,0 +1,2 @@
+-- When a backfill paused by Strava's rate limits continues
+ALTER TABLE strava_connections ADD COLUMN sync_resume_at DATETIME;
@@ -0,0 +1,7 @@
+-- The fastest stretch of each record distance within an imported session's track or device records
+CREATE TABLE session_best_efforts (
+	session_id INTEGER NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+	category TEXT NOT NULL,
+	duration INTEGER NOT NULL,
+	PRIMARY KEY (session_id, category)
+);
@@ -0,0 +1,9 @@
+-- What each user's threshold is estimated from, with the sessions it came from, so a changed
+-- session can be checked against it without reading all of the user's sessions
+CREATE TABLE training_thresholds (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id),
+	hour_pace REAL NOT NULL,
+	hour_pace_session_id INTEGER,
+	max_heart_rate INTEGER NOT NULL,
+	max_heart_rate_session_id INTEGER
+);
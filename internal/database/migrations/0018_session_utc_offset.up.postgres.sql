@@ -0,0 +1,4 @@
+-- The offset each session was logged with, in seconds east of UTC, so its calendar day
+-- survives TIMESTAMPTZ keeping only the instant. The offsets of existing sessions are lost
+-- already, so they are taken as UTC.
+ALTER TABLE sessions ADD COLUMN utc_offset BIGINT NOT NULL DEFAULT 0;
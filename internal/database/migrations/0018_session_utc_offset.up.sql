@@ -0,0 +1,6 @@
+-- The offset each session was logged with, in seconds east of UTC, so its calendar day
+-- survives backends that store only the instant
+ALTER TABLE sessions ADD COLUMN utc_offset INTEGER NOT NULL DEFAULT 0;
+
+-- SQLite kept the offset in the stored text: the wall clock time less the instant
+UPDATE sessions SET utc_offset = CAST(ROUND((julianday(substr(date, 1, 19)) - julianday(date)) * 86400) AS INTEGER);
@@ -0,0 +1,413 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// trainingPlanColumns is the column list selected for every plan query, in scanTrainingPlan order
+const trainingPlanColumns = `id, user_id, name, race_distance, race_date, start_date, weekly_volume, created_at, updated_at`
+
+// plannedWorkoutColumns is the column list selected for every workout query, in scanPlannedWorkout order
+const plannedWorkoutColumns = `id, plan_id, date, workout_type, distance, duration, target_pace, description,
+	session_id, actual_distance, actual_duration, distance_deviation, duration_deviation, pace_deviation, compliance, matched_at,
+	created_at, updated_at`
+
+func scanTrainingPlan(row scanner) (*models.TrainingPlan, error) {
+	var plan models.TrainingPlan
+	err := row.Scan(
+		&plan.ID,
+		&plan.UserID,
+		&plan.Name,
+		&plan.RaceDistance,
+		&plan.RaceDate,
+		&plan.StartDate,
+		&plan.WeeklyVolume,
+		&plan.CreatedAt,
+		&plan.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &plan, nil
+}
+
+func scanPlannedWorkout(row scanner) (*models.PlannedWorkout, error) {
+	var workout models.PlannedWorkout
+	var match models.WorkoutMatch
+	var sessionID *int64
+	var actualDistance, compliance *float64
+	var actualDuration *int
+	var matchedAt *time.Time
+	err := row.Scan(
+		&workout.ID,
+		&workout.PlanID,
+		&workout.Date,
+		&workout.WorkoutType,
+		&workout.Distance,
+		&workout.Duration,
+		&workout.TargetPace,
+		&workout.Description,
+		&sessionID,
+		&actualDistance,
+		&actualDuration,
+		&match.DistanceDeviation,
+		&match.DurationDeviation,
+		&match.PaceDeviation,
+		&compliance,
+		&matchedAt,
+		&workout.CreatedAt,
+		&workout.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The match columns are written together, so session_id alone tells whether there is one
+	if sessionID != nil {
+		match.SessionID = *sessionID
+		match.ActualDistance = *actualDistance
+		match.ActualDuration = *actualDuration
+		match.Compliance = *compliance
+		match.MatchedAt = *matchedAt
+		workout.Match = &match
+	}
+
+	return &workout, nil
+}
+
+// CreatePlan stores a training plan for plan.UserID together with its workouts in one transaction
+func (db *DB) CreatePlan(plan models.TrainingPlan, workouts []models.PlannedWorkoutRequest) (*models.TrainingPlan, error) {
+	var created *models.TrainingPlan
+
+	err := db.inTx(func(tx *sqlTx) error {
+		query := `
+			INSERT INTO training_plans (user_id, name, race_distance, race_date, start_date, weekly_volume, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			RETURNING ` + trainingPlanColumns
+
+		now := time.Now()
+		p, err := scanTrainingPlan(tx.QueryRow(
+			query,
+			plan.UserID,
+			plan.Name,
+			plan.RaceDistance,
+			plan.RaceDate,
+			plan.StartDate,
+			plan.WeeklyVolume,
+			now,
+			now,
+		))
+		if err != nil {
+			return err
+		}
+		created = p
+
+		_, err = insertPlannedWorkouts(tx, created.ID, created.UserID, workouts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Runs already logged on the plan's days complete their workouts
+	if err := db.refreshWorkoutMatches(created.UserID); err != nil {
+		return nil, err
+	}
+
+	created.Workouts, err = db.queryPlannedWorkouts(`plan_id = ?`, created.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// insertPlannedWorkouts adds workouts to a plan, returning them as stored
+func insertPlannedWorkouts(tx *sqlTx, planID, userID int64, workouts []models.PlannedWorkoutRequest) ([]models.PlannedWorkout, error) {
+	query := `
+		INSERT INTO planned_workouts (plan_id, user_id, date, workout_type, distance, duration, target_pace, description, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING ` + plannedWorkoutColumns
+
+	now := time.Now()
+	created := make([]models.PlannedWorkout, 0, len(workouts))
+	for _, w := range workouts {
+		workout, err := scanPlannedWorkout(tx.QueryRow(
+			query,
+			planID,
+			userID,
+			w.Date,
+			w.WorkoutType,
+			w.Distance,
+			w.Duration,
+			w.TargetPace,
+			w.Description,
+			now,
+			now,
+		))
+		if err != nil {
+			return nil, err
+		}
+		created = append(created, *workout)
+	}
+
+	return created, nil
+}
+
+// GetPlans lists a user's training plans without their workouts, newest first
+func (db *DB) GetPlans(userID int64) ([]models.TrainingPlan, error) {
+	query := `
+		SELECT ` + trainingPlanColumns + `
+		FROM training_plans
+		WHERE user_id = ?
+		ORDER BY created_at DESC
+	`
+
+	rows, err := db.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var plans []models.TrainingPlan
+	for rows.Next() {
+		plan, err := scanTrainingPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, *plan)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+// GetPlan retrieves a user's training plan with all of its workouts
+func (db *DB) GetPlan(userID int64, id int) (*models.TrainingPlan, error) {
+	query := `
+		SELECT ` + trainingPlanColumns + `
+		FROM training_plans
+		WHERE id = ? AND user_id = ?
+	`
+
+	plan, err := scanTrainingPlan(db.conn.QueryRow(query, id, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Workouts, err = db.queryPlannedWorkouts(`plan_id = ?`, plan.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// UpdatePlan changes a user's plan details. When workouts is non-nil the plan's workouts are
+// replaced by them, otherwise they are left as they are. Returns sql.ErrNoRows if the plan
+// doesn't exist.
+func (db *DB) UpdatePlan(userID int64, id int, plan models.TrainingPlan, workouts []models.PlannedWorkoutRequest) (*models.TrainingPlan, error) {
+	var updated *models.TrainingPlan
+
+	err := db.inTx(func(tx *sqlTx) error {
+		query := `
+			UPDATE training_plans
+			SET name = ?, race_distance = ?, race_date = ?, start_date = ?, weekly_volume = ?, updated_at = ?
+			WHERE id = ? AND user_id = ?
+			RETURNING ` + trainingPlanColumns
+
+		p, err := scanTrainingPlan(tx.QueryRow(
+			query,
+			plan.Name,
+			plan.RaceDistance,
+			plan.RaceDate,
+			plan.StartDate,
+			plan.WeeklyVolume,
+			time.Now(),
+			id,
+			userID,
+		))
+		if err != nil {
+			return err
+		}
+		updated = p
+
+		if workouts == nil {
+			return nil
+		}
+
+		if _, err := tx.Exec(`DELETE FROM planned_workouts WHERE plan_id = ?`, updated.ID); err != nil {
+			return err
+		}
+		_, err = insertPlannedWorkouts(tx, updated.ID, userID, workouts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if workouts != nil {
+		if err := db.refreshWorkoutMatches(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	updated.Workouts, err = db.queryPlannedWorkouts(`plan_id = ?`, updated.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// DeletePlan removes a user's plan and its workouts, returning sql.ErrNoRows if it doesn't exist
+func (db *DB) DeletePlan(userID int64, id int) error {
+	return db.inTx(func(tx *sqlTx) error {
+		plan := `SELECT id FROM training_plans WHERE id = ? AND user_id = ?`
+		if err := deleteChildRows(tx, []string{"planned_workouts"}, "plan_id", plan, id, userID); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`DELETE FROM training_plans WHERE id = ? AND user_id = ?`, id, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if rows == 0 {
+			return sql.ErrNoRows
+		}
+
+		return nil
+	})
+}
+
+// CreatePlannedWorkout adds a workout to a user's plan, returning sql.ErrNoRows if the plan doesn't exist
+func (db *DB) CreatePlannedWorkout(userID int64, planID int, req models.PlannedWorkoutRequest) (*models.PlannedWorkout, error) {
+	var created *models.PlannedWorkout
+
+	err := db.inTx(func(tx *sqlTx) error {
+		var id int64
+		err := tx.QueryRow(`SELECT id FROM training_plans WHERE id = ? AND user_id = ?`, planID, userID).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		workouts, err := insertPlannedWorkouts(tx, id, userID, []models.PlannedWorkoutRequest{req})
+		if err != nil {
+			return err
+		}
+		created = &workouts[0]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.refreshWorkoutMatches(userID); err != nil {
+		return nil, err
+	}
+
+	return scanPlannedWorkout(db.conn.QueryRow(`SELECT `+plannedWorkoutColumns+` FROM planned_workouts WHERE id = ?`, created.ID))
+}
+
+// UpdatePlannedWorkout changes a workout of a user's plan, returning sql.ErrNoRows if it doesn't exist.
+// The workout keeps its match while it stays on the session's day, and may be matched on its new one.
+func (db *DB) UpdatePlannedWorkout(userID int64, planID, id int, req models.PlannedWorkoutRequest) (*models.PlannedWorkout, error) {
+	query := `
+		UPDATE planned_workouts
+		SET date = ?, workout_type = ?, distance = ?, duration = ?, target_pace = ?, description = ?, updated_at = ?
+		WHERE id = ? AND plan_id = ? AND user_id = ?
+		RETURNING ` + plannedWorkoutColumns
+
+	workout, err := scanPlannedWorkout(db.conn.QueryRow(
+		query,
+		req.Date,
+		req.WorkoutType,
+		req.Distance,
+		req.Duration,
+		req.TargetPace,
+		req.Description,
+		time.Now(),
+		id,
+		planID,
+		userID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	// A workout that moved or changed its targets needs its match released, rescored or made
+	if err := db.refreshWorkoutMatches(userID); err != nil {
+		return nil, err
+	}
+
+	return scanPlannedWorkout(db.conn.QueryRow(`SELECT `+plannedWorkoutColumns+` FROM planned_workouts WHERE id = ?`, workout.ID))
+}
+
+// DeletePlannedWorkout removes a workout from a user's plan, returning sql.ErrNoRows if it doesn't exist
+func (db *DB) DeletePlannedWorkout(userID int64, planID, id int) error {
+	query := `DELETE FROM planned_workouts WHERE id = ? AND plan_id = ? AND user_id = ?`
+	result, err := db.conn.Exec(query, id, planID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetScheduledWorkouts lists a user's planned workouts across all plans between two days, inclusive
+func (db *DB) GetScheduledWorkouts(userID int64, from, to string) ([]models.PlannedWorkout, error) {
+	return db.queryPlannedWorkouts(`user_id = ? AND date >= ? AND date <= ?`, userID, from, to)
+}
+
+// queryPlannedWorkouts lists the workouts matching a condition in date order
+func (db *DB) queryPlannedWorkouts(condition string, args ...any) ([]models.PlannedWorkout, error) {
+	query := `
+		SELECT ` + plannedWorkoutColumns + `
+		FROM planned_workouts
+		WHERE ` + condition + `
+		ORDER BY date, id
+	`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var workouts []models.PlannedWorkout
+	for rows.Next() {
+		workout, err := scanPlannedWorkout(rows)
+		if err != nil {
+			return nil, err
+		}
+		workouts = append(workouts, *workout)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return workouts, nil
+}
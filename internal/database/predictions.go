@@ -0,0 +1,46 @@
+package database
+
+import (
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+	"github.com/thc/runna-backend/internal/predictions"
+)
+
+// GetPredictions predicts a user's race times as of now, with a weekly history of how the
+// predictions evolved over the last historyWeeks weeks, the last point being now. History is
+// derived from the sessions, so edited and imported sessions are reflected in it.
+func (db *DB) GetPredictions(userID int64, now time.Time, historyWeeks int) (*models.Predictions, error) {
+	sessions, err := db.getActiveSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.Predictions{
+		AsOf:     now.Format("2006-01-02"),
+		Evidence: []models.PredictionEvidence{},
+		Races:    []models.RacePrediction{},
+		History:  []models.PredictionPoint{},
+	}
+
+	if estimate := predictions.Predict(sessions, now); estimate != nil {
+		result.VDOT = &estimate.VDOT
+		result.Evidence = estimate.Evidence
+		result.Races = estimate.Races
+	}
+
+	for week := historyWeeks - 1; week >= 0; week-- {
+		asOf := now.AddDate(0, 0, -7*week)
+		point := models.PredictionPoint{Date: asOf.Format("2006-01-02"), Times: map[string]int{}}
+
+		if estimate := predictions.Predict(sessions, asOf); estimate != nil {
+			point.VDOT = &estimate.VDOT
+			for _, race := range estimate.Races {
+				point.Times[race.Race] = race.Time
+			}
+		}
+		result.History = append(result.History, point)
+	}
+
+	return result, nil
+}
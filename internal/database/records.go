@@ -0,0 +1,424 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"time"
+
+	"github.com/thc/runna-backend/internal/gpx"
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// recordCategory is a personal record category; a zero Distance means the longest run
+type recordCategory struct {
+	Name     string
+	Distance float64 // km
+}
+
+var recordCategories = []recordCategory{
+	{Name: "1k", Distance: 1},
+	{Name: "5k", Distance: 5},
+	{Name: "10k", Distance: 10},
+	{Name: "half_marathon", Distance: 21.0975},
+	{Name: "marathon", Distance: 42.195},
+	{Name: "longest_run", Distance: 0},
+}
+
+// recordDistanceTolerance lets a session without a best effort of a race distance count towards
+// it when its distance is slightly off, as GPS often measures
+const recordDistanceTolerance = 0.02
+
+// bestEfforts returns the fastest time in seconds over each record distance along a recording,
+// given as cumulative distances in km and the times they were reached. Distances the recording
+// doesn't cover are left out.
+func bestEfforts(distances []float64, times []time.Time) map[string]int {
+	efforts := make(map[string]int)
+
+	for _, category := range recordCategories {
+		if category.Distance == 0 {
+			continue
+		}
+
+		best := math.Inf(1)
+		start := 0
+		for end := range distances {
+			for start+1 < end && distances[end]-distances[start+1] >= category.Distance {
+				start++
+			}
+			if distances[end]-distances[start] < category.Distance {
+				continue
+			}
+
+			// The effort begins between start and the next sample, where it is exactly the distance long
+			began := times[start]
+			if span := distances[start+1] - distances[start]; span > 0 {
+				fraction := (distances[end] - category.Distance - distances[start]) / span
+				began = began.Add(time.Duration(fraction * float64(times[start+1].Sub(times[start]))))
+			}
+			best = min(best, times[end].Sub(began).Seconds())
+		}
+
+		if !math.IsInf(best, 1) && best > 0 {
+			efforts[category.Name] = int(math.Round(best))
+		}
+	}
+
+	return efforts
+}
+
+// trackBestEfforts returns the best efforts along a GPX track. Points without a time still add
+// to the distance covered.
+func trackBestEfforts(points []models.TrackPoint) map[string]int {
+	var distances []float64
+	var times []time.Time
+
+	covered := 0.0
+	for i, p := range points {
+		if i > 0 {
+			covered += gpx.Distance(points[i-1].Latitude, points[i-1].Longitude, p.Latitude, p.Longitude) / 1000
+		}
+		if p.Time != nil {
+			distances = append(distances, covered)
+			times = append(times, *p.Time)
+		}
+	}
+
+	return bestEfforts(distances, times)
+}
+
+// recordBestEfforts returns the best efforts along the distance a device recorded
+func recordBestEfforts(records []models.SessionRecord) map[string]int {
+	var distances []float64
+	var times []time.Time
+
+	for _, r := range records {
+		if r.Distance != nil {
+			distances = append(distances, *r.Distance)
+			times = append(times, r.Time)
+		}
+	}
+
+	return bestEfforts(distances, times)
+}
+
+// insertBestEfforts stores the best efforts of an imported session
+func insertBestEfforts(tx *sqlTx, sessionID int64, efforts map[string]int) error {
+	for category, duration := range efforts {
+		_, err := tx.Exec(
+			`INSERT INTO session_best_efforts (session_id, category, duration) VALUES (?, ?, ?)`,
+			sessionID,
+			category,
+			duration,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getBestEfforts returns the stored best efforts of a user's sessions by session ID and category
+func (db *DB) getBestEfforts(userID int64) (map[int64]map[string]int, error) {
+	rows, err := db.conn.Query(`
+		SELECT e.session_id, e.category, e.duration
+		FROM session_best_efforts e
+		JOIN sessions s ON s.id = e.session_id
+		WHERE s.user_id = ?
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	efforts := make(map[int64]map[string]int)
+	for rows.Next() {
+		var sessionID int64
+		var category string
+		var duration int
+		if err := rows.Scan(&sessionID, &category, &duration); err != nil {
+			return nil, err
+		}
+		if efforts[sessionID] == nil {
+			efforts[sessionID] = make(map[string]int)
+		}
+		efforts[sessionID][category] = duration
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return efforts, nil
+}
+
+// backfillBestEfforts computes the best efforts of sessions imported before they were stored, then
+// refreshes the records of their users. Sessions whose recording yields no effort, such as a
+// track without times, are looked at again on every start.
+func (db *DB) backfillBestEfforts() error {
+	rows, err := db.conn.Query(`
+		SELECT s.id, s.user_id
+		FROM sessions s
+		WHERE s.distance >= ?
+			AND (EXISTS (SELECT 1 FROM track_points tp WHERE tp.session_id = s.id)
+				OR EXISTS (SELECT 1 FROM session_records r WHERE r.session_id = s.id))
+			AND NOT EXISTS (SELECT 1 FROM session_best_efforts e WHERE e.session_id = s.id)
+		ORDER BY s.id
+	`, recordCategories[0].Distance)
+	if err != nil {
+		return err
+	}
+
+	type pending struct{ sessionID, userID int64 }
+	var sessions []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.sessionID, &p.userID); err != nil {
+			rows.Close()
+			return err
+		}
+		sessions = append(sessions, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	users := make(map[int64]bool)
+	for _, p := range sessions {
+		records, err := db.GetSessionRecords(p.userID, int(p.sessionID))
+		if err != nil {
+			return err
+		}
+		efforts := recordBestEfforts(records)
+		if len(records) == 0 {
+			points, err := db.GetTrackPoints(p.userID, int(p.sessionID))
+			if err != nil {
+				return err
+			}
+			efforts = trackBestEfforts(points)
+		}
+		if len(efforts) == 0 {
+			continue
+		}
+
+		if err := db.inTx(func(tx *sqlTx) error { return insertBestEfforts(tx, p.sessionID, efforts) }); err != nil {
+			return err
+		}
+		users[p.userID] = true
+	}
+
+	for userID := range users {
+		if err := db.RefreshPersonalRecords(userID); err != nil {
+			return err
+		}
+	}
+
+	if len(users) > 0 {
+		log.Printf("[INFO] backfillBestEfforts: Refreshed personal records of %d users", len(users))
+	}
+	return nil
+}
+
+// personalRecordColumns is the column list selected for every record query, in scanPersonalRecord order
+const personalRecordColumns = `id, user_id, category, session_id, distance, duration, achieved_at, superseded_at`
+
+func scanPersonalRecord(row scanner) (*models.PersonalRecord, error) {
+	var record models.PersonalRecord
+	err := row.Scan(
+		&record.ID,
+		&record.UserID,
+		&record.Category,
+		&record.SessionID,
+		&record.Distance,
+		&record.Duration,
+		&record.AchievedAt,
+		&record.SupersededAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// computeRecordProgression replays sessions in date order and returns every record set along the way,
+// grouped by category in chronological order. Only strict improvements replace a record.
+// A session counts towards a distance with its best effort over it from efforts, keyed by session
+// ID and category, or without one when its own distance is within tolerance of the category's.
+func computeRecordProgression(sessions []models.Session, efforts map[int64]map[string]int) []models.PersonalRecord {
+	var progression []models.PersonalRecord
+
+	for _, category := range recordCategories {
+		var best float64
+		found := false
+
+		for _, s := range sessions {
+			if s.Distance <= 0 || s.Duration <= 0 {
+				continue
+			}
+
+			record := models.PersonalRecord{
+				UserID:     s.UserID,
+				Category:   category.Name,
+				SessionID:  s.ID,
+				AchievedAt: s.Date,
+			}
+
+			var score float64
+			if category.Distance == 0 {
+				// Longest run: higher is better, so compare on negated distance
+				score = -s.Distance
+				record.Distance = s.Distance
+				record.Duration = s.Duration
+			} else if effort, ok := efforts[s.ID][category.Name]; ok {
+				score = float64(effort)
+				record.Distance = category.Distance
+				record.Duration = effort
+			} else {
+				if math.Abs(s.Distance-category.Distance) > category.Distance*recordDistanceTolerance {
+					continue
+				}
+				score = float64(s.Duration) * category.Distance / s.Distance
+				record.Distance = category.Distance
+				record.Duration = int(math.Round(score))
+			}
+
+			if found && score >= best {
+				continue
+			}
+
+			if found {
+				supersededAt := s.Date
+				progression[len(progression)-1].SupersededAt = &supersededAt
+			}
+			progression = append(progression, record)
+			best = score
+			found = true
+		}
+	}
+
+	return progression
+}
+
+// RefreshPersonalRecords recomputes a user's records and their history from all of their sessions
+func (db *DB) RefreshPersonalRecords(userID int64) error {
+	sessions, err := db.getActiveSessions(userID)
+	if err != nil {
+		return err
+	}
+
+	efforts, err := db.getBestEfforts(userID)
+	if err != nil {
+		return err
+	}
+
+	progression := computeRecordProgression(sessions, efforts)
+
+	return db.inTx(func(tx *sqlTx) error {
+		if _, err := tx.Exec(`DELETE FROM personal_records WHERE user_id = ?`, userID); err != nil {
+			return err
+		}
+
+		for _, record := range progression {
+			_, err := tx.Exec(`
+				INSERT INTO personal_records (user_id, category, session_id, distance, duration, achieved_at, superseded_at)
+				VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				userID,
+				record.Category,
+				record.SessionID,
+				record.Distance,
+				record.Duration,
+				record.AchievedAt,
+				record.SupersededAt,
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetPersonalRecords returns the current record of every category with its session and history.
+// Records are computed on first access for users whose sessions predate record tracking.
+func (db *DB) GetPersonalRecords(userID int64) ([]models.PersonalRecordEntry, error) {
+	records, err := db.getPersonalRecordRows(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		if err := db.RefreshPersonalRecords(userID); err != nil {
+			return nil, err
+		}
+		if records, err = db.getPersonalRecordRows(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]models.PersonalRecordEntry, 0, len(recordCategories))
+	for _, category := range recordCategories {
+		entry := models.PersonalRecordEntry{
+			Category: category.Name,
+			History:  []models.PersonalRecord{},
+		}
+
+		for _, record := range records {
+			if record.Category != category.Name {
+				continue
+			}
+			if record.SupersededAt == nil {
+				current := record
+				entry.Record = &current
+			} else {
+				entry.History = append(entry.History, record)
+			}
+		}
+
+		if entry.Record != nil {
+			session, err := db.GetSession(userID, int(entry.Record.SessionID))
+			if err != nil && err != sql.ErrNoRows {
+				return nil, err
+			}
+			entry.Session = session
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// getPersonalRecordRows lists a user's stored records, newest first within each category
+func (db *DB) getPersonalRecordRows(userID int64) ([]models.PersonalRecord, error) {
+	query := `
+		SELECT ` + personalRecordColumns + `
+		FROM personal_records
+		WHERE user_id = ?
+		ORDER BY category, achieved_at DESC, id DESC
+	`
+
+	rows, err := db.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []models.PersonalRecord
+	for rows.Next() {
+		record, err := scanPersonalRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+func TestComputeRecordProgression(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2024, 1, d, 8, 0, 0, 0, time.UTC)
+	}
+
+	sessions := []models.Session{
+		{ID: 1, Date: day(1), Distance: 5, Duration: 1500},    // 5k in 25:00
+		{ID: 2, Date: day(2), Distance: 4.96, Duration: 1400}, // within GPS tolerance of 5k
+		{ID: 3, Date: day(3), Distance: 10, Duration: 2800},   // 4:40/km, but no faster 5k recorded
+		{ID: 4, Date: day(4), Distance: 3, Duration: 900},     // too short for a 5k
+		{ID: 5, Date: day(5), Distance: 21.1, Duration: 6000}, // half marathon with a recorded track
+		{ID: 6, Date: day(6), Distance: 5.5, Duration: 1200},  // too far over 5k without a track
+	}
+	efforts := map[int64]map[string]int{
+		5: {"1k": 250, "5k": 1300, "10k": 2700},
+	}
+
+	progression := computeRecordProgression(sessions, efforts)
+
+	byCategory := make(map[string][]models.PersonalRecord)
+	for _, r := range progression {
+		byCategory[r.Category] = append(byCategory[r.Category], r)
+	}
+
+	fiveK := byCategory["5k"]
+	if len(fiveK) != 3 {
+		t.Fatalf("Expected 3 5k records, got %d: %+v", len(fiveK), fiveK)
+	}
+	if fiveK[0].SessionID != 1 || fiveK[0].SupersededAt == nil || !fiveK[0].SupersededAt.Equal(day(2)) {
+		t.Errorf("Expected session 1 superseded on day 2, got %+v", fiveK[0])
+	}
+	if fiveK[1].SessionID != 2 || fiveK[1].Duration != 1411 || fiveK[1].Distance != 5 {
+		t.Errorf("Expected session 2 projected to a 5k of 1411s, got %+v", fiveK[1])
+	}
+	if fiveK[2].SessionID != 5 || fiveK[2].Duration != 1300 || fiveK[2].SupersededAt != nil {
+		t.Errorf("Expected the best effort of session 5 to hold the 5k record, got %+v", fiveK[2])
+	}
+
+	tenK := byCategory["10k"]
+	if len(tenK) != 2 || tenK[0].SessionID != 3 || tenK[0].Duration != 2800 || tenK[1].SessionID != 5 || tenK[1].Duration != 2700 {
+		t.Errorf("Expected session 3 then the best effort of session 5 as 10k records, got %+v", tenK)
+	}
+
+	if oneK := byCategory["1k"]; len(oneK) != 1 || oneK[0].SessionID != 5 || oneK[0].Duration != 250 {
+		t.Errorf("Expected only the 1k best effort of session 5, got %+v", oneK)
+	}
+
+	if half := byCategory["half_marathon"]; len(half) != 1 || half[0].SessionID != 5 || half[0].Duration != 5999 {
+		t.Errorf("Expected one half marathon record from session 5, got %+v", half)
+	}
+
+	if len(byCategory["marathon"]) != 0 {
+		t.Errorf("Expected no marathon record, got %+v", byCategory["marathon"])
+	}
+
+	longest := byCategory["longest_run"]
+	if len(longest) != 3 {
+		t.Fatalf("Expected 3 longest run records, got %d: %+v", len(longest), longest)
+	}
+	if current := longest[2]; current.SessionID != 5 || current.Distance != 21.1 || current.Duration != 6000 {
+		t.Errorf("Expected session 5 as longest run, got %+v", current)
+	}
+}
+
+func TestBestEfforts(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	// 6km sampled every 500m: 5:00/km, then 4:00/km from 2km to 3km, then 6:00/km
+	var distances []float64
+	var times []time.Time
+	elapsed := 0
+	for i := 0; i <= 12; i++ {
+		distance := float64(i) / 2
+		if i > 0 {
+			switch {
+			case distance <= 2:
+				elapsed += 150
+			case distance <= 3:
+				elapsed += 120
+			default:
+				elapsed += 180
+			}
+		}
+		distances = append(distances, distance)
+		times = append(times, start.Add(time.Duration(elapsed)*time.Second))
+	}
+
+	efforts := bestEfforts(distances, times)
+	if efforts["1k"] != 240 {
+		t.Errorf("Expected the fast kilometre as 1k best effort, got %ds", efforts["1k"])
+	}
+	// The best 5k runs from 0km: 2km at 5:00, 1km at 4:00 and 2km at 6:00
+	if efforts["5k"] != 1560 {
+		t.Errorf("Expected a 5k best effort of 1560s, got %ds", efforts["5k"])
+	}
+	if _, ok := efforts["10k"]; ok {
+		t.Errorf("Expected no 10k best effort from 6km, got %+v", efforts)
+	}
+
+	// A stretch starting between samples is interpolated
+	efforts = bestEfforts([]float64{0, 0.4, 1.4}, []time.Time{start, start.Add(200 * time.Second), start.Add(400 * time.Second)})
+	if efforts["1k"] != 200 {
+		t.Errorf("Expected an interpolated 1k of 200s, got %+v", efforts)
+	}
+}
+
+func TestTrackBestEfforts(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	// Points 0.001° of latitude apart are about 111m, so 20 points cover just over 2km
+	var points []models.TrackPoint
+	for i := 0; i < 20; i++ {
+		point := models.TrackPoint{Latitude: 52 + float64(i)*0.001, Longitude: 4}
+		if i%2 == 0 || i == 19 {
+			at := start.Add(time.Duration(i*30) * time.Second)
+			point.Time = &at
+		}
+		points = append(points, point)
+	}
+
+	efforts := trackBestEfforts(points)
+	if got := efforts["1k"]; got < 265 || got > 275 {
+		t.Errorf("Expected a 1k best effort of about 270s, got %+v", efforts)
+	}
+	if _, ok := efforts["5k"]; ok {
+		t.Errorf("Expected no 5k best effort from 2km, got %+v", efforts)
+	}
+}
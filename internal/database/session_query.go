@@ -0,0 +1,226 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor is malformed or belongs to another sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// sessionSortKeys maps the supported sort options to their SQL expressions
+var sessionSortKeys = map[string]string{
+	"date":     "date",
+	"distance": "distance",
+	"duration": "duration",
+	"pace":     "(duration / NULLIF(distance, 0))",
+}
+
+// sessionCursor marks the last row of a page; Value holds the sort key of that row
+type sessionCursor struct {
+	Sort  string          `json:"s"`
+	Order string          `json:"o"`
+	Value json.RawMessage `json:"v"`
+	ID    int64           `json:"id"`
+}
+
+// ListSessions returns one page of a user's sessions matching q, plus the cursor of the next page
+func (db *DB) ListSessions(userID int64, q models.SessionQuery) ([]models.Session, *string, error) {
+	sortExpr, ok := sessionSortKeys[q.Sort]
+	if !ok {
+		return nil, nil, errors.New("unsupported sort: " + q.Sort)
+	}
+
+	// Dates are compared as instants, not as text stored with differing offsets
+	date := db.dialect.utc("date")
+	if q.Sort == "date" {
+		sortExpr = date
+	}
+
+	conditions := []string{"user_id = ?", date + " >= ?", date + " <= ?", "deleted_at IS NULL"}
+	args := []any{userID, db.dialect.utcArg(q.StartDate), db.dialect.utcArg(q.EndDate)}
+
+	if q.Source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, q.Source)
+	}
+	if q.MinDistance != nil {
+		conditions = append(conditions, "distance >= ?")
+		args = append(args, *q.MinDistance)
+	}
+	if q.MaxDistance != nil {
+		conditions = append(conditions, "distance <= ?")
+		args = append(args, *q.MaxDistance)
+	}
+	if q.Search != "" {
+		conditions = append(conditions, `LOWER(notes) LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+escapeLike(strings.ToLower(q.Search))+"%")
+	}
+
+	cmp := "<"
+	direction := "DESC"
+	if q.Order == "asc" {
+		cmp = ">"
+		direction = "ASC"
+	}
+
+	order := sortExpr + " " + direction + ", id " + direction
+	if q.Sort == "pace" {
+		// Sessions without distance have no pace and come after every paced one, in either order
+		order = "(" + sortExpr + " IS NULL), " + order
+	}
+
+	if q.Cursor != "" {
+		value, id, err := decodeSessionCursor(q.Cursor, q.Sort, q.Order)
+		if err != nil {
+			return nil, nil, err
+		}
+		if t, ok := value.(time.Time); ok {
+			value = db.dialect.utcArg(t)
+		}
+
+		switch {
+		case value == nil:
+			conditions = append(conditions, "("+sortExpr+" IS NULL AND id "+cmp+" ?)")
+			args = append(args, id)
+		case q.Sort == "pace":
+			conditions = append(conditions, "("+sortExpr+" IS NULL OR "+sortExpr+" "+cmp+" ? OR ("+sortExpr+" = ? AND id "+cmp+" ?))")
+			args = append(args, value, value, id)
+		default:
+			conditions = append(conditions, "("+sortExpr+" "+cmp+" ? OR ("+sortExpr+" = ? AND id "+cmp+" ?))")
+			args = append(args, value, value, id)
+		}
+	}
+
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY ` + order + `
+		LIMIT ?
+	`
+	// Fetch one extra row to learn whether another page follows
+	args = append(args, q.Limit+1)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	if len(sessions) <= q.Limit {
+		return sessions, nil, nil
+	}
+
+	sessions = sessions[:q.Limit]
+	cursor, err := encodeSessionCursor(sessions[len(sessions)-1], q.Sort, q.Order)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sessions, &cursor, nil
+}
+
+// sortValue returns the sort key of a session as the cursor stores it; nil for the pace of a
+// session without distance
+func sortValue(s models.Session, sort string) any {
+	switch sort {
+	case "distance":
+		return s.Distance
+	case "duration":
+		return s.Duration
+	case "pace":
+		if s.Distance == 0 {
+			return nil
+		}
+		return float64(s.Duration) / s.Distance
+	default:
+		return s.Date.Format(time.RFC3339Nano)
+	}
+}
+
+func encodeSessionCursor(last models.Session, sort, order string) (string, error) {
+	value, err := json.Marshal(sortValue(last, sort))
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(sessionCursor{Sort: sort, Order: order, Value: value, ID: last.ID})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeSessionCursor returns the sort key and ID stored in a cursor, as query arguments. The
+// key is nil after a session without pace.
+func decodeSessionCursor(encoded, sort, order string) (any, int64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	var c sessionCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	if c.Sort != sort || c.Order != order {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	switch sort {
+	case "date":
+		var s string
+		if err := json.Unmarshal(c.Value, &s); err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return t, c.ID, nil
+	case "duration":
+		var d int
+		if err := json.Unmarshal(c.Value, &d); err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return d, c.ID, nil
+	default:
+		var f *float64
+		if err := json.Unmarshal(c.Value, &f); err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		if f == nil {
+			if sort != "pace" {
+				return nil, 0, ErrInvalidCursor
+			}
+			return nil, c.ID, nil
+		}
+		return *f, c.ID, nil
+	}
+}
+
+// escapeLike escapes LIKE wildcards so user input is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"net/url"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqlitePragmas are set on every embedded SQLite connection unless the URL sets them itself.
+// Background workers write concurrently with requests, so writers wait on each other's
+// locks instead of failing, and WAL lets reads proceed during a write.
+var sqlitePragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)"}
+
+// isSQLiteURL reports whether a database URL names a local SQLite file, as in
+// file:./runna.db, rather than a libsql server
+func isSQLiteURL(dbURL string) bool {
+	return strings.HasPrefix(dbURL, "file:")
+}
+
+// sqliteDSN adds the connection options the queries rely on to a file: URL. Times are
+// written in the layout libsql uses, so they compare and parse the same on both backends,
+// and transactions take the write lock up front so two of them can't deadlock upgrading
+// their read locks.
+func sqliteDSN(dbURL string) (string, error) {
+	path, rawQuery, _ := strings.Cut(dbURL, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", err
+	}
+
+	query.Set("_time_format", "sqlite")
+	if query.Get("_txlock") == "" {
+		query.Set("_txlock", "immediate")
+	}
+
+	for _, pragma := range sqlitePragmas {
+		name, _, _ := strings.Cut(pragma, "(")
+		set := false
+		for _, v := range query["_pragma"] {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(v)), name) {
+				set = true
+			}
+		}
+		if !set {
+			query.Add("_pragma", pragma)
+		}
+	}
+
+	return path + "?" + query.Encode(), nil
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		wantPath    string
+		wantPragmas []string
+		wantTxLock  string
+	}{
+		{"Defaults", "file:./runna.db", "file:./runna.db", []string{"busy_timeout(5000)", "journal_mode(WAL)"}, "immediate"},
+		{"Absolute path", "file:///var/lib/runna/runna.db", "file:///var/lib/runna/runna.db", []string{"busy_timeout(5000)", "journal_mode(WAL)"}, "immediate"},
+		{"Own pragma kept", "file:runna.db?_pragma=busy_timeout(100)", "file:runna.db", []string{"busy_timeout(100)", "journal_mode(WAL)"}, "immediate"},
+		{"Extra pragma", "file:runna.db?_pragma=foreign_keys(1)", "file:runna.db", []string{"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"}, "immediate"},
+		{"Own journal mode", "file:runna.db?_pragma=Journal_Mode(DELETE)", "file:runna.db", []string{"Journal_Mode(DELETE)", "busy_timeout(5000)"}, "immediate"},
+		{"Own tx lock", "file:runna.db?_txlock=deferred", "file:runna.db", []string{"busy_timeout(5000)", "journal_mode(WAL)"}, "deferred"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := sqliteDSN(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			path, rawQuery, _ := strings.Cut(dsn, "?")
+			if path != tt.wantPath {
+				t.Errorf("Expected path %q, got %q", tt.wantPath, path)
+			}
+
+			query, err := url.ParseQuery(rawQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(query["_pragma"], tt.wantPragmas) {
+				t.Errorf("Expected pragmas %v, got %v", tt.wantPragmas, query["_pragma"])
+			}
+			if got := query.Get("_txlock"); got != tt.wantTxLock {
+				t.Errorf("Expected _txlock %q, got %q", tt.wantTxLock, got)
+			}
+			if got := query.Get("_time_format"); got != "sqlite" {
+				t.Errorf("Expected the sqlite time format, got %q", got)
+			}
+		})
+	}
+}
+
+func TestSQLiteFile(t *testing.T) {
+	db, err := New("file:" + filepath.Join(t.TempDir(), "runna.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := db.Init(); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	user, err := db.CreateUser("runner@example.com", "Runner", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Times keep their instant and offset through RETURNING and later reads
+	date := time.Date(2024, 3, 1, 7, 30, 0, 0, time.FixedZone("CET", 3600))
+	created, err := db.CreateSession(user.ID, models.CreateSessionRequest{Date: date, Distance: 10, Duration: 3000})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	if created.ID == 0 || !created.Date.Equal(date) {
+		t.Errorf("Expected the created session to be returned, got %+v", created)
+	}
+
+	sessions, err := db.GetSessions(user.ID, date.Add(-time.Minute), date.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || !sessions[0].Date.Equal(date) {
+		t.Errorf("Expected the session within its date range, got %+v", sessions)
+	}
+
+	// datetime() comparisons see stored times in UTC
+	now := time.Now()
+	if _, err := db.EnqueueWebhookEvent(models.WebhookEvent{ObjectType: "activity", ObjectID: 1}, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if event, err := db.ClaimWebhookEvent(now.In(time.FixedZone("", -8*3600)), now.Add(-time.Hour)); err != nil || event != nil {
+		t.Errorf("Expected no event due yet, got %+v (%v)", event, err)
+	}
+	if event, err := db.ClaimWebhookEvent(now.Add(2*time.Hour), now.Add(-time.Hour)); err != nil || event == nil {
+		t.Errorf("Expected the event to be due, got %v", err)
+	}
+}
+
+func TestSQLiteSessionOffsetBackfill(t *testing.T) {
+	db := openSQLiteTestDB(t)
+
+	user, err := db.CreateUser("runner@example.com", "Runner", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Sessions stored before offsets had a column of their own get theirs from the stored text
+	if err := db.MigrateDown(1); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, 3, 1, 23, 30, 0, 0, time.FixedZone("", -5*3600))
+	var id int64
+	err = db.conn.QueryRow(`
+		INSERT INTO sessions (user_id, date, distance, duration, notes, source, created_at, updated_at)
+		VALUES (?, ?, 10, 3000, '', 'manual', ?, ?)
+		RETURNING id
+	`, user.ID, date, date, date).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := db.GetSession(user.ID, int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := session.Date.Zone(); offset != -5*3600 || !session.Date.Equal(date) {
+		t.Errorf("Expected %s, got %s", date, session.Date)
+	}
+}
@@ -0,0 +1,160 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// MaxSummaryBuckets bounds a summary so its bucket parameters stay under SQLite's bound parameter limit
+const MaxSummaryBuckets = 300
+
+// ErrTooManyBuckets is returned when a summary range spans more than MaxSummaryBuckets periods
+var ErrTooManyBuckets = fmt.Errorf("summary range spans more than %d periods", MaxSummaryBuckets)
+
+// sqlDateTimeLayout matches SQLite's datetime() output, which is always UTC
+const sqlDateTimeLayout = "2006-01-02 15:04:05"
+
+// summaryBucket is one period as local calendar days, with the UTC instants it covers
+type summaryBucket struct {
+	Start time.Time // inclusive, midnight in the query location
+	End   time.Time // exclusive, midnight of the next period
+}
+
+// periodStart truncates a day to the start of its week, month or year in the day's location
+func periodStart(period string, day time.Time, weekStart time.Weekday) (time.Time, error) {
+	y, m, d := day.Date()
+	switch period {
+	case "week":
+		offset := (int(day.Weekday()) - int(weekStart) + 7) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, day.Location()), nil
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, day.Location()), nil
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, day.Location()), nil
+	default:
+		return time.Time{}, errors.New("unsupported period: " + period)
+	}
+}
+
+// nextPeriod returns the start of the period after start. Calendar arithmetic keeps
+// boundaries on local midnight across daylight saving changes.
+func nextPeriod(period string, start time.Time) time.Time {
+	switch period {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(1, 0, 0)
+	}
+}
+
+// summaryBuckets lists the whole periods covering q.From through q.To
+func summaryBuckets(q models.SummaryQuery) ([]summaryBucket, error) {
+	loc := q.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	fy, fm, fd := q.From.Date()
+	ty, tm, td := q.To.Date()
+	from := time.Date(fy, fm, fd, 0, 0, 0, 0, loc)
+	last := time.Date(ty, tm, td, 0, 0, 0, 0, loc)
+
+	start, err := periodStart(q.Period, from, q.WeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var buckets []summaryBucket
+	for !start.After(last) {
+		if len(buckets) == MaxSummaryBuckets {
+			return nil, ErrTooManyBuckets
+		}
+		end := nextPeriod(q.Period, start)
+		buckets = append(buckets, summaryBucket{Start: start, End: end})
+		start = end
+	}
+
+	return buckets, nil
+}
+
+// GetSessionSummary aggregates a user's sessions per week, month or year. Bucket boundaries are
+// computed in the query's time zone and matched against session dates normalized to UTC.
+func (db *DB) GetSessionSummary(userID int64, q models.SummaryQuery) ([]models.SummaryBucket, error) {
+	buckets, err := summaryBuckets(q)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buckets) == 0 {
+		return []models.SummaryBucket{}, nil
+	}
+
+	values := make([]string, len(buckets))
+	args := make([]any, 0, len(buckets)*3+1)
+	for i, b := range buckets {
+		values[i] = "(?, " + db.dialect.utcParam() + ", " + db.dialect.utcParam() + ")"
+		args = append(args, b.Start.Format("2006-01-02"), db.dialect.utcArg(b.Start), db.dialect.utcArg(b.End))
+	}
+	args = append(args, userID)
+
+	query := `
+		WITH buckets (period_start, range_start, range_end) AS (
+			VALUES ` + strings.Join(values, ", ") + `
+		)
+		SELECT
+			b.period_start,
+			COALESCE(ROUND(CAST(SUM(s.distance) AS NUMERIC), 2), 0),
+			COALESCE(SUM(s.duration), 0),
+			COUNT(s.id),
+			CASE WHEN SUM(s.distance) > 0 THEN ROUND(CAST(SUM(s.duration) / SUM(s.distance) AS NUMERIC), 2) END,
+			COALESCE(MAX(s.distance), 0)
+		FROM buckets b
+		LEFT JOIN sessions s
+			ON s.user_id = ?
+			AND s.deleted_at IS NULL
+			AND ` + db.dialect.utc("s.date") + ` >= b.range_start
+			AND ` + db.dialect.utc("s.date") + ` < b.range_end
+		GROUP BY b.period_start
+		ORDER BY b.period_start
+	`
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := make([]models.SummaryBucket, 0, len(buckets))
+	for rows.Next() {
+		var bucket models.SummaryBucket
+		err := rows.Scan(
+			&bucket.PeriodStart,
+			&bucket.TotalDistance,
+			&bucket.TotalDuration,
+			&bucket.RunCount,
+			&bucket.AvgPace,
+			&bucket.LongestRun,
+		)
+		if err != nil {
+			return nil, err
+		}
+		summary = append(summary, bucket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Buckets come back in period order, so the inclusive end day can be filled in positionally
+	for i := range summary {
+		summary[i].PeriodEnd = buckets[i].End.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+
+	return summary, nil
+}
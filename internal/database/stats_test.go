@@ -0,0 +1,110 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+func TestSummaryBuckets(t *testing.T) {
+	copenhagen, err := time.LoadLocation("Europe/Copenhagen")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		query      models.SummaryQuery
+		wantStarts []string
+		wantFirst  string // UTC start of the first bucket
+		wantLast   string // UTC end of the last bucket
+	}{
+		{
+			name: "weeks start on monday across daylight saving",
+			query: models.SummaryQuery{
+				Period:    "week",
+				From:      time.Date(2024, 3, 27, 0, 0, 0, 0, copenhagen), // Wednesday
+				To:        time.Date(2024, 4, 1, 0, 0, 0, 0, copenhagen),
+				WeekStart: time.Monday,
+				Location:  copenhagen,
+			},
+			wantStarts: []string{"2024-03-25", "2024-04-01"},
+			wantFirst:  "2024-03-24 23:00:00",
+			wantLast:   "2024-04-07 22:00:00",
+		},
+		{
+			name: "weeks start on sunday",
+			query: models.SummaryQuery{
+				Period:    "week",
+				From:      time.Date(2024, 3, 30, 0, 0, 0, 0, time.UTC), // Saturday
+				To:        time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), // Sunday
+				WeekStart: time.Sunday,
+				Location:  time.UTC,
+			},
+			wantStarts: []string{"2024-03-24", "2024-03-31"},
+			wantFirst:  "2024-03-24 00:00:00",
+			wantLast:   "2024-04-07 00:00:00",
+		},
+		{
+			name: "months",
+			query: models.SummaryQuery{
+				Period:   "month",
+				From:     time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+				To:       time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+				Location: time.UTC,
+			},
+			wantStarts: []string{"2024-01-01", "2024-02-01", "2024-03-01"},
+			wantFirst:  "2024-01-01 00:00:00",
+			wantLast:   "2024-04-01 00:00:00",
+		},
+		{
+			name: "years",
+			query: models.SummaryQuery{
+				Period:   "year",
+				From:     time.Date(2023, 6, 1, 0, 0, 0, 0, copenhagen),
+				To:       time.Date(2024, 6, 1, 0, 0, 0, 0, copenhagen),
+				Location: copenhagen,
+			},
+			wantStarts: []string{"2023-01-01", "2024-01-01"},
+			wantFirst:  "2022-12-31 23:00:00",
+			wantLast:   "2024-12-31 23:00:00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets, err := summaryBuckets(tt.query)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(buckets) != len(tt.wantStarts) {
+				t.Fatalf("Expected %d buckets, got %d", len(tt.wantStarts), len(buckets))
+			}
+			for i, b := range buckets {
+				if got := b.Start.Format("2006-01-02"); got != tt.wantStarts[i] {
+					t.Errorf("Bucket %d: expected start %s, got %s", i, tt.wantStarts[i], got)
+				}
+			}
+
+			if got := buckets[0].Start.UTC().Format(sqlDateTimeLayout); got != tt.wantFirst {
+				t.Errorf("Expected first bucket to start at %s UTC, got %s", tt.wantFirst, got)
+			}
+			if got := buckets[len(buckets)-1].End.UTC().Format(sqlDateTimeLayout); got != tt.wantLast {
+				t.Errorf("Expected last bucket to end at %s UTC, got %s", tt.wantLast, got)
+			}
+		})
+	}
+}
+
+func TestSummaryBucketsLimit(t *testing.T) {
+	_, err := summaryBuckets(models.SummaryQuery{
+		Period: "week",
+		From:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	if err != ErrTooManyBuckets {
+		t.Fatalf("Expected ErrTooManyBuckets, got %v", err)
+	}
+}
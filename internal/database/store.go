@@ -0,0 +1,65 @@
+package database
+
+import (
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// SessionStore holds users' sessions with their tracks, laps and device records. Lookups of
+// a single missing session return sql.ErrNoRows.
+type SessionStore interface {
+	CreateSession(userID int64, req models.CreateSessionRequest) (*models.Session, error)
+	CreateSessions(userID int64, source string, reqs []models.CreateSessionRequest) ([]models.Session, error)
+	CreateSessionWithTrack(session models.Session, points []models.TrackPoint) (*models.Session, error)
+	CreateSessionWithRecords(session models.Session, laps []models.Lap, records []models.SessionRecord) (*models.Session, error)
+	GetSession(userID int64, id int) (*models.Session, error)
+	GetSessions(userID int64, startDate, endDate time.Time) ([]models.Session, error)
+	ListSessions(userID int64, q models.SessionQuery) ([]models.Session, *string, error)
+	FindSessionByStartTime(userID int64, start time.Time, tolerance time.Duration) (*models.Session, error)
+	UpdateSession(userID int64, id int, req models.CreateSessionRequest) (*models.Session, error)
+	SoftDeleteSession(userID int64, id int) error
+	RestoreSession(userID int64, id int) (*models.Session, error)
+	GetDeletedSessions(userID int64) ([]models.Session, error)
+	GetTrackPoints(userID int64, sessionID int) ([]models.TrackPoint, error)
+	GetLaps(userID int64, sessionID int) ([]models.Lap, error)
+	GetSessionRecords(userID int64, sessionID int) ([]models.SessionRecord, error)
+	MatchSession(session *models.Session) (*models.PlannedWorkout, error)
+}
+
+// GoalStore holds users' goals, evaluated against their sessions. Lookups of a missing goal
+// return sql.ErrNoRows.
+type GoalStore interface {
+	CreateGoal(userID int64, req models.CreateGoalRequest) (*models.Goal, error)
+	GetGoals(userID int64) ([]models.GoalProgress, error)
+	GetGoal(userID int64, id int) (*models.GoalProgress, error)
+	UpdateGoal(userID int64, id int, req models.CreateGoalRequest) (*models.Goal, error)
+	DeleteGoal(userID int64, id int) error
+	GetGoalSnapshots(userID int64, goalID int) ([]models.GoalSnapshot, error)
+	GetGoalPeriods(userID int64, goalID int) ([]models.GoalPeriod, error)
+}
+
+// StravaStore holds users' Strava connections with their sync state, and the sessions
+// imported from Strava activities. Lookups of a missing connection return nil, nil.
+type StravaStore interface {
+	CreateStravaConnection(conn models.StravaConnection) (*models.StravaConnection, error)
+	GetStravaConnection(userID int64) (*models.StravaConnection, error)
+	GetStravaConnectionByAthleteID(athleteID int64) (*models.StravaConnection, error)
+	UpdateStravaTokens(athleteID int64, accessToken, refreshToken string, expiresAt time.Time) error
+	DeleteStravaConnection(athleteID int64) error
+	StartStravaSync(userID int64, now, staleBefore time.Time) error
+	UpdateStravaSyncProgress(userID int64, fetched, imported int) error
+	PauseStravaSync(userID int64, resumeAt time.Time) error
+	FinishStravaSync(userID int64, syncedAt time.Time, syncErr error) error
+	CreateStravaSession(session models.Session) (*models.Session, error)
+	ImportStravaSessions(userID int64, sessions []models.Session) ([]models.Session, error)
+	GetSessionByStravaActivityID(userID, activityID int64) (*models.Session, error)
+	UpdateStravaSession(userID, activityID int64, session models.Session) (*models.Session, error)
+	DeleteSessionByStravaActivityID(userID, activityID int64) error
+}
+
+var (
+	_ SessionStore = (*DB)(nil)
+	_ GoalStore    = (*DB)(nil)
+	_ StravaStore  = (*DB)(nil)
+)
@@ -2,21 +2,54 @@ package database
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/thc/runna-backend/internal/models"
 )
 
+// stravaConnectionColumns is the column list selected for every connection query, in scanStravaConnection order
+const stravaConnectionColumns = `id, user_id, strava_athlete_id, access_token, refresh_token, token_expires_at, connected_at, last_sync,
+	sync_status, sync_started_at, sync_finished_at, sync_resume_at, sync_fetched, sync_imported, sync_error`
+
+// ErrSyncInProgress is returned when a Strava sync is started while another is running
+var ErrSyncInProgress = errors.New("strava sync already in progress")
+
+func scanStravaConnection(row scanner) (*models.StravaConnection, error) {
+	var conn models.StravaConnection
+	err := row.Scan(
+		&conn.ID,
+		&conn.UserID,
+		&conn.StravaAthleteID,
+		&conn.AccessToken,
+		&conn.RefreshToken,
+		&conn.TokenExpiresAt,
+		&conn.ConnectedAt,
+		&conn.LastSync,
+		&conn.Sync.Status,
+		&conn.Sync.StartedAt,
+		&conn.Sync.FinishedAt,
+		&conn.Sync.ResumeAt,
+		&conn.Sync.Fetched,
+		&conn.Sync.Imported,
+		&conn.Sync.Error,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &conn, nil
+}
+
 // CreateStravaConnection stores a new Strava connection
 func (db *DB) CreateStravaConnection(conn models.StravaConnection) (*models.StravaConnection, error) {
 	query := `
 		INSERT INTO strava_connections (user_id, strava_athlete_id, access_token, refresh_token, token_expires_at, connected_at)
 		VALUES (?, ?, ?, ?, ?, ?)
-		RETURNING id, user_id, strava_athlete_id, access_token, refresh_token, token_expires_at, connected_at, last_sync
-	`
+		RETURNING ` + stravaConnectionColumns
 
-	var result models.StravaConnection
-	err := db.conn.QueryRow(
+	return scanStravaConnection(db.conn.QueryRow(
 		query,
 		conn.UserID,
 		conn.StravaAthleteID,
@@ -24,71 +57,39 @@ func (db *DB) CreateStravaConnection(conn models.StravaConnection) (*models.Stra
 		conn.RefreshToken,
 		conn.TokenExpiresAt,
 		time.Now(),
-	).Scan(
-		&result.ID,
-		&result.UserID,
-		&result.StravaAthleteID,
-		&result.AccessToken,
-		&result.RefreshToken,
-		&result.TokenExpiresAt,
-		&result.ConnectedAt,
-		&result.LastSync,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	return &result, nil
+	))
 }
 
-// GetStravaConnectionByAthleteID retrieves a Strava connection by athlete ID
+// GetStravaConnectionByAthleteID retrieves a Strava connection by athlete ID.
+// Connections not yet claimed by a user are treated as missing.
 func (db *DB) GetStravaConnectionByAthleteID(athleteID int64) (*models.StravaConnection, error) {
 	query := `
-		SELECT id, user_id, strava_athlete_id, access_token, refresh_token, token_expires_at, connected_at, last_sync
+		SELECT ` + stravaConnectionColumns + `
 		FROM strava_connections
-		WHERE strava_athlete_id = ?
+		WHERE strava_athlete_id = ? AND user_id IS NOT NULL
 	`
 
-	var conn models.StravaConnection
-	err := db.conn.QueryRow(query, athleteID).Scan(
-		&conn.ID,
-		&conn.UserID,
-		&conn.StravaAthleteID,
-		&conn.AccessToken,
-		&conn.RefreshToken,
-		&conn.TokenExpiresAt,
-		&conn.ConnectedAt,
-		&conn.LastSync,
-	)
+	conn, err := scanStravaConnection(db.conn.QueryRow(query, athleteID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &conn, nil
+	return conn, nil
 }
 
-// GetStravaConnection retrieves the first Strava connection (for single-user MVP)
-func (db *DB) GetStravaConnection() (*models.StravaConnection, error) {
+// GetStravaConnection retrieves the user's Strava connection
+func (db *DB) GetStravaConnection(userID int64) (*models.StravaConnection, error) {
 	query := `
-		SELECT id, user_id, strava_athlete_id, access_token, refresh_token, token_expires_at, connected_at, last_sync
+		SELECT ` + stravaConnectionColumns + `
 		FROM strava_connections
-		LIMIT 1
+		WHERE user_id = ?
 	`
 
-	var conn models.StravaConnection
-	err := db.conn.QueryRow(query).Scan(
-		&conn.ID,
-		&conn.UserID,
-		&conn.StravaAthleteID,
-		&conn.AccessToken,
-		&conn.RefreshToken,
-		&conn.TokenExpiresAt,
-		&conn.ConnectedAt,
-		&conn.LastSync,
-	)
-
+	conn, err := scanStravaConnection(db.conn.QueryRow(query, userID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -97,7 +98,7 @@ func (db *DB) GetStravaConnection() (*models.StravaConnection, error) {
 		return nil, err
 	}
 
-	return &conn, nil
+	return conn, nil
 }
 
 // UpdateStravaTokens updates access and refresh tokens
@@ -112,6 +113,154 @@ func (db *DB) UpdateStravaTokens(athleteID int64, accessToken, refreshToken stri
 	return err
 }
 
+// RotateStravaTokens rewrites the stored tokens of every Strava connection with rotate, which
+// returns a token unchanged if it needs no rewriting. A connection whose tokens are refreshed
+// while it is rotated keeps the refreshed ones and is counted as skipped.
+// Returns how many connections were rewritten and skipped.
+func (db *DB) RotateStravaTokens(rotate func(token string) (string, error)) (int, int, error) {
+	type tokens struct {
+		id                    int64
+		access, refresh       string
+		newAccess, newRefresh string
+	}
+
+	rows, err := db.conn.Query(`SELECT id, access_token, refresh_token FROM strava_connections ORDER BY id`)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var conns []tokens
+	for rows.Next() {
+		var t tokens
+		if err := rows.Scan(&t.id, &t.access, &t.refresh); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		conns = append(conns, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	rotated, skipped := 0, 0
+	for _, t := range conns {
+		if t.newAccess, err = rotate(t.access); err != nil {
+			return rotated, skipped, fmt.Errorf("connection %d access token: %w", t.id, err)
+		}
+		if t.newRefresh, err = rotate(t.refresh); err != nil {
+			return rotated, skipped, fmt.Errorf("connection %d refresh token: %w", t.id, err)
+		}
+		if t.newAccess == t.access && t.newRefresh == t.refresh {
+			continue
+		}
+
+		// Only replace the tokens that were read, so a concurrent refresh is not undone
+		result, err := db.conn.Exec(`
+			UPDATE strava_connections
+			SET access_token = ?, refresh_token = ?
+			WHERE id = ? AND access_token = ? AND refresh_token = ?
+		`, t.newAccess, t.newRefresh, t.id, t.access, t.refresh)
+		if err != nil {
+			return rotated, skipped, err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return rotated, skipped, err
+		}
+		if n == 0 {
+			skipped++
+			continue
+		}
+		rotated++
+	}
+
+	return rotated, skipped, nil
+}
+
+// StartStravaSync marks the user's connection as syncing from now. A sync that has been running
+// since before staleBefore, or was due to resume from a rate limit pause before it, is assumed
+// to have died with its process and may be replaced.
+// Returns ErrSyncInProgress if another sync is running and sql.ErrNoRows without a connection.
+func (db *DB) StartStravaSync(userID int64, now, staleBefore time.Time) error {
+	result, err := db.conn.Exec(`
+		UPDATE strava_connections
+		SET sync_status = ?, sync_started_at = ?, sync_finished_at = NULL, sync_resume_at = NULL,
+			sync_fetched = 0, sync_imported = 0, sync_error = ''
+		WHERE user_id = ? AND (sync_status <> ? OR `+db.dialect.utc("COALESCE(sync_resume_at, sync_started_at)")+` < ?)
+	`,
+		models.StravaSyncRunning,
+		now,
+		userID,
+		models.StravaSyncRunning,
+		db.dialect.utcArg(staleBefore),
+	)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM strava_connections WHERE user_id = ?)`, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	return ErrSyncInProgress
+}
+
+// UpdateStravaSyncProgress records how far the user's running sync has got
+func (db *DB) UpdateStravaSyncProgress(userID int64, fetched, imported int) error {
+	query := `UPDATE strava_connections SET sync_fetched = ?, sync_imported = ? WHERE user_id = ?`
+	_, err := db.conn.Exec(query, fetched, imported, userID)
+	return err
+}
+
+// PauseStravaSync records that the user's running sync waits for Strava's rate limits to
+// reset until resumeAt
+func (db *DB) PauseStravaSync(userID int64, resumeAt time.Time) error {
+	query := `UPDATE strava_connections SET sync_resume_at = ? WHERE user_id = ?`
+	_, err := db.conn.Exec(query, resumeAt, userID)
+	return err
+}
+
+// FinishStravaSync ends the user's running sync. A successful sync moves last_sync to syncedAt,
+// the time the sync started; a failed one keeps it and records syncErr. Either way the data
+// derived from the user's sessions is refreshed if the sync imported any.
+func (db *DB) FinishStravaSync(userID int64, syncedAt time.Time, syncErr error) error {
+	var imported int
+	var err error
+	if syncErr != nil {
+		query := `UPDATE strava_connections SET sync_status = ?, sync_finished_at = ?, sync_resume_at = NULL, sync_error = ? WHERE user_id = ? RETURNING sync_imported`
+		err = db.conn.QueryRow(query, models.StravaSyncFailed, time.Now(), syncErr.Error(), userID).Scan(&imported)
+	} else {
+		query := `UPDATE strava_connections SET sync_status = ?, sync_finished_at = ?, sync_resume_at = NULL, last_sync = ? WHERE user_id = ? RETURNING sync_imported`
+		err = db.conn.QueryRow(query, models.StravaSyncCompleted, time.Now(), syncedAt, userID).Scan(&imported)
+	}
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if imported > 0 {
+		db.sessionsChanged(userID, nil)
+	}
+	return nil
+}
+
 // DeleteStravaConnection removes a Strava connection
 func (db *DB) DeleteStravaConnection(athleteID int64) error {
 	query := `DELETE FROM strava_connections WHERE strava_athlete_id = ?`
@@ -119,66 +268,87 @@ func (db *DB) DeleteStravaConnection(athleteID int64) error {
 	return err
 }
 
-// CreateStravaSession creates a session from Strava activity
+// CreateStravaSession creates a session from Strava activity for session.UserID. Returns nil, nil
+// if a session for the activity already exists, including one in the trash.
 func (db *DB) CreateStravaSession(session models.Session) (*models.Session, error) {
+	var created *models.Session
+	err := db.inTx(func(tx *sqlTx) error {
+		s, err := insertStravaSession(tx, session)
+		created = s
+		return err
+	})
+	if err != nil || created == nil {
+		return nil, err
+	}
+
+	db.sessionsChanged(session.UserID, []int64{created.ID})
+	return created, nil
+}
+
+// ImportStravaSessions creates the sessions of a page of a user's Strava activities in one
+// transaction, skipping activities that already have a session, and returns the ones created.
+// Unlike CreateStravaSession it leaves refreshing the data derived from the user's sessions to
+// FinishStravaSync, so a backfill does it once.
+func (db *DB) ImportStravaSessions(userID int64, sessions []models.Session) ([]models.Session, error) {
+	var created []models.Session
+	err := db.inTx(func(tx *sqlTx) error {
+		for _, session := range sessions {
+			session.UserID = userID
+			s, err := insertStravaSession(tx, session)
+			if err != nil {
+				return err
+			}
+			if s != nil {
+				created = append(created, *s)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// insertStravaSession inserts a session from Strava activity, returning nil if the activity
+// already has one
+func insertStravaSession(tx *sqlTx, session models.Session) (*models.Session, error) {
 	query := `
-		INSERT INTO sessions (date, distance, duration, notes, strava_activity_id, source, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, 'strava', ?, ?)
-		RETURNING id, date, distance, duration, notes, strava_activity_id, source, created_at, updated_at
-	`
+		INSERT INTO sessions (user_id, date, utc_offset, distance, duration, notes, strava_activity_id, source, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 'strava', ?, ?)
+		ON CONFLICT(strava_activity_id) DO NOTHING
+		RETURNING ` + sessionColumns
 
 	now := time.Now()
-	var result models.Session
-
-	err := db.conn.QueryRow(
+	created, err := scanSession(tx.QueryRow(
 		query,
+		session.UserID,
 		session.Date,
+		utcOffset(session.Date),
 		session.Distance,
 		session.Duration,
 		session.Notes,
 		session.StravaActivityID,
 		now,
 		now,
-	).Scan(
-		&result.ID,
-		&result.Date,
-		&result.Distance,
-		&result.Duration,
-		&result.Notes,
-		&result.StravaActivityID,
-		&result.Source,
-		&result.CreatedAt,
-		&result.UpdatedAt,
-	)
-
-	if err != nil {
-		return nil, err
+	))
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
 
-	return &result, nil
+	return created, err
 }
 
-// GetSessionByStravaActivityID retrieves a session by Strava activity ID
-func (db *DB) GetSessionByStravaActivityID(activityID int64) (*models.Session, error) {
+// GetSessionByStravaActivityID retrieves a user's session by Strava activity ID
+func (db *DB) GetSessionByStravaActivityID(userID, activityID int64) (*models.Session, error) {
 	query := `
-		SELECT id, date, distance, duration, notes, strava_activity_id, source, created_at, updated_at
+		SELECT ` + sessionColumns + `
 		FROM sessions
-		WHERE strava_activity_id = ?
+		WHERE strava_activity_id = ? AND user_id = ?
 	`
 
-	var session models.Session
-	err := db.conn.QueryRow(query, activityID).Scan(
-		&session.ID,
-		&session.Date,
-		&session.Distance,
-		&session.Duration,
-		&session.Notes,
-		&session.StravaActivityID,
-		&session.Source,
-		&session.CreatedAt,
-		&session.UpdatedAt,
-	)
-
+	session, err := scanSession(db.conn.QueryRow(query, activityID, userID))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -187,51 +357,59 @@ func (db *DB) GetSessionByStravaActivityID(activityID int64) (*models.Session, e
 		return nil, err
 	}
 
-	return &session, nil
+	return session, nil
 }
 
-// UpdateStravaSession updates a session from Strava activity
-func (db *DB) UpdateStravaSession(activityID int64, session models.Session) (*models.Session, error) {
+// UpdateStravaSession updates a user's session from Strava activity
+func (db *DB) UpdateStravaSession(userID, activityID int64, session models.Session) (*models.Session, error) {
 	query := `
 		UPDATE sessions
-		SET date = ?, distance = ?, duration = ?, notes = ?, updated_at = ?
-		WHERE strava_activity_id = ?
-		RETURNING id, date, distance, duration, notes, strava_activity_id, source, created_at, updated_at
-	`
+		SET date = ?, utc_offset = ?, distance = ?, duration = ?, notes = ?, updated_at = ?
+		WHERE strava_activity_id = ? AND user_id = ?
+		RETURNING ` + sessionColumns
 
-	now := time.Now()
-	var result models.Session
-
-	err := db.conn.QueryRow(
+	updated, err := scanSession(db.conn.QueryRow(
 		query,
 		session.Date,
+		utcOffset(session.Date),
 		session.Distance,
 		session.Duration,
 		session.Notes,
-		now,
+		time.Now(),
 		activityID,
-	).Scan(
-		&result.ID,
-		&result.Date,
-		&result.Distance,
-		&result.Duration,
-		&result.Notes,
-		&result.StravaActivityID,
-		&result.Source,
-		&result.CreatedAt,
-		&result.UpdatedAt,
-	)
-
+		userID,
+	))
 	if err != nil {
 		return nil, err
 	}
 
-	return &result, nil
+	db.sessionsChanged(userID, []int64{updated.ID})
+	return updated, nil
 }
 
-// DeleteSessionByStravaActivityID deletes a session by Strava activity ID
-func (db *DB) DeleteSessionByStravaActivityID(activityID int64) error {
-	query := `DELETE FROM sessions WHERE strava_activity_id = ?`
-	_, err := db.conn.Exec(query, activityID)
-	return err
+// DeleteSessionByStravaActivityID deletes a user's session by Strava activity ID
+func (db *DB) DeleteSessionByStravaActivityID(userID, activityID int64) error {
+	var id int64
+	err := db.inTx(func(tx *sqlTx) error {
+		err := tx.QueryRow(`SELECT id FROM sessions WHERE strava_activity_id = ? AND user_id = ?`, activityID, userID).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		if err := deleteChildRows(tx, sessionChildTables, "session_id", "?", id); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`DELETE FROM sessions WHERE id = ?`, id)
+		return err
+	})
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	db.sessionsChanged(userID, []int64{id})
+	return nil
 }
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"strings"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// trackPointBatchSize keeps multi-row inserts well under SQLite's bound parameter limit
+const trackPointBatchSize = 100
+
+// CreateSessionWithTrack creates an imported session and its track points in one transaction.
+// The session's Source identifies the import format.
+func (db *DB) CreateSessionWithTrack(session models.Session, points []models.TrackPoint) (*models.Session, error) {
+	var created *models.Session
+
+	err := db.inTx(func(tx *sqlTx) error {
+		s, err := insertImportedSession(tx, session)
+		if err != nil {
+			return err
+		}
+		created = s
+
+		if err := insertTrackPoints(tx, created.ID, points); err != nil {
+			return err
+		}
+		return insertBestEfforts(tx, created.ID, trackBestEfforts(points))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	db.sessionsChanged(created.UserID, []int64{created.ID})
+	return created, nil
+}
+
+// insertImportedSession inserts a session built by a file importer
+func insertImportedSession(tx *sqlTx, session models.Session) (*models.Session, error) {
+	query := `
+		INSERT INTO sessions (user_id, date, utc_offset, distance, duration, notes, elevation_gain, avg_heart_rate, max_heart_rate, source, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING ` + sessionColumns
+
+	now := time.Now()
+	return scanSession(tx.QueryRow(
+		query,
+		session.UserID,
+		session.Date,
+		utcOffset(session.Date),
+		session.Distance,
+		session.Duration,
+		session.Notes,
+		session.ElevationGain,
+		session.AvgHeartRate,
+		session.MaxHeartRate,
+		session.Source,
+		now,
+		now,
+	))
+}
+
+// insertTrackPoints writes points in batches, numbering them in slice order
+func insertTrackPoints(tx *sqlTx, sessionID int64, points []models.TrackPoint) error {
+	for start := 0; start < len(points); start += trackPointBatchSize {
+		end := min(start+trackPointBatchSize, len(points))
+		batch := points[start:end]
+
+		placeholders := make([]string, len(batch))
+		args := make([]any, 0, len(batch)*6)
+		for i, p := range batch {
+			placeholders[i] = "(?, ?, ?, ?, ?, ?)"
+			args = append(args, sessionID, start+i, p.Latitude, p.Longitude, p.Elevation, p.Time)
+		}
+
+		query := `INSERT INTO track_points (session_id, seq, latitude, longitude, elevation, time) VALUES ` +
+			strings.Join(placeholders, ", ")
+		if _, err := tx.Exec(query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetTrackPoints retrieves the ordered track of a user's session
+func (db *DB) GetTrackPoints(userID int64, sessionID int) ([]models.TrackPoint, error) {
+	query := `
+		SELECT tp.latitude, tp.longitude, tp.elevation, tp.time
+		FROM track_points tp
+		JOIN sessions s ON s.id = tp.session_id
+		WHERE tp.session_id = ? AND s.user_id = ?
+		ORDER BY tp.seq
+	`
+
+	rows, err := db.conn.Query(query, sessionID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var points []models.TrackPoint
+	for rows.Next() {
+		var p models.TrackPoint
+		if err := rows.Scan(&p.Latitude, &p.Longitude, &p.Elevation, &p.Time); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return points, nil
+}
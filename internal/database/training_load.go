@@ -0,0 +1,553 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+	"github.com/thc/runna-backend/internal/predictions"
+)
+
+const (
+	// atlDays and ctlDays are the time constants of acute (fatigue) and chronic (fitness) load
+	atlDays = 7
+	ctlDays = 42
+
+	// restingHeartRate and defaultMaxHeartRate stand in for values users can't set yet
+	restingHeartRate    = 60
+	defaultMaxHeartRate = 190
+	// thresholdHeartRateReserve is the share of heart rate reserve reached at threshold effort
+	thresholdHeartRateReserve = 0.85
+
+	// defaultThresholdPace is used until the user has a run long enough to estimate it, in seconds per km
+	defaultThresholdPace = 330
+	// thresholdMinDuration is the shortest run, in seconds, trusted to estimate threshold pace
+	thresholdMinDuration = 900
+	// estimatedIntensity is assumed for sessions without pace or heart rate
+	estimatedIntensity = 0.7
+
+	// MaxTrainingLoadDays bounds the range of a training load request
+	MaxTrainingLoadDays = 730
+)
+
+// ErrTooManyDays is returned when a training load range spans more than MaxTrainingLoadDays
+var ErrTooManyDays = errors.New("range spans too many days")
+
+// stressParams are the user's reference points for turning a session into stress
+type stressParams struct {
+	ThresholdPace float64 // seconds per km
+	MaxHeartRate  int
+}
+
+// thresholdEvidence is what a user's threshold is estimated from: the pace they could hold for
+// an hour, projected from their best run of at least thresholdMinDuration, and the highest
+// heart rate they recorded, each with the session it came from
+type thresholdEvidence struct {
+	HourPace              float64 // seconds per km, 0 without a long enough run
+	HourPaceSessionID     int64
+	MaxHeartRate          int
+	MaxHeartRateSessionID int64
+}
+
+// add takes a session into account
+func (e *thresholdEvidence) add(s models.Session) {
+	if s.MaxHeartRate != nil && *s.MaxHeartRate > e.MaxHeartRate {
+		e.MaxHeartRate = *s.MaxHeartRate
+		e.MaxHeartRateSessionID = s.ID
+	}
+
+	if s.Distance <= 0 || s.Duration < thresholdMinDuration {
+		return
+	}
+	hourDistance := s.Distance * math.Pow(3600/float64(s.Duration), 1/predictions.RiegelExponent)
+	if pace := 3600 / hourDistance; e.HourPace == 0 || pace < e.HourPace {
+		e.HourPace = pace
+		e.HourPaceSessionID = s.ID
+	}
+}
+
+// comesFrom reports whether the evidence was taken from the session
+func (e thresholdEvidence) comesFrom(sessionID int64) bool {
+	return sessionID == e.HourPaceSessionID || sessionID == e.MaxHeartRateSessionID
+}
+
+// params turns the evidence into stress parameters, using defaults where it is missing
+func (e thresholdEvidence) params() stressParams {
+	params := stressParams{ThresholdPace: defaultThresholdPace, MaxHeartRate: defaultMaxHeartRate}
+
+	if e.HourPace > 0 {
+		params.ThresholdPace = round2(e.HourPace)
+	}
+	if e.MaxHeartRate > restingHeartRate {
+		params.MaxHeartRate = e.MaxHeartRate
+	}
+
+	return params
+}
+
+// stressParamsFor estimates the user's threshold from their sessions
+func stressParamsFor(sessions []models.Session) stressParams {
+	var evidence thresholdEvidence
+	for _, s := range sessions {
+		evidence.add(s)
+	}
+	return evidence.params()
+}
+
+// sessionStress scores a session as hours * intensity² * 100. Intensity comes from heart rate
+// reserve when the session has an average heart rate, otherwise from pace against threshold pace.
+func sessionStress(s models.Session, params stressParams) models.SessionStress {
+	stress := models.SessionStress{
+		SessionID: s.ID,
+		Date:      sessionDay(s),
+		Intensity: estimatedIntensity,
+		Method:    models.StressMethodEstimated,
+	}
+
+	switch {
+	case s.AvgHeartRate != nil && *s.AvgHeartRate > restingHeartRate:
+		reserve := float64(*s.AvgHeartRate-restingHeartRate) / float64(params.MaxHeartRate-restingHeartRate)
+		stress.Intensity = reserve / thresholdHeartRateReserve
+		stress.Method = models.StressMethodHeartRate
+	case s.Distance > 0 && s.Duration > 0:
+		stress.Intensity = params.ThresholdPace / (float64(s.Duration) / s.Distance)
+		stress.Method = models.StressMethodPace
+	}
+
+	hours := float64(s.Duration) / 3600
+	stress.Stress = round2(hours * stress.Intensity * stress.Intensity * 100)
+	stress.Intensity = round2(stress.Intensity)
+
+	return stress
+}
+
+// buildLoadSeries advances the load day by day from the state seed left before from, through
+// to, using the stress of each day (zero for days without sessions)
+func buildLoadSeries(seed models.TrainingLoadDay, from, to time.Time, stressByDay map[string]float64) []models.TrainingLoadDay {
+	var series []models.TrainingLoadDay
+
+	prev := seed
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		stress := stressByDay[date]
+		day := models.TrainingLoadDay{
+			Date:   date,
+			Stress: stress,
+			ATL:    prev.ATL + (stress-prev.ATL)/atlDays,
+			CTL:    prev.CTL + (stress-prev.CTL)/ctlDays,
+			TSB:    prev.CTL - prev.ATL,
+		}
+		series = append(series, day)
+		prev = day
+	}
+
+	return series
+}
+
+// loadDayColumns is the column list selected for every training load query, in scanLoadDay order
+const loadDayColumns = `day, stress, atl, ctl, tsb`
+
+func scanLoadDay(row scanner) (*models.TrainingLoadDay, error) {
+	var day models.TrainingLoadDay
+	if err := row.Scan(&day.Date, &day.Stress, &day.ATL, &day.CTL, &day.TSB); err != nil {
+		return nil, err
+	}
+
+	return &day, nil
+}
+
+// maxIncrementalSessions is the most changed sessions rescored on their own; larger changes
+// rescore every session in one pass
+const maxIncrementalSessions = 500
+
+// RefreshTrainingLoad brings a user's session stress and daily load up to date with all of their sessions
+func (db *DB) RefreshTrainingLoad(userID int64) error {
+	return db.refreshTrainingLoad(userID, nil)
+}
+
+// refreshTrainingLoad brings a user's session stress and daily load up to date after the sessions
+// with the given IDs were created, edited or deleted. Only those sessions are rescored, unless
+// they change the user's threshold and with it the stress of every session, or sessionIDs is
+// nil. Only the days from the earliest changed session on are recomputed.
+func (db *DB) refreshTrainingLoad(userID int64, sessionIDs []int64) error {
+	stored, err := db.getThresholdEvidence(userID)
+	if err != nil {
+		return err
+	}
+
+	incremental := sessionIDs != nil && stored != nil && len(sessionIDs) <= maxIncrementalSessions
+
+	var sessions []models.Session
+	var evidence thresholdEvidence
+	if incremental {
+		if sessions, err = db.getActiveSessionsByID(userID, sessionIDs); err != nil {
+			return err
+		}
+
+		evidence = *stored
+		for _, id := range sessionIDs {
+			if stored.comesFrom(id) {
+				// The session may no longer support the threshold, which only a full pass can tell
+				incremental = false
+			}
+		}
+		for _, s := range sessions {
+			evidence.add(s)
+		}
+		if evidence.params() != stored.params() {
+			incremental = false
+		}
+	}
+
+	if !incremental {
+		if sessions, err = db.getActiveSessions(userID); err != nil {
+			return err
+		}
+
+		evidence = thresholdEvidence{}
+		for _, s := range sessions {
+			evidence.add(s)
+		}
+		sessionIDs = nil
+	}
+
+	params := evidence.params()
+	current := make(map[int64]models.SessionStress, len(sessions))
+	for _, s := range sessions {
+		current[s.ID] = sessionStress(s, params)
+	}
+
+	previous, err := db.getSessionStress(userID, sessionIDs)
+	if err != nil {
+		return err
+	}
+
+	// Find the earliest day whose stress changed and the rows that need writing
+	earliest := ""
+	touch := func(day string) {
+		if earliest == "" || day < earliest {
+			earliest = day
+		}
+	}
+
+	var changed []models.SessionStress
+	for id, s := range current {
+		if old, ok := previous[id]; !ok || old != s {
+			changed = append(changed, s)
+			touch(s.Date)
+			if ok {
+				touch(old.Date)
+			}
+		}
+	}
+
+	var removed []int64
+	for id, s := range previous {
+		if _, ok := current[id]; !ok {
+			removed = append(removed, id)
+			touch(s.Date)
+		}
+	}
+
+	evidenceChanged := stored == nil || *stored != evidence
+	if earliest == "" && !evidenceChanged {
+		return nil
+	}
+
+	return db.inTx(func(tx *sqlTx) error {
+		for _, id := range removed {
+			if _, err := tx.Exec(`DELETE FROM session_stress WHERE session_id = ?`, id); err != nil {
+				return err
+			}
+		}
+
+		for _, s := range changed {
+			_, err := tx.Exec(`
+				INSERT INTO session_stress (session_id, user_id, day, stress, intensity, method)
+				VALUES (?, ?, ?, ?, ?, ?)
+				ON CONFLICT(session_id) DO UPDATE SET
+					day = excluded.day, stress = excluded.stress, intensity = excluded.intensity, method = excluded.method
+			`, s.SessionID, userID, s.Date, s.Stress, s.Intensity, s.Method)
+			if err != nil {
+				return err
+			}
+		}
+
+		if evidenceChanged {
+			_, err := tx.Exec(`
+				INSERT INTO training_thresholds (user_id, hour_pace, hour_pace_session_id, max_heart_rate, max_heart_rate_session_id)
+				VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT(user_id) DO UPDATE SET
+					hour_pace = excluded.hour_pace, hour_pace_session_id = excluded.hour_pace_session_id,
+					max_heart_rate = excluded.max_heart_rate, max_heart_rate_session_id = excluded.max_heart_rate_session_id
+			`, userID, evidence.HourPace, evidence.HourPaceSessionID, evidence.MaxHeartRate, evidence.MaxHeartRateSessionID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if earliest == "" {
+			return nil
+		}
+		return rebuildTrainingLoad(tx, userID, earliest)
+	})
+}
+
+// rebuildTrainingLoad recomputes a user's daily load from the earliest changed day on, out of
+// their stored session stress
+func rebuildTrainingLoad(tx *sqlTx, userID int64, earliest string) error {
+	var firstDay, lastDay sql.NullString
+	if err := tx.QueryRow(`SELECT MIN(day), MAX(day) FROM session_stress WHERE user_id = ?`, userID).Scan(&firstDay, &lastDay); err != nil {
+		return err
+	}
+
+	// Days before the change keep their load; the last of them seeds the recomputation
+	seed, err := scanLoadDay(tx.QueryRow(`
+		SELECT `+loadDayColumns+`
+		FROM training_load
+		WHERE user_id = ? AND day < ?
+		ORDER BY day DESC
+		LIMIT 1
+	`, userID, earliest))
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	from := firstDay.String
+	if seed != nil {
+		from = nextDay(seed.Date)
+	} else {
+		seed = &models.TrainingLoadDay{}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM training_load WHERE user_id = ? AND day >= ?`, userID, min(from, earliest)); err != nil {
+		return err
+	}
+
+	if !lastDay.Valid {
+		return nil
+	}
+
+	// Deleting the last sessions leaves days that no longer lead up to one
+	if _, err := tx.Exec(`DELETE FROM training_load WHERE user_id = ? AND day > ?`, userID, lastDay.String); err != nil {
+		return err
+	}
+
+	if from > lastDay.String {
+		return nil
+	}
+
+	rows, err := tx.Query(`
+		SELECT day, SUM(stress)
+		FROM session_stress
+		WHERE user_id = ? AND day >= ?
+		GROUP BY day
+	`, userID, from)
+	if err != nil {
+		return err
+	}
+
+	stressByDay := make(map[string]float64)
+	for rows.Next() {
+		var day string
+		var stress float64
+		if err := rows.Scan(&day, &stress); err != nil {
+			rows.Close()
+			return err
+		}
+		stressByDay[day] = stress
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	start, _ := time.Parse("2006-01-02", from)
+	end, _ := time.Parse("2006-01-02", lastDay.String)
+	for _, day := range buildLoadSeries(*seed, start, end, stressByDay) {
+		_, err := tx.Exec(
+			`INSERT INTO training_load (user_id, day, stress, atl, ctl, tsb) VALUES (?, ?, ?, ?, ?, ?)`,
+			userID, day.Date, day.Stress, day.ATL, day.CTL, day.TSB,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getThresholdEvidence returns what a user's threshold was last estimated from, or nil if it
+// hasn't been yet
+func (db *DB) getThresholdEvidence(userID int64) (*thresholdEvidence, error) {
+	var e thresholdEvidence
+	var hourPaceSessionID, maxHeartRateSessionID sql.NullInt64
+	err := db.conn.QueryRow(`
+		SELECT hour_pace, hour_pace_session_id, max_heart_rate, max_heart_rate_session_id
+		FROM training_thresholds
+		WHERE user_id = ?
+	`, userID).Scan(&e.HourPace, &hourPaceSessionID, &e.MaxHeartRate, &maxHeartRateSessionID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.HourPaceSessionID = hourPaceSessionID.Int64
+	e.MaxHeartRateSessionID = maxHeartRateSessionID.Int64
+	return &e, nil
+}
+
+// getSessionStress returns the stored stress of a user's sessions with the given IDs, or of all
+// of them when ids is nil, keyed by session ID
+func (db *DB) getSessionStress(userID int64, ids []int64) (map[int64]models.SessionStress, error) {
+	query := `SELECT session_id, day, stress, intensity, method FROM session_stress WHERE user_id = ?`
+	args := []any{userID}
+	if ids != nil {
+		in, idArgs := inList(ids)
+		query += ` AND session_id IN (` + in + `)`
+		args = append(args, idArgs...)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stress := make(map[int64]models.SessionStress)
+	for rows.Next() {
+		var s models.SessionStress
+		if err := rows.Scan(&s.SessionID, &s.Date, &s.Stress, &s.Intensity, &s.Method); err != nil {
+			return nil, err
+		}
+		stress[s.SessionID] = s
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stress, nil
+}
+
+// nextDay returns the day after a YYYY-MM-DD date
+func nextDay(date string) string {
+	d, _ := time.Parse("2006-01-02", date)
+	return d.AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+// GetTrainingLoad returns a user's daily load and session stress between two days, inclusive.
+// Days after the last session carry on decaying the load. Returns ErrTooManyDays when the
+// range is longer than MaxTrainingLoadDays.
+func (db *DB) GetTrainingLoad(userID int64, from, to time.Time) (*models.TrainingLoad, error) {
+	if int(to.Sub(from).Hours()/24)+1 > MaxTrainingLoadDays {
+		return nil, ErrTooManyDays
+	}
+
+	// Load computed before this feature existed is filled in on first use
+	var exists bool
+	if err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM session_stress WHERE user_id = ?)`, userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := db.RefreshTrainingLoad(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	fromDay := from.Format("2006-01-02")
+	toDay := to.Format("2006-01-02")
+
+	seed, err := scanLoadDay(db.conn.QueryRow(`
+		SELECT `+loadDayColumns+`
+		FROM training_load
+		WHERE user_id = ? AND day < ?
+		ORDER BY day DESC
+		LIMIT 1
+	`, userID, fromDay))
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	start := from
+	if seed != nil {
+		start, _ = time.Parse("2006-01-02", nextDay(seed.Date))
+	} else {
+		seed = &models.TrainingLoadDay{}
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT day, stress
+		FROM training_load
+		WHERE user_id = ? AND day >= ? AND day <= ?
+	`, userID, start.Format("2006-01-02"), toDay)
+	if err != nil {
+		return nil, err
+	}
+
+	stressByDay := make(map[string]float64)
+	for rows.Next() {
+		var day string
+		var stress float64
+		if err := rows.Scan(&day, &stress); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stressByDay[day] = stress
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	load := &models.TrainingLoad{
+		From:     fromDay,
+		To:       toDay,
+		Days:     []models.TrainingLoadDay{},
+		Sessions: []models.SessionStress{},
+	}
+
+	for _, day := range buildLoadSeries(*seed, start, to, stressByDay) {
+		if day.Date < fromDay {
+			continue
+		}
+		load.Days = append(load.Days, models.TrainingLoadDay{
+			Date:   day.Date,
+			Stress: round2(day.Stress),
+			ATL:    round2(day.ATL),
+			CTL:    round2(day.CTL),
+			TSB:    round2(day.TSB),
+		})
+	}
+
+	rows, err = db.conn.Query(`
+		SELECT session_id, day, stress, intensity, method
+		FROM session_stress
+		WHERE user_id = ? AND day >= ? AND day <= ?
+		ORDER BY day, session_id
+	`, userID, fromDay, toDay)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var s models.SessionStress
+		if err := rows.Scan(&s.SessionID, &s.Date, &s.Stress, &s.Intensity, &s.Method); err != nil {
+			return nil, err
+		}
+		load.Sessions = append(load.Sessions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return load, nil
+}
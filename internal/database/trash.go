@@ -0,0 +1,112 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// sessionChildTables hold rows that belong to a session and must be removed with it
+var sessionChildTables = []string{"track_points", "session_laps", "session_records", "session_best_efforts"}
+
+// SoftDeleteSession moves a user's session to the trash
+func (db *DB) SoftDeleteSession(userID int64, id int) error {
+	query := `
+		UPDATE sessions
+		SET deleted_at = ?
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL
+	`
+
+	result, err := db.conn.Exec(query, time.Now(), id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	db.sessionsChanged(userID, []int64{int64(id)})
+	return nil
+}
+
+// RestoreSession moves a user's session out of the trash
+func (db *DB) RestoreSession(userID int64, id int) (*models.Session, error) {
+	query := `
+		UPDATE sessions
+		SET deleted_at = NULL, updated_at = ?
+		WHERE id = ? AND user_id = ? AND deleted_at IS NOT NULL
+		RETURNING ` + sessionColumns
+
+	session, err := scanSession(db.conn.QueryRow(query, time.Now(), id, userID))
+	if err != nil {
+		return nil, err
+	}
+
+	db.sessionsChanged(userID, []int64{session.ID})
+	return session, nil
+}
+
+// GetDeletedSessions lists a user's trashed sessions, most recently deleted first
+func (db *DB) GetDeletedSessions(userID int64) ([]models.Session, error) {
+	query := `
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = ? AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
+	`
+
+	rows, err := db.conn.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// PurgeDeletedSessions permanently removes sessions trashed before cutoff, across all users,
+// and returns how many were removed
+func (db *DB) PurgeDeletedSessions(cutoff time.Time) (int64, error) {
+	var purged int64
+
+	trashed := `SELECT id FROM sessions WHERE deleted_at IS NOT NULL AND ` + db.dialect.utc("deleted_at") + ` < ?`
+
+	err := db.inTx(func(tx *sqlTx) error {
+		if err := deleteChildRows(tx, sessionChildTables, "session_id", trashed, db.dialect.utcArg(cutoff)); err != nil {
+			return err
+		}
+
+		result, err := tx.Exec(`DELETE FROM sessions WHERE id IN (`+trashed+`)`, db.dialect.utcArg(cutoff))
+		if err != nil {
+			return err
+		}
+
+		purged, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,114 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// ErrEmailTaken is returned when creating a user with an email another account already has
+var ErrEmailTaken = errors.New("email already registered")
+
+// userColumns is the column list selected for every user query, in scanUser order
+const userColumns = `id, email, COALESCE(name, ''), password_hash, created_at, updated_at`
+
+func scanUser(row scanner) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.PasswordHash,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// CreateUser stores a new account. The very first account also claims any
+// sessions, goals and Strava connection created before accounts existed. Returns
+// ErrEmailTaken if the email is already registered.
+func (db *DB) CreateUser(email, name, passwordHash string) (*models.User, error) {
+	var user *models.User
+	claimed := false
+
+	err := db.inTx(func(tx *sqlTx) error {
+		var existing int
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&existing); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO users (email, name, password_hash, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			RETURNING ` + userColumns
+
+		now := time.Now()
+		created, err := scanUser(tx.QueryRow(query, email, name, passwordHash, now, now))
+		if isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		if err != nil {
+			return err
+		}
+		user = created
+
+		if existing > 0 {
+			return nil
+		}
+
+		for _, table := range []string{"sessions", "goals", "strava_connections"} {
+			if _, err := tx.Exec(`UPDATE `+table+` SET user_id = ? WHERE user_id IS NULL`, user.ID); err != nil {
+				return err
+			}
+		}
+		claimed = true
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claimed {
+		db.sessionsChanged(user.ID, nil)
+	}
+	return user, nil
+}
+
+// GetUser retrieves a user by ID
+func (db *DB) GetUser(id int64) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = ?
+	`
+
+	return scanUser(db.conn.QueryRow(query, id))
+}
+
+// GetUserByEmail retrieves a user by email, returning nil if none exists
+func (db *DB) GetUserByEmail(email string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE email = ?
+	`
+
+	user, err := scanUser(db.conn.QueryRow(query, email))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// webhookEventColumns is the column list selected for every webhook event query, in scanWebhookEvent order
+const webhookEventColumns = `id, payload, status, attempts, last_error, received_at, next_attempt_at, processed_at`
+
+// ErrWebhookEventNotDead is returned when replaying an event that has not been dead-lettered
+var ErrWebhookEventNotDead = errors.New("webhook event is not dead-lettered")
+
+func scanWebhookEvent(row scanner) (*models.QueuedWebhookEvent, error) {
+	var event models.QueuedWebhookEvent
+	var payload string
+	err := row.Scan(
+		&event.ID,
+		&payload,
+		&event.Status,
+		&event.Attempts,
+		&event.LastError,
+		&event.ReceivedAt,
+		&event.NextAttemptAt,
+		&event.ProcessedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(payload), &event.Event); err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// EnqueueWebhookEvent stores a received webhook event, due immediately
+func (db *DB) EnqueueWebhookEvent(event models.WebhookEvent, now time.Time) (*models.QueuedWebhookEvent, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		INSERT INTO webhook_events (payload, status, received_at, next_attempt_at)
+		VALUES (?, ?, ?, ?)
+		RETURNING ` + webhookEventColumns
+
+	return scanWebhookEvent(db.conn.QueryRow(query, string(payload), models.WebhookEventPending, now, now))
+}
+
+// ClaimWebhookEvent hands the longest-waiting due event to a worker, counting the attempt.
+// Events claimed before staleBefore are assumed lost with their worker and claimed again.
+// Returns nil, nil if no event is due.
+func (db *DB) ClaimWebhookEvent(now, staleBefore time.Time) (*models.QueuedWebhookEvent, error) {
+	// The claimable condition is repeated outside the subquery so that of two workers racing
+	// for the same event only one updates it
+	claimable := `
+		(status = ? AND ` + db.dialect.utc("next_attempt_at") + ` <= ?)
+		OR (status = ? AND ` + db.dialect.utc("locked_at") + ` < ?)`
+
+	query := `
+		UPDATE webhook_events
+		SET status = ?, attempts = attempts + 1, locked_at = ?
+		WHERE id = (
+			SELECT id FROM webhook_events
+			WHERE ` + claimable + `
+			ORDER BY ` + db.dialect.utc("next_attempt_at") + `, id
+			LIMIT 1
+		) AND (` + claimable + `)
+		RETURNING ` + webhookEventColumns
+
+	claimableArgs := []any{
+		models.WebhookEventPending, db.dialect.utcArg(now),
+		models.WebhookEventProcessing, db.dialect.utcArg(staleBefore),
+	}
+
+	args := append([]any{models.WebhookEventProcessing, now}, claimableArgs...)
+	args = append(args, claimableArgs...)
+
+	event, err := scanWebhookEvent(db.conn.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return event, err
+}
+
+// CompleteWebhookEvent marks a claimed event as processed
+func (db *DB) CompleteWebhookEvent(id int64, now time.Time) error {
+	query := `
+		UPDATE webhook_events
+		SET status = ?, last_error = '', locked_at = NULL, processed_at = ?
+		WHERE id = ?
+	`
+	_, err := db.conn.Exec(query, models.WebhookEventDone, now, id)
+	return err
+}
+
+// RetryWebhookEvent returns a failed event to the queue, due again at nextAttempt
+func (db *DB) RetryWebhookEvent(id int64, processErr error, nextAttempt time.Time) error {
+	query := `
+		UPDATE webhook_events
+		SET status = ?, last_error = ?, locked_at = NULL, next_attempt_at = ?
+		WHERE id = ?
+	`
+	_, err := db.conn.Exec(query, models.WebhookEventPending, processErr.Error(), nextAttempt, id)
+	return err
+}
+
+// DeferWebhookEvent returns a claimed event to the queue until nextAttempt without counting
+// the attempt, for work that couldn't be tried yet rather than failed
+func (db *DB) DeferWebhookEvent(id int64, nextAttempt time.Time) error {
+	query := `
+		UPDATE webhook_events
+		SET status = ?, attempts = attempts - 1, locked_at = NULL, next_attempt_at = ?
+		WHERE id = ?
+	`
+	_, err := db.conn.Exec(query, models.WebhookEventPending, nextAttempt, id)
+	return err
+}
+
+// DeadLetterWebhookEvent gives up on an event that failed its last attempt. It stays stored
+// so it can be inspected and replayed.
+func (db *DB) DeadLetterWebhookEvent(id int64, processErr error, now time.Time) error {
+	query := `
+		UPDATE webhook_events
+		SET status = ?, last_error = ?, locked_at = NULL, processed_at = ?
+		WHERE id = ?
+	`
+	_, err := db.conn.Exec(query, models.WebhookEventDead, processErr.Error(), now, id)
+	return err
+}
+
+// ListWebhookEvents returns the most recently received events, newest first, optionally
+// only those in the given status
+func (db *DB) ListWebhookEvents(status string, limit int) ([]models.QueuedWebhookEvent, error) {
+	query := `
+		SELECT ` + webhookEventColumns + `
+		FROM webhook_events
+		WHERE ? = '' OR status = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	rows, err := db.conn.Query(query, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.QueuedWebhookEvent
+	for rows.Next() {
+		event, err := scanWebhookEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+
+	return events, rows.Err()
+}
+
+// ReplayWebhookEvent queues a dead-lettered event again with a fresh set of attempts.
+// Returns sql.ErrNoRows if the event doesn't exist and ErrWebhookEventNotDead if it
+// hasn't been dead-lettered.
+func (db *DB) ReplayWebhookEvent(id int64, now time.Time) (*models.QueuedWebhookEvent, error) {
+	query := `
+		UPDATE webhook_events
+		SET status = ?, attempts = 0, next_attempt_at = ?, processed_at = NULL
+		WHERE id = ? AND status = ?
+		RETURNING ` + webhookEventColumns
+
+	event, err := scanWebhookEvent(db.conn.QueryRow(query, models.WebhookEventPending, now, id, models.WebhookEventDead))
+	if err != sql.ErrNoRows {
+		return event, err
+	}
+
+	var exists bool
+	if err := db.conn.QueryRow(`SELECT EXISTS(SELECT 1 FROM webhook_events WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	return nil, ErrWebhookEventNotDead
+}
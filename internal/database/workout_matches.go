@@ -0,0 +1,413 @@
+package database
+
+import (
+	"math"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// scoreCompliance compares a session with the planned workout it was run for. Each target the
+// workout sets (distance, duration, pace) contributes equally to the score, losing one point
+// per percent of deviation; a workout without targets is fully met by any session.
+func scoreCompliance(workout models.PlannedWorkout, session models.Session) models.WorkoutMatch {
+	match := models.WorkoutMatch{
+		SessionID:      session.ID,
+		ActualDistance: session.Distance,
+		ActualDuration: session.Duration,
+	}
+
+	var scores []float64
+	deviation := func(actual, planned float64) *float64 {
+		d := round2((actual - planned) / planned * 100)
+		scores = append(scores, math.Max(0, 100-math.Abs(d)))
+		return &d
+	}
+
+	if workout.Distance > 0 {
+		match.DistanceDeviation = deviation(session.Distance, workout.Distance)
+	}
+	if workout.Duration != nil && *workout.Duration > 0 {
+		match.DurationDeviation = deviation(float64(session.Duration), float64(*workout.Duration))
+	}
+	if workout.TargetPace != nil && session.Distance > 0 {
+		match.PaceDeviation = deviation(float64(session.Duration)/session.Distance, *workout.TargetPace)
+	}
+
+	match.Compliance = 100
+	if len(scores) > 0 {
+		var sum float64
+		for _, s := range scores {
+			sum += s
+		}
+		match.Compliance = round2(sum / float64(len(scores)))
+	}
+
+	return match
+}
+
+// sessionDay is the calendar day a session was run on, in the offset it was logged with
+func sessionDay(session models.Session) string {
+	return session.Date.Format("2006-01-02")
+}
+
+// setWorkoutMatchQuery links a workout to a session with its score, unless another session got to it first
+const setWorkoutMatchQuery = `
+	UPDATE planned_workouts
+	SET session_id = ?, actual_distance = ?, actual_duration = ?, distance_deviation = ?,
+		duration_deviation = ?, pace_deviation = ?, compliance = ?, matched_at = ?
+	WHERE id = ? AND session_id IS NULL
+`
+
+// setWorkoutMatchArgs returns the arguments of setWorkoutMatchQuery
+func setWorkoutMatchArgs(workoutID int64, match models.WorkoutMatch) []any {
+	return []any{
+		match.SessionID,
+		match.ActualDistance,
+		match.ActualDuration,
+		match.DistanceDeviation,
+		match.DurationDeviation,
+		match.PaceDeviation,
+		match.Compliance,
+		match.MatchedAt,
+		workoutID,
+	}
+}
+
+// MatchSession returns the workout a session is matched to, first linking it to the first
+// unmatched workout planned on its day and scoring it if it has none. Rest days are never
+// matched. Returns nil, nil if there is nothing to match.
+func (db *DB) MatchSession(session *models.Session) (*models.PlannedWorkout, error) {
+	// Storing the session has usually matched it already, through sessionsChanged
+	matched, err := db.queryPlannedWorkouts(`user_id = ? AND session_id = ?`, session.UserID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(matched) > 0 {
+		return &matched[0], nil
+	}
+
+	workouts, err := db.queryPlannedWorkouts(
+		`user_id = ? AND date = ? AND workout_type <> ? AND session_id IS NULL`,
+		session.UserID,
+		sessionDay(*session),
+		models.WorkoutRest,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(workouts) == 0 {
+		return nil, nil
+	}
+
+	workout := workouts[0]
+	match := scoreCompliance(workout, *session)
+	match.MatchedAt = time.Now()
+
+	result, err := db.conn.Exec(setWorkoutMatchQuery, setWorkoutMatchArgs(workout.ID, match)...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	if rows == 0 {
+		return nil, nil
+	}
+
+	workout.Match = &match
+	return &workout, nil
+}
+
+// matchOpenWorkouts links a user's unmatched workouts to the unmatched sessions run on their
+// day, in date order, so sessions imported, moved or logged before their workout was planned
+// are matched too
+func (db *DB) matchOpenWorkouts(userID int64) error {
+	workouts, err := db.queryPlannedWorkouts(`user_id = ? AND session_id IS NULL AND workout_type <> ?`, userID, models.WorkoutRest)
+	if err != nil {
+		return err
+	}
+
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	first, err := time.Parse("2006-01-02", workouts[0].Date)
+	if err != nil {
+		return err
+	}
+	last, err := time.Parse("2006-01-02", workouts[len(workouts)-1].Date)
+	if err != nil {
+		return err
+	}
+
+	// A session's day depends on the offset it was logged with, so a day either side is read
+	date := db.dialect.utc("date")
+	rows, err := db.conn.Query(`
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = ? AND deleted_at IS NULL AND `+date+` >= ? AND `+date+` < ?
+			AND id NOT IN (SELECT session_id FROM planned_workouts WHERE user_id = ? AND session_id IS NOT NULL)
+		ORDER BY `+date+`, id
+	`, userID, db.dialect.utcArg(first.AddDate(0, 0, -1)), db.dialect.utcArg(last.AddDate(0, 0, 2)), userID)
+	if err != nil {
+		return err
+	}
+
+	byDay := make(map[string][]models.Session)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		day := sessionDay(*session)
+		byDay[day] = append(byDay[day], *session)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(byDay) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	return db.inTx(func(tx *sqlTx) error {
+		for _, w := range workouts {
+			candidates := byDay[w.Date]
+			if len(candidates) == 0 {
+				continue
+			}
+			byDay[w.Date] = candidates[1:]
+
+			match := scoreCompliance(w, candidates[0])
+			match.MatchedAt = now
+			if _, err := tx.Exec(setWorkoutMatchQuery, setWorkoutMatchArgs(w.ID, match)...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// refreshWorkoutMatches keeps a user's matches in line with their sessions and plans: matches
+// whose session was deleted or moved to another day are released, the rest are rescored so
+// edits to either side are reflected, and workouts left unmatched are matched where a session
+// was run on their day.
+func (db *DB) refreshWorkoutMatches(userID int64) error {
+	if err := db.rescoreWorkoutMatches(userID); err != nil {
+		return err
+	}
+
+	return db.matchOpenWorkouts(userID)
+}
+
+// rescoreWorkoutMatches releases or rescores a user's existing matches
+func (db *DB) rescoreWorkoutMatches(userID int64) error {
+	workouts, err := db.queryPlannedWorkouts(`user_id = ? AND session_id IS NOT NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = ? AND deleted_at IS NULL
+			AND id IN (SELECT session_id FROM planned_workouts WHERE user_id = ?)
+	`, userID, userID)
+	if err != nil {
+		return err
+	}
+
+	sessions := make(map[int64]models.Session)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		sessions[session.ID] = *session
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return db.inTx(func(tx *sqlTx) error {
+		for _, w := range workouts {
+			session, ok := sessions[w.Match.SessionID]
+			if !ok || sessionDay(session) != w.Date || w.WorkoutType == models.WorkoutRest {
+				_, err := tx.Exec(`
+					UPDATE planned_workouts
+					SET session_id = NULL, actual_distance = NULL, actual_duration = NULL, distance_deviation = NULL,
+						duration_deviation = NULL, pace_deviation = NULL, compliance = NULL, matched_at = NULL
+					WHERE id = ?
+				`, w.ID)
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			match := scoreCompliance(w, session)
+			if sameMatch(match, *w.Match) {
+				continue
+			}
+
+			_, err := tx.Exec(`
+				UPDATE planned_workouts
+				SET actual_distance = ?, actual_duration = ?, distance_deviation = ?,
+					duration_deviation = ?, pace_deviation = ?, compliance = ?
+				WHERE id = ? AND session_id = ?
+			`,
+				match.ActualDistance,
+				match.ActualDuration,
+				match.DistanceDeviation,
+				match.DurationDeviation,
+				match.PaceDeviation,
+				match.Compliance,
+				w.ID,
+				match.SessionID,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// sameMatch reports whether two scores of the same match agree, ignoring when they were made
+func sameMatch(a, b models.WorkoutMatch) bool {
+	sameDeviation := func(x, y *float64) bool {
+		return (x == nil) == (y == nil) && (x == nil || *x == *y)
+	}
+
+	return a.ActualDistance == b.ActualDistance &&
+		a.ActualDuration == b.ActualDuration &&
+		a.Compliance == b.Compliance &&
+		sameDeviation(a.DistanceDeviation, b.DistanceDeviation) &&
+		sameDeviation(a.DurationDeviation, b.DurationDeviation) &&
+		sameDeviation(a.PaceDeviation, b.PaceDeviation)
+}
+
+// GetPlanAdherence reports how well a user's plan has been followed up to today (YYYY-MM-DD)
+func (db *DB) GetPlanAdherence(userID int64, planID int, today string) (*models.PlanAdherence, error) {
+	plan, err := db.GetPlan(userID, planID)
+	if err != nil {
+		return nil, err
+	}
+
+	adherence := computePlanAdherence(*plan, today)
+	return &adherence, nil
+}
+
+// computePlanAdherence groups a plan's workouts into weeks counted from its start date and
+// tallies the due, completed and compliance figures of each
+func computePlanAdherence(plan models.TrainingPlan, today string) models.PlanAdherence {
+	result := models.PlanAdherence{PlanID: plan.ID, Weeks: []models.WeekAdherence{}}
+
+	start, err := time.Parse("2006-01-02", plan.StartDate)
+	if err != nil {
+		return result
+	}
+
+	weekIndex := func(date string) int {
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return 0
+		}
+		return int(math.Floor(d.Sub(start).Hours() / 24 / 7))
+	}
+
+	// Hand-added workouts may fall before the plan start, so weeks span the workouts' range
+	first, last := 0, 0
+	for i, w := range plan.Workouts {
+		idx := weekIndex(w.Date)
+		if i == 0 || idx < first {
+			first = idx
+		}
+		if i == 0 || idx > last {
+			last = idx
+		}
+	}
+
+	weeks := make([]models.WeekAdherence, last-first+1)
+	compliance := make([]float64, len(weeks))
+	for i := range weeks {
+		weekStart := start.AddDate(0, 0, 7*(first+i))
+		weeks[i].WeekStart = weekStart.Format("2006-01-02")
+		weeks[i].WeekEnd = weekStart.AddDate(0, 0, 6).Format("2006-01-02")
+	}
+
+	var totalCompliance float64
+	for _, w := range plan.Workouts {
+		if w.WorkoutType == models.WorkoutRest {
+			continue
+		}
+
+		i := weekIndex(w.Date) - first
+		week := &weeks[i]
+		week.Planned++
+
+		if w.Date > today && w.Match == nil {
+			continue
+		}
+
+		week.Due++
+		week.PlannedDistance += w.Distance
+		if w.Match != nil {
+			week.Completed++
+			week.CompletedDistance += w.Match.ActualDistance
+			compliance[i] += w.Match.Compliance
+			totalCompliance += w.Match.Compliance
+		}
+	}
+
+	for i := range weeks {
+		week := &weeks[i]
+		week.PlannedDistance = round2(week.PlannedDistance)
+		week.CompletedDistance = round2(week.CompletedDistance)
+		week.Adherence = percentOf(week.Completed, week.Due)
+		if week.Completed > 0 {
+			avg := round2(compliance[i] / float64(week.Completed))
+			week.AvgCompliance = &avg
+		}
+
+		result.Due += week.Due
+		result.Completed += week.Completed
+	}
+
+	result.Adherence = percentOf(result.Completed, result.Due)
+	if result.Completed > 0 {
+		avg := round2(totalCompliance / float64(result.Completed))
+		result.AvgCompliance = &avg
+	}
+
+	if len(plan.Workouts) > 0 {
+		result.Weeks = weeks
+	}
+
+	return result
+}
+
+// percentOf returns part as a percentage of whole, or nil when whole is zero
+func percentOf(part, whole int) *float64 {
+	if whole == 0 {
+		return nil
+	}
+	p := round2(float64(part) / float64(whole) * 100)
+	return &p
+}
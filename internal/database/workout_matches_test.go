@@ -0,0 +1,160 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+func TestScoreCompliance(t *testing.T) {
+	duration := 3000
+	pace := 300.0
+
+	tests := []struct {
+		name           string
+		workout        models.PlannedWorkout
+		session        models.Session
+		wantCompliance float64
+		wantDistance   *float64
+		wantDuration   *float64
+		wantPace       *float64
+	}{
+		{
+			name:           "distance only, exact",
+			workout:        models.PlannedWorkout{Distance: 10},
+			session:        models.Session{Distance: 10, Duration: 3300},
+			wantCompliance: 100,
+			wantDistance:   floatPtr(0),
+		},
+		{
+			name:           "distance only, short",
+			workout:        models.PlannedWorkout{Distance: 10},
+			session:        models.Session{Distance: 8, Duration: 2400},
+			wantCompliance: 80,
+			wantDistance:   floatPtr(-20),
+		},
+		{
+			name:           "all targets",
+			workout:        models.PlannedWorkout{Distance: 10, Duration: &duration, TargetPace: &pace},
+			session:        models.Session{Distance: 11, Duration: 3300},
+			wantCompliance: 93.33,
+			wantDistance:   floatPtr(10),
+			wantDuration:   floatPtr(10),
+			wantPace:       floatPtr(0),
+		},
+		{
+			name:           "far off scores zero",
+			workout:        models.PlannedWorkout{Distance: 5},
+			session:        models.Session{Distance: 12, Duration: 3600},
+			wantCompliance: 0,
+			wantDistance:   floatPtr(140),
+		},
+		{
+			name:           "no targets",
+			workout:        models.PlannedWorkout{WorkoutType: models.WorkoutRace},
+			session:        models.Session{Distance: 5, Duration: 1500},
+			wantCompliance: 100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := scoreCompliance(tt.workout, tt.session)
+			if m.Compliance != tt.wantCompliance {
+				t.Errorf("Expected compliance %.2f, got %.2f", tt.wantCompliance, m.Compliance)
+			}
+			for _, dev := range []struct {
+				name      string
+				got, want *float64
+			}{
+				{"distance", m.DistanceDeviation, tt.wantDistance},
+				{"duration", m.DurationDeviation, tt.wantDuration},
+				{"pace", m.PaceDeviation, tt.wantPace},
+			} {
+				if (dev.got == nil) != (dev.want == nil) || (dev.got != nil && *dev.got != *dev.want) {
+					t.Errorf("Unexpected %s deviation: got %v, want %v", dev.name, derefFloat(dev.got), derefFloat(dev.want))
+				}
+			}
+		})
+	}
+}
+
+func TestComputePlanAdherence(t *testing.T) {
+	matched := func(date string, distance, actual, compliance float64) models.PlannedWorkout {
+		return models.PlannedWorkout{
+			Date:        date,
+			WorkoutType: models.WorkoutEasy,
+			Distance:    distance,
+			Match:       &models.WorkoutMatch{ActualDistance: actual, Compliance: compliance},
+		}
+	}
+	planned := func(date, workoutType string, distance float64) models.PlannedWorkout {
+		return models.PlannedWorkout{Date: date, WorkoutType: workoutType, Distance: distance}
+	}
+
+	plan := models.TrainingPlan{
+		ID:        7,
+		StartDate: "2024-03-04",
+		Workouts: []models.PlannedWorkout{
+			// Week 1: both done
+			matched("2024-03-05", 5, 5, 100),
+			matched("2024-03-09", 10, 9, 90),
+			planned("2024-03-10", models.WorkoutRest, 0),
+			// Week 2: one done, one missed, one still to come
+			matched("2024-03-12", 6, 4.5, 75),
+			planned("2024-03-14", models.WorkoutTempo, 8),
+			planned("2024-03-17", models.WorkoutLong, 12),
+			// Week 3: nothing due yet
+			planned("2024-03-19", models.WorkoutEasy, 6),
+		},
+	}
+
+	got := computePlanAdherence(plan, "2024-03-15")
+
+	if got.PlanID != 7 || got.Due != 4 || got.Completed != 3 {
+		t.Fatalf("Expected 3 of 4 due workouts completed, got %d of %d", got.Completed, got.Due)
+	}
+	if got.Adherence == nil || *got.Adherence != 75 || got.AvgCompliance == nil || *got.AvgCompliance != 88.33 {
+		t.Errorf("Expected 75%% adherence and 88.33 compliance, got %v and %v", derefFloat(got.Adherence), derefFloat(got.AvgCompliance))
+	}
+
+	want := []struct {
+		start                   string
+		planned, due, completed int
+		plannedKm, completedKm  float64
+		adherence               *float64
+	}{
+		{"2024-03-04", 2, 2, 2, 15, 14, floatPtr(100)},
+		{"2024-03-11", 3, 2, 1, 14, 4.5, floatPtr(50)},
+		{"2024-03-18", 1, 0, 0, 0, 0, nil},
+	}
+	if len(got.Weeks) != len(want) {
+		t.Fatalf("Expected %d weeks, got %d", len(want), len(got.Weeks))
+	}
+	for i, w := range want {
+		g := got.Weeks[i]
+		if g.WeekStart != w.start || g.Planned != w.planned || g.Due != w.due || g.Completed != w.completed ||
+			g.PlannedDistance != w.plannedKm || g.CompletedDistance != w.completedKm {
+			t.Errorf("Week %d: unexpected %+v", i+1, g)
+		}
+		if (g.Adherence == nil) != (w.adherence == nil) || (g.Adherence != nil && *g.Adherence != *w.adherence) {
+			t.Errorf("Week %d: expected adherence %v, got %v", i+1, derefFloat(w.adherence), derefFloat(g.Adherence))
+		}
+	}
+
+	empty := computePlanAdherence(models.TrainingPlan{StartDate: "2024-03-04"}, "2024-03-15")
+	if len(empty.Weeks) != 0 || empty.Adherence != nil {
+		t.Errorf("Expected no weeks for a plan without workouts, got %+v", empty)
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func derefFloat(v *float64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
@@ -0,0 +1,188 @@
+package fit
+
+import (
+	"fmt"
+	"time"
+)
+
+// Sport values from the FIT profile used by the importer
+const (
+	SportGeneric = 0
+	SportRunning = 1
+)
+
+// Activity is the decoded content of a FIT activity file
+type Activity struct {
+	Sport        int
+	StartTime    time.Time
+	ElapsedTime  float64  // seconds, including pauses
+	TimerTime    float64  // seconds, excluding pauses
+	Distance     float64  // meters
+	TotalAscent  *float64 // meters
+	AvgHeartRate *int     // bpm
+	MaxHeartRate *int     // bpm
+	AvgCadence   *int     // rpm as recorded; strides per minute for running
+	Laps         []Lap
+	Records      []Record
+}
+
+// Lap is a device-recorded lap summary
+type Lap struct {
+	StartTime    time.Time
+	ElapsedTime  float64  // seconds
+	TimerTime    float64  // seconds
+	Distance     float64  // meters
+	TotalAscent  *float64 // meters
+	AvgHeartRate *int
+	MaxHeartRate *int
+	AvgCadence   *int
+	AvgPower     *int // watts
+}
+
+// Record is a single timestamped sample from the device
+type Record struct {
+	Timestamp time.Time
+	Latitude  *float64 // degrees
+	Longitude *float64 // degrees
+	Altitude  *float64 // meters
+	Distance  *float64 // meters from start
+	Speed     *float64 // m/s
+	HeartRate *int
+	Cadence   *int
+	Power     *int // watts
+}
+
+// activityBuilder accumulates decoded messages into an Activity
+type activityBuilder struct {
+	isActivity bool
+	hasFileID  bool
+	session    *message
+	laps       []Lap
+	records    []Record
+}
+
+func newActivityBuilder() *activityBuilder {
+	return &activityBuilder{}
+}
+
+func (b *activityBuilder) add(msg *message) {
+	switch msg.globalNum {
+	case mesgFileID:
+		b.hasFileID = true
+		// File type 4 is an activity
+		b.isActivity = msg.values[0] == 4
+	case mesgSession:
+		// Multisport files carry several sessions; the first one is the run we import
+		if b.session == nil {
+			b.session = msg
+		}
+	case mesgLap:
+		b.laps = append(b.laps, Lap{
+			StartTime:    timeField(msg, 2),
+			ElapsedTime:  msg.values[7] / 1000,
+			TimerTime:    msg.values[8] / 1000,
+			Distance:     msg.values[9] / 100,
+			TotalAscent:  floatField(msg, 21, 1, 0),
+			AvgHeartRate: intField(msg, 15),
+			MaxHeartRate: intField(msg, 16),
+			AvgCadence:   intField(msg, 17),
+			AvgPower:     intField(msg, 19),
+		})
+	case mesgRecord:
+		if msg.timestamp == nil {
+			return
+		}
+
+		record := Record{
+			Timestamp: *msg.timestamp,
+			Latitude:  floatField(msg, 0, 1/semicircleToDegrees, 0),
+			Longitude: floatField(msg, 1, 1/semicircleToDegrees, 0),
+			Altitude:  floatField(msg, 2, 5, 500),
+			Distance:  floatField(msg, 5, 100, 0),
+			Speed:     floatField(msg, 6, 1000, 0),
+			HeartRate: intField(msg, 3),
+			Cadence:   intField(msg, 4),
+			Power:     intField(msg, 7),
+		}
+
+		// Prefer enhanced fields when the device writes them
+		if alt := floatField(msg, 78, 5, 500); alt != nil {
+			record.Altitude = alt
+		}
+		if speed := floatField(msg, 73, 1000, 0); speed != nil {
+			record.Speed = speed
+		}
+
+		b.records = append(b.records, record)
+	}
+}
+
+// build assembles the activity, deriving totals from records when the file has no session message
+func (b *activityBuilder) build() (*Activity, error) {
+	if !b.hasFileID || !b.isActivity {
+		return nil, fmt.Errorf("FIT file is not an activity")
+	}
+
+	activity := &Activity{
+		Laps:    b.laps,
+		Records: b.records,
+	}
+
+	if b.session != nil {
+		activity.Sport = int(b.session.values[5])
+		activity.StartTime = timeField(b.session, 2)
+		activity.ElapsedTime = b.session.values[7] / 1000
+		activity.TimerTime = b.session.values[8] / 1000
+		activity.Distance = b.session.values[9] / 100
+		activity.TotalAscent = floatField(b.session, 22, 1, 0)
+		activity.AvgHeartRate = intField(b.session, 16)
+		activity.MaxHeartRate = intField(b.session, 17)
+		activity.AvgCadence = intField(b.session, 18)
+	} else if len(b.records) > 0 {
+		first := b.records[0]
+		last := b.records[len(b.records)-1]
+		activity.StartTime = first.Timestamp
+		activity.ElapsedTime = last.Timestamp.Sub(first.Timestamp).Seconds()
+		activity.TimerTime = activity.ElapsedTime
+		if last.Distance != nil {
+			activity.Distance = *last.Distance
+		}
+	}
+
+	if activity.StartTime.IsZero() {
+		return nil, fmt.Errorf("FIT activity has no start time")
+	}
+
+	return activity, nil
+}
+
+// timeField returns a date_time field, falling back to the message timestamp
+func timeField(msg *message, num uint8) time.Time {
+	if v, ok := msg.values[num]; ok {
+		return fitEpoch.Add(time.Duration(v) * time.Second)
+	}
+	if msg.timestamp != nil {
+		return *msg.timestamp
+	}
+	return time.Time{}
+}
+
+// floatField applies the FIT scale and offset to a field, or returns nil if absent
+func floatField(msg *message, num uint8, scale, offset float64) *float64 {
+	v, ok := msg.values[num]
+	if !ok {
+		return nil
+	}
+	f := v/scale - offset
+	return &f
+}
+
+// intField returns an integer field, or nil if absent
+func intField(msg *message, num uint8) *int {
+	v, ok := msg.values[num]
+	if !ok {
+		return nil
+	}
+	i := int(v)
+	return &i
+}
@@ -0,0 +1,362 @@
+// Package fit decodes Garmin FIT activity files into laps and per-second records.
+package fit
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// fitEpoch is the FIT timestamp origin, 1989-12-31T00:00:00Z
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// semicircleToDegrees converts FIT position units to degrees
+const semicircleToDegrees = 180.0 / (1 << 31)
+
+// Global message numbers used by the decoder
+const (
+	mesgFileID  = 0
+	mesgSession = 18
+	mesgLap     = 19
+	mesgRecord  = 20
+)
+
+// fieldTimestamp is the common timestamp field number across messages
+const fieldTimestamp = 253
+
+var ErrNotFIT = errors.New("not a FIT file")
+
+// fieldDef describes one field of a definition message
+type fieldDef struct {
+	num      uint8
+	size     uint8
+	baseType uint8
+}
+
+// messageDef is a definition message bound to a local message type
+type messageDef struct {
+	globalNum  uint16
+	byteOrder  binary.ByteOrder
+	fields     []fieldDef
+	devDataLen int
+}
+
+// message is a decoded data message; values are keyed by field number
+// and only present when the field held a valid value
+type message struct {
+	globalNum uint16
+	values    map[uint8]float64
+	timestamp *time.Time
+}
+
+// decoder tracks the state needed while walking the record stream
+type decoder struct {
+	r             *bufio.Reader
+	crc           uint16
+	remaining     uint32
+	defs          map[uint8]*messageDef
+	lastTimestamp uint32
+}
+
+// Decode reads a FIT activity file and returns its session summary, laps and records
+func Decode(r io.Reader) (*Activity, error) {
+	d := &decoder{
+		r:    bufio.NewReader(r),
+		defs: make(map[uint8]*messageDef),
+	}
+
+	if err := d.readHeader(); err != nil {
+		return nil, err
+	}
+
+	b := newActivityBuilder()
+	for d.remaining > 0 {
+		msg, err := d.readRecord()
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil {
+			b.add(msg)
+		}
+	}
+
+	var fileCRC uint16
+	if err := binary.Read(d.r, binary.LittleEndian, &fileCRC); err != nil {
+		return nil, fmt.Errorf("failed to read file CRC: %w", err)
+	}
+	if fileCRC != 0 && fileCRC != d.crc {
+		return nil, fmt.Errorf("file CRC mismatch: expected %#04x, got %#04x", fileCRC, d.crc)
+	}
+
+	return b.build()
+}
+
+// readHeader validates the file header and records the size of the data section
+func (d *decoder) readHeader() error {
+	size, err := d.r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+	if size != 12 && size != 14 {
+		return ErrNotFIT
+	}
+
+	header := make([]byte, size-1)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if string(header[7:11]) != ".FIT" {
+		return ErrNotFIT
+	}
+
+	// The file CRC covers the header as well as the data records
+	d.crc = crc16(crc16(0, []byte{size}), header)
+
+	d.remaining = binary.LittleEndian.Uint32(header[3:7])
+	return nil
+}
+
+// read fills buf from the data section, updating the running CRC
+func (d *decoder) read(buf []byte) error {
+	if uint32(len(buf)) > d.remaining {
+		return fmt.Errorf("record exceeds data size")
+	}
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return fmt.Errorf("unexpected end of file: %w", err)
+	}
+
+	d.remaining -= uint32(len(buf))
+	d.crc = crc16(d.crc, buf)
+	return nil
+}
+
+func (d *decoder) readByte() (byte, error) {
+	buf := make([]byte, 1)
+	if err := d.read(buf); err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// readRecord reads one definition or data message. Definitions return a nil message.
+func (d *decoder) readRecord() (*message, error) {
+	header, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// Compressed timestamp header: local type in bits 5-6, time offset in bits 0-4
+	if header&0x80 != 0 {
+		local := (header >> 5) & 0x03
+		offset := uint32(header & 0x1F)
+		ts := (d.lastTimestamp &^ 0x1F) + offset
+		if offset < d.lastTimestamp&0x1F {
+			ts += 0x20
+		}
+		d.lastTimestamp = ts
+
+		msg, err := d.readData(local)
+		if err != nil {
+			return nil, err
+		}
+		if msg != nil && msg.timestamp == nil {
+			t := fitEpoch.Add(time.Duration(ts) * time.Second)
+			msg.timestamp = &t
+		}
+		return msg, nil
+	}
+
+	local := header & 0x0F
+	if header&0x40 != 0 {
+		return nil, d.readDefinition(local, header&0x20 != 0)
+	}
+
+	return d.readData(local)
+}
+
+// readDefinition parses a definition message and binds it to a local message type
+func (d *decoder) readDefinition(local uint8, hasDevFields bool) error {
+	fixed := make([]byte, 5)
+	if err := d.read(fixed); err != nil {
+		return err
+	}
+
+	def := &messageDef{byteOrder: binary.LittleEndian}
+	if fixed[1] == 1 {
+		def.byteOrder = binary.BigEndian
+	}
+	def.globalNum = def.byteOrder.Uint16(fixed[2:4])
+
+	numFields := int(fixed[4])
+	fields := make([]byte, numFields*3)
+	if err := d.read(fields); err != nil {
+		return err
+	}
+	for i := 0; i < numFields; i++ {
+		def.fields = append(def.fields, fieldDef{
+			num:      fields[i*3],
+			size:     fields[i*3+1],
+			baseType: fields[i*3+2],
+		})
+	}
+
+	if hasDevFields {
+		numDev, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		devFields := make([]byte, int(numDev)*3)
+		if err := d.read(devFields); err != nil {
+			return err
+		}
+		for i := 0; i < int(numDev); i++ {
+			def.devDataLen += int(devFields[i*3+1])
+		}
+	}
+
+	d.defs[local] = def
+	return nil
+}
+
+// readData parses a data message using the definition bound to its local type
+func (d *decoder) readData(local uint8) (*message, error) {
+	def, ok := d.defs[local]
+	if !ok {
+		return nil, fmt.Errorf("data message for undefined local type %d", local)
+	}
+
+	msg := &message{
+		globalNum: def.globalNum,
+		values:    make(map[uint8]float64),
+	}
+
+	for _, f := range def.fields {
+		buf := make([]byte, f.size)
+		if err := d.read(buf); err != nil {
+			return nil, err
+		}
+
+		v, ok := decodeValue(buf, f.baseType, def.byteOrder)
+		if !ok {
+			continue
+		}
+
+		if f.num == fieldTimestamp {
+			d.lastTimestamp = uint32(v)
+			t := fitEpoch.Add(time.Duration(v) * time.Second)
+			msg.timestamp = &t
+			continue
+		}
+		msg.values[f.num] = v
+	}
+
+	if def.devDataLen > 0 {
+		if err := d.read(make([]byte, def.devDataLen)); err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+// decodeValue decodes a single numeric field, reporting false for invalid
+// sentinel values, arrays and non-numeric types
+func decodeValue(buf []byte, baseType uint8, order binary.ByteOrder) (float64, bool) {
+	switch baseType {
+	case 0x00, 0x02, 0x0D: // enum, uint8, byte
+		if len(buf) != 1 || buf[0] == 0xFF {
+			return 0, false
+		}
+		return float64(buf[0]), true
+	case 0x0A: // uint8z
+		if len(buf) != 1 || buf[0] == 0x00 {
+			return 0, false
+		}
+		return float64(buf[0]), true
+	case 0x01: // sint8
+		if len(buf) != 1 || buf[0] == 0x7F {
+			return 0, false
+		}
+		return float64(int8(buf[0])), true
+	case 0x83: // sint16
+		if len(buf) != 2 {
+			return 0, false
+		}
+		v := order.Uint16(buf)
+		if v == 0x7FFF {
+			return 0, false
+		}
+		return float64(int16(v)), true
+	case 0x84, 0x8B: // uint16, uint16z
+		if len(buf) != 2 {
+			return 0, false
+		}
+		v := order.Uint16(buf)
+		if (baseType == 0x84 && v == 0xFFFF) || (baseType == 0x8B && v == 0) {
+			return 0, false
+		}
+		return float64(v), true
+	case 0x85: // sint32
+		if len(buf) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(buf)
+		if v == 0x7FFFFFFF {
+			return 0, false
+		}
+		return float64(int32(v)), true
+	case 0x86, 0x8C: // uint32, uint32z
+		if len(buf) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(buf)
+		if (baseType == 0x86 && v == 0xFFFFFFFF) || (baseType == 0x8C && v == 0) {
+			return 0, false
+		}
+		return float64(v), true
+	case 0x88: // float32
+		if len(buf) != 4 {
+			return 0, false
+		}
+		v := order.Uint32(buf)
+		if v == 0xFFFFFFFF {
+			return 0, false
+		}
+		return float64(math.Float32frombits(v)), true
+	case 0x89: // float64
+		if len(buf) != 8 {
+			return 0, false
+		}
+		v := order.Uint64(buf)
+		if v == 0xFFFFFFFFFFFFFFFF {
+			return 0, false
+		}
+		return math.Float64frombits(v), true
+	default: // strings, 64-bit integers and anything unknown are not needed
+		return 0, false
+	}
+}
+
+var crcTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// crc16 updates crc with buf using the FIT CRC-16 algorithm
+func crc16(crc uint16, buf []byte) uint16 {
+	for _, b := range buf {
+		tmp := crcTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ crcTable[b&0xF]
+
+		tmp = crcTable[crc&0xF]
+		crc = (crc >> 4) & 0x0FFF
+		crc = crc ^ tmp ^ crcTable[(b>>4)&0xF]
+	}
+	return crc
+}
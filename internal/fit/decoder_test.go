@@ -0,0 +1,192 @@
+package fit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// fitBuilder assembles a FIT file in memory for tests
+type fitBuilder struct {
+	data bytes.Buffer
+}
+
+type testField struct {
+	num      uint8
+	baseType uint8
+	value    any
+}
+
+func fieldSize(v any) uint8 {
+	return uint8(binary.Size(v))
+}
+
+func (b *fitBuilder) define(local uint8, global uint16, fields []testField) {
+	b.data.WriteByte(0x40 | local)
+	b.data.WriteByte(0) // reserved
+	b.data.WriteByte(0) // little endian
+	binary.Write(&b.data, binary.LittleEndian, global)
+	b.data.WriteByte(uint8(len(fields)))
+	for _, f := range fields {
+		b.data.Write([]byte{f.num, fieldSize(f.value), f.baseType})
+	}
+}
+
+func (b *fitBuilder) message(header uint8, fields []testField) {
+	b.data.WriteByte(header)
+	for _, f := range fields {
+		binary.Write(&b.data, binary.LittleEndian, f.value)
+	}
+}
+
+func (b *fitBuilder) bytes() []byte {
+	header := make([]byte, 12)
+	header[0] = 12
+	header[1] = 0x20
+	binary.LittleEndian.PutUint16(header[2:4], 2100)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(b.data.Len()))
+	copy(header[8:12], ".FIT")
+
+	file := append(header, b.data.Bytes()...)
+	crc := crc16(0, file)
+	return binary.LittleEndian.AppendUint16(file, crc)
+}
+
+func fitTime(t time.Time) uint32 {
+	return uint32(t.Sub(fitEpoch).Seconds())
+}
+
+func degreesToSemicircles(deg float64) int32 {
+	return int32(math.Round(deg / semicircleToDegrees))
+}
+
+func buildActivity(start time.Time) []byte {
+	b := &fitBuilder{}
+
+	fileID := []testField{{0, 0x00, uint8(4)}}
+	b.define(0, mesgFileID, fileID)
+	b.message(0, fileID)
+
+	recordFields := func(ts uint32, hr uint8, dist uint32, alt uint16) []testField {
+		return []testField{
+			{fieldTimestamp, 0x86, ts},
+			{0, 0x85, degreesToSemicircles(55.6761)},
+			{1, 0x85, degreesToSemicircles(12.5683)},
+			{2, 0x84, alt},
+			{3, 0x02, hr},
+			{4, 0x02, uint8(85)},
+			{5, 0x86, dist},
+			{7, 0x84, uint16(0xFFFF)}, // invalid power
+		}
+	}
+
+	ts := fitTime(start)
+	b.define(1, mesgRecord, recordFields(0, 0, 0, 0))
+	b.message(1, recordFields(ts, 140, 0, 2550))
+	b.message(1, recordFields(ts+10, 150, 3000, 2560))
+
+	// Compressed timestamp record without a timestamp field
+	compressed := []testField{{3, 0x02, uint8(155)}, {5, 0x86, uint32(6000)}}
+	b.define(2, mesgRecord, compressed)
+	b.message(0x80|(2<<5)|uint8((ts+20)&0x1F), compressed)
+
+	lap := []testField{
+		{2, 0x86, ts},
+		{7, 0x86, uint32(20000)},
+		{8, 0x86, uint32(20000)},
+		{9, 0x86, uint32(6000)},
+		{15, 0x02, uint8(148)},
+		{16, 0x02, uint8(155)},
+	}
+	b.define(3, mesgLap, lap)
+	b.message(3, lap)
+
+	session := []testField{
+		{2, 0x86, ts},
+		{5, 0x00, uint8(SportRunning)},
+		{7, 0x86, uint32(25000)},
+		{8, 0x86, uint32(20000)},
+		{9, 0x86, uint32(6000)},
+		{16, 0x02, uint8(148)},
+		{17, 0x02, uint8(155)},
+		{22, 0x84, uint16(12)},
+	}
+	b.define(4, mesgSession, session)
+	b.message(4, session)
+
+	return b.bytes()
+}
+
+func TestDecode(t *testing.T) {
+	start := time.Date(2024, 3, 10, 8, 0, 3, 0, time.UTC)
+
+	activity, err := Decode(bytes.NewReader(buildActivity(start)))
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if !activity.StartTime.Equal(start) {
+		t.Fatalf("Expected start %s, got %s", start, activity.StartTime)
+	}
+
+	if activity.Sport != SportRunning {
+		t.Fatalf("Expected running sport, got %d", activity.Sport)
+	}
+
+	if activity.Distance != 60 || activity.TimerTime != 20 || activity.ElapsedTime != 25 {
+		t.Fatalf("Unexpected totals: distance=%f timer=%f elapsed=%f", activity.Distance, activity.TimerTime, activity.ElapsedTime)
+	}
+
+	if activity.TotalAscent == nil || *activity.TotalAscent != 12 {
+		t.Fatalf("Expected total ascent 12, got %v", activity.TotalAscent)
+	}
+
+	if len(activity.Laps) != 1 || *activity.Laps[0].AvgHeartRate != 148 {
+		t.Fatalf("Unexpected laps: %+v", activity.Laps)
+	}
+
+	if len(activity.Records) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(activity.Records))
+	}
+
+	first := activity.Records[0]
+	if math.Abs(*first.Latitude-55.6761) > 1e-6 || math.Abs(*first.Longitude-12.5683) > 1e-6 {
+		t.Fatalf("Unexpected position: %f, %f", *first.Latitude, *first.Longitude)
+	}
+
+	if *first.Altitude != 10 {
+		t.Fatalf("Expected altitude 10m, got %f", *first.Altitude)
+	}
+
+	if first.Power != nil {
+		t.Fatalf("Expected invalid power to be omitted, got %d", *first.Power)
+	}
+
+	last := activity.Records[2]
+	if !last.Timestamp.Equal(start.Add(20 * time.Second)) {
+		t.Fatalf("Expected compressed timestamp %s, got %s", start.Add(20*time.Second), last.Timestamp)
+	}
+
+	if *last.HeartRate != 155 || *last.Distance != 60 {
+		t.Fatalf("Unexpected last record: hr=%d distance=%f", *last.HeartRate, *last.Distance)
+	}
+}
+
+func TestDecodeCRCMismatch(t *testing.T) {
+	data := buildActivity(time.Now().UTC())
+	data[len(data)-3] ^= 0xFF
+
+	if _, err := Decode(bytes.NewReader(data)); err == nil {
+		t.Fatal("Expected CRC error, got nil")
+	}
+}
+
+func TestDecodeNotFIT(t *testing.T) {
+	_, err := Decode(bytes.NewReader([]byte("<gpx></gpx>")))
+	if !errors.Is(err, ErrNotFIT) {
+		t.Fatalf("Expected ErrNotFIT, got %v", err)
+	}
+}
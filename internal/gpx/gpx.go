@@ -0,0 +1,168 @@
+// Package gpx parses GPX track files and summarizes them into run metrics.
+package gpx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+const (
+	earthRadiusMeters = 6371000.0
+
+	// minMovingSpeed is the speed (m/s) below which time between two points counts as stopped
+	minMovingSpeed = 0.5
+
+	// elevationThreshold is the climb (m) required before it is counted, to filter GPS noise
+	elevationThreshold = 3.0
+)
+
+// Point is a single recorded track point
+type Point struct {
+	Latitude  float64
+	Longitude float64
+	Elevation *float64
+	Time      *time.Time
+	Segment   int
+}
+
+// Track is the parsed content of a GPX file, flattened across tracks and segments
+type Track struct {
+	Name   string
+	Points []Point
+}
+
+// Summary holds the metrics derived from a track
+type Summary struct {
+	StartTime     time.Time
+	Distance      float64 // meters
+	MovingTime    int     // seconds
+	ElapsedTime   int     // seconds
+	ElevationGain float64 // meters
+}
+
+type gpxFile struct {
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []struct {
+				Lat  float64  `xml:"lat,attr"`
+				Lon  float64  `xml:"lon,attr"`
+				Ele  *float64 `xml:"ele"`
+				Time string   `xml:"time"`
+			} `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// Parse reads a GPX document and returns its track points in file order
+func Parse(r io.Reader) (*Track, error) {
+	var file gpxFile
+	if err := xml.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to decode GPX: %w", err)
+	}
+
+	track := &Track{}
+	segment := 0
+	for _, trk := range file.Tracks {
+		if track.Name == "" {
+			track.Name = trk.Name
+		}
+
+		for _, seg := range trk.Segments {
+			for _, pt := range seg.Points {
+				if pt.Lat < -90 || pt.Lat > 90 || pt.Lon < -180 || pt.Lon > 180 {
+					return nil, fmt.Errorf("invalid coordinates: lat=%f, lon=%f", pt.Lat, pt.Lon)
+				}
+
+				point := Point{
+					Latitude:  pt.Lat,
+					Longitude: pt.Lon,
+					Elevation: pt.Ele,
+					Segment:   segment,
+				}
+
+				if pt.Time != "" {
+					t, err := time.Parse(time.RFC3339, pt.Time)
+					if err != nil {
+						return nil, fmt.Errorf("invalid point time %q: %w", pt.Time, err)
+					}
+					point.Time = &t
+				}
+
+				track.Points = append(track.Points, point)
+			}
+			segment++
+		}
+	}
+
+	if len(track.Points) == 0 {
+		return nil, fmt.Errorf("GPX file contains no track points")
+	}
+
+	return track, nil
+}
+
+// Summarize computes distance, moving time, elapsed time and elevation gain.
+// Gaps between track segments are treated as pauses and contribute nothing.
+func (t *Track) Summarize() Summary {
+	var summary Summary
+	var first, last *time.Time
+
+	var climbRef *float64
+	for i, p := range t.Points {
+		if p.Time != nil {
+			if first == nil {
+				first = p.Time
+			}
+			last = p.Time
+		}
+
+		if p.Elevation != nil {
+			e := *p.Elevation
+			if climbRef == nil || e < *climbRef {
+				climbRef = &e
+			} else if e-*climbRef >= elevationThreshold {
+				summary.ElevationGain += e - *climbRef
+				climbRef = &e
+			}
+		}
+
+		if i == 0 || t.Points[i-1].Segment != p.Segment {
+			continue
+		}
+
+		prev := t.Points[i-1]
+		d := Distance(prev.Latitude, prev.Longitude, p.Latitude, p.Longitude)
+		summary.Distance += d
+
+		if prev.Time != nil && p.Time != nil {
+			dt := p.Time.Sub(*prev.Time).Seconds()
+			if dt > 0 && d/dt >= minMovingSpeed {
+				summary.MovingTime += int(math.Round(dt))
+			}
+		}
+	}
+
+	if first != nil {
+		summary.StartTime = *first
+		summary.ElapsedTime = int(last.Sub(*first).Seconds())
+	}
+
+	return summary
+}
+
+// Distance returns the great-circle distance in meters between two coordinates
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180
+	phi2 := lat2 * math.Pi / 180
+	dPhi := (lat2 - lat1) * math.Pi / 180
+	dLambda := (lon2 - lon1) * math.Pi / 180
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
@@ -0,0 +1,89 @@
+package gpx
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const sampleGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk>
+    <name>Morning Run</name>
+    <trkseg>
+      <trkpt lat="55.0000" lon="12.0000"><ele>10</ele><time>2024-01-15T10:00:00Z</time></trkpt>
+      <trkpt lat="55.0009" lon="12.0000"><ele>12</ele><time>2024-01-15T10:00:30Z</time></trkpt>
+      <trkpt lat="55.0018" lon="12.0000"><ele>16</ele><time>2024-01-15T10:01:00Z</time></trkpt>
+      <trkpt lat="55.0018" lon="12.0000"><ele>15</ele><time>2024-01-15T10:03:00Z</time></trkpt>
+    </trkseg>
+    <trkseg>
+      <trkpt lat="55.0100" lon="12.0000"><ele>15</ele><time>2024-01-15T10:10:00Z</time></trkpt>
+      <trkpt lat="55.0109" lon="12.0000"><ele>19</ele><time>2024-01-15T10:10:30Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+func TestParse(t *testing.T) {
+	track, err := Parse(strings.NewReader(sampleGPX))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if track.Name != "Morning Run" {
+		t.Fatalf("Expected name 'Morning Run', got %q", track.Name)
+	}
+
+	if len(track.Points) != 6 {
+		t.Fatalf("Expected 6 points, got %d", len(track.Points))
+	}
+
+	if track.Points[4].Segment != 1 {
+		t.Fatalf("Expected second segment index 1, got %d", track.Points[4].Segment)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	track, err := Parse(strings.NewReader(sampleGPX))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	summary := track.Summarize()
+
+	// Three 0.0009° latitude steps of ~100m each; the gap between segments is ignored
+	if math.Abs(summary.Distance-300.2) > 1 {
+		t.Fatalf("Expected distance ~300m, got %.1f", summary.Distance)
+	}
+
+	// Three moving 30s intervals; the 2 minute stop is excluded
+	if summary.MovingTime != 90 {
+		t.Fatalf("Expected moving time 90s, got %d", summary.MovingTime)
+	}
+
+	if summary.ElapsedTime != 630 {
+		t.Fatalf("Expected elapsed time 630s, got %d", summary.ElapsedTime)
+	}
+
+	// 10 -> 16 counts 6m, the 1m dip resets the reference, 15 -> 19 counts 4m
+	if summary.ElevationGain != 10 {
+		t.Fatalf("Expected elevation gain 10m, got %.1f", summary.ElevationGain)
+	}
+
+	if summary.StartTime.Format("15:04:05") != "10:00:00" {
+		t.Fatalf("Unexpected start time: %s", summary.StartTime)
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<gpx><trk><trkseg></trkseg></trk></gpx>`))
+	if err == nil {
+		t.Fatal("Expected error for GPX without points, got nil")
+	}
+}
+
+func TestParseInvalidXML(t *testing.T) {
+	_, err := Parse(strings.NewReader(`not xml`))
+	if err == nil {
+		t.Fatal("Expected error for invalid XML, got nil")
+	}
+}
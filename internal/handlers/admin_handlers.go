@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thc/runna-backend/internal/database"
+	"github.com/thc/runna-backend/internal/models"
+)
+
+const (
+	defaultWebhookEventLimit = 50
+	maxWebhookEventLimit     = 500
+)
+
+// GetWebhookEvents lists stored Strava webhook events, newest first
+func (h *Handler) GetWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", models.WebhookEventPending, models.WebhookEventProcessing, models.WebhookEventDone, models.WebhookEventDead:
+	default:
+		log.Printf("[WARN] GetWebhookEvents: Invalid status: %s", status)
+		http.Error(w, "Invalid status, use pending, processing, done or dead", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultWebhookEventLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l < 1 || l > maxWebhookEventLimit {
+			log.Printf("[WARN] GetWebhookEvents: Invalid limit: %s", v)
+			http.Error(w, fmt.Sprintf("Invalid limit, use a number between 1 and %d", maxWebhookEventLimit), http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	events, err := h.db.ListWebhookEvents(status, limit)
+	if err != nil {
+		log.Printf("[ERROR] GetWebhookEvents: Database error: %v", err)
+		http.Error(w, "Failed to get webhook events", http.StatusInternalServerError)
+		return
+	}
+
+	if events == nil {
+		events = []models.QueuedWebhookEvent{}
+	}
+
+	log.Printf("[INFO] GetWebhookEvents: Retrieved %d events", len(events))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// ReplayWebhookEvent queues a dead-lettered webhook event again
+func (h *Handler) ReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	idStr := r.PathValue("id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		log.Printf("[WARN] ReplayWebhookEvent: Invalid event ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.db.ReplayWebhookEvent(id, time.Now())
+	if err == sql.ErrNoRows {
+		log.Printf("[WARN] ReplayWebhookEvent: Event not found id=%d", id)
+		http.Error(w, "Webhook event not found", http.StatusNotFound)
+		return
+	}
+	if err == database.ErrWebhookEventNotDead {
+		log.Printf("[WARN] ReplayWebhookEvent: Event id=%d is not dead-lettered", id)
+		http.Error(w, "Only dead-lettered events can be replayed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] ReplayWebhookEvent: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to replay webhook event", http.StatusInternalServerError)
+		return
+	}
+
+	if h.webhookQueue != nil {
+		h.webhookQueue.Notify()
+	}
+
+	log.Printf("[INFO] ReplayWebhookEvent: Queued event id=%d again", id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(event)
+}
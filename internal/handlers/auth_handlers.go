@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thc/runna-backend/internal/auth"
+	"github.com/thc/runna-backend/internal/database"
+	"github.com/thc/runna-backend/internal/middleware"
+	"github.com/thc/runna-backend/internal/models"
+)
+
+const (
+	tokenTTL          = 30 * 24 * time.Hour
+	minPasswordLength = 8
+)
+
+// Signup creates a new account and returns a signed token for it
+func (h *Handler) Signup(w http.ResponseWriter, r *http.Request) {
+	var req models.SignupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] Signup: Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if !strings.Contains(req.Email, "@") {
+		log.Printf("[WARN] Signup: Invalid email: %s", req.Email)
+		http.Error(w, "A valid email is required", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Password) < minPasswordLength {
+		log.Printf("[WARN] Signup: Password too short for email=%s", req.Email)
+		http.Error(w, "Password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.db.GetUserByEmail(req.Email)
+	if err != nil {
+		log.Printf("[ERROR] Signup: Database error: %v", err)
+		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		log.Printf("[WARN] Signup: Email already registered: %s", req.Email)
+		http.Error(w, "Email is already registered", http.StatusConflict)
+		return
+	}
+
+	passwordHash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		log.Printf("[ERROR] Signup: Failed to hash password: %v", err)
+		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+
+	// Another signup with the same email may have got in since the check above
+	user, err := h.db.CreateUser(req.Email, strings.TrimSpace(req.Name), passwordHash)
+	if errors.Is(err, database.ErrEmailTaken) {
+		log.Printf("[WARN] Signup: Email already registered: %s", req.Email)
+		http.Error(w, "Email is already registered", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Signup: Database error: %v", err)
+		http.Error(w, "Failed to create account", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] Signup: Created user id=%d", user.ID)
+	h.writeAuthResponse(w, http.StatusCreated, user)
+}
+
+// Login verifies credentials and returns a signed token
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] Login: Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	user, err := h.db.GetUserByEmail(email)
+	if err != nil {
+		log.Printf("[ERROR] Login: Database error: %v", err)
+		http.Error(w, "Failed to log in", http.StatusInternalServerError)
+		return
+	}
+
+	if user == nil || !auth.CheckPassword(req.Password, user.PasswordHash) {
+		log.Printf("[WARN] Login: Invalid credentials for email=%s", email)
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	log.Printf("[INFO] Login: User id=%d logged in", user.ID)
+	h.writeAuthResponse(w, http.StatusOK, user)
+}
+
+// GetCurrentUser returns the authenticated user's account
+func (h *Handler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	user, err := h.db.GetUser(userID)
+	if err != nil {
+		log.Printf("[ERROR] GetCurrentUser: Database error for id=%d: %v", userID, err)
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// writeAuthResponse issues a token for user and writes it with the given status
+func (h *Handler) writeAuthResponse(w http.ResponseWriter, status int, user *models.User) {
+	token, expiresAt, err := auth.IssueToken(user.ID, h.authSecret, tokenTTL)
+	if err != nil {
+		log.Printf("[ERROR] Auth: Failed to issue token for user id=%d: %v", user.ID, err)
+		http.Error(w, "Server configuration error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.AuthResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User:      *user,
+	})
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/thc/runna-backend/internal/middleware"
+	"github.com/thc/runna-backend/internal/models"
+	"github.com/thc/runna-backend/internal/sessioncsv"
+)
+
+// ImportCSV bulk-creates sessions from a spreadsheet export. Rows are validated with the
+// same rules as CreateSession; if any row is invalid nothing is imported.
+func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	file, _, err := readImportFile(w, r)
+	if err != nil {
+		log.Printf("[WARN] ImportCSV: Failed to read upload: %v", err)
+		http.Error(w, "Invalid upload, send a CSV file in the 'file' form field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	mapping := sessioncsv.DefaultMapping()
+	for field, target := range map[string]*string{
+		"date_column":     &mapping.Date,
+		"distance_column": &mapping.Distance,
+		"duration_column": &mapping.Duration,
+		"notes_column":    &mapping.Notes,
+		"distance_unit":   &mapping.DistanceUnit,
+		"date_format":     &mapping.DateFormat,
+	} {
+		if v := r.FormValue(field); v != "" {
+			*target = v
+		}
+	}
+	dryRun := r.FormValue("dry_run") == "true"
+
+	rows, err := sessioncsv.Parse(file, mapping)
+	if err != nil {
+		log.Printf("[WARN] ImportCSV: Failed to parse CSV: %v", err)
+		http.Error(w, fmt.Sprintf("Invalid CSV file: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	report := models.CSVImportReport{
+		DryRun:    dryRun,
+		TotalRows: len(rows),
+		Errors:    []models.CSVRowError{},
+	}
+
+	var reqs []models.CreateSessionRequest
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			report.Errors = append(report.Errors, models.CSVRowError{Row: row.Line, Errors: row.Errors})
+			continue
+		}
+		reqs = append(reqs, row.Request)
+	}
+	report.ValidRows = len(reqs)
+
+	status := http.StatusOK
+	switch {
+	case dryRun:
+		log.Printf("[INFO] ImportCSV: Dry run validated %d/%d rows", report.ValidRows, report.TotalRows)
+	case len(report.Errors) > 0:
+		log.Printf("[WARN] ImportCSV: Rejected import with %d invalid rows", len(report.Errors))
+		status = http.StatusUnprocessableEntity
+	case len(reqs) > 0:
+		sessions, err := h.sessions.CreateSessions(userID, "csv", reqs)
+		if err != nil {
+			log.Printf("[ERROR] ImportCSV: Database error: %v", err)
+			http.Error(w, "Failed to import sessions", http.StatusInternalServerError)
+			return
+		}
+		report.Imported = len(sessions)
+		status = http.StatusCreated
+		log.Printf("[INFO] ImportCSV: Imported %d sessions", report.Imported)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// ExportCSV downloads the sessions in the requested date range as CSV
+func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	startDate, endDate, err := parseDateRange(r)
+	if err != nil {
+		log.Printf("[WARN] ExportCSV: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := h.sessions.GetSessions(userID, startDate, endDate)
+	if err != nil {
+		log.Printf("[ERROR] ExportCSV: Database error: %v", err)
+		http.Error(w, "Failed to export sessions", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("sessions_%s_%s.csv", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	if err := sessioncsv.Write(w, sessions); err != nil {
+		log.Printf("[ERROR] ExportCSV: Failed to write CSV: %v", err)
+		return
+	}
+
+	log.Printf("[INFO] ExportCSV: Exported %d sessions for period %s to %s", len(sessions), startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+}
@@ -1,15 +1,20 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/thc/runna-backend/internal/middleware"
 	"github.com/thc/runna-backend/internal/models"
 )
 
 func (h *Handler) CreateGoal(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
 	var req models.CreateGoalRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("[ERROR] CreateGoal: Failed to decode request body: %v", err)
@@ -17,33 +22,30 @@ func (h *Handler) CreateGoal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.TargetDistance <= 0 {
-		log.Printf("[WARN] CreateGoal: Invalid target distance: %f", req.TargetDistance)
-		http.Error(w, "Target distance must be greater than 0", http.StatusBadRequest)
+	req.Normalize()
+	if err := req.Validate(time.Now()); err != nil {
+		log.Printf("[WARN] CreateGoal: Invalid goal: %v (type=%s, target=%f, start=%s, end=%s)", err, req.GoalType, req.TargetValue, req.StartDate, req.EndDate)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if req.EndDate.Before(req.StartDate) {
-		log.Printf("[WARN] CreateGoal: End date before start date: start=%s, end=%s", req.StartDate, req.EndDate)
-		http.Error(w, "End date must be after start date", http.StatusBadRequest)
-		return
-	}
-
-	goal, err := h.db.CreateGoal(req)
+	goal, err := h.goals.CreateGoal(userID, req)
 	if err != nil {
 		log.Printf("[ERROR] CreateGoal: Database error: %v", err)
 		http.Error(w, "Failed to create goal", http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("[INFO] CreateGoal: Created goal id=%d, target=%.2fkm", goal.ID, goal.TargetDistance)
+	log.Printf("[INFO] CreateGoal: Created goal id=%d, type=%s, target=%.2f", goal.ID, goal.GoalType, goal.TargetValue)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(goal)
 }
 
 func (h *Handler) GetGoals(w http.ResponseWriter, r *http.Request) {
-	goals, err := h.db.GetGoals()
+	userID := middleware.UserID(r.Context())
+
+	goals, err := h.goals.GetGoals(userID)
 	if err != nil {
 		log.Printf("[ERROR] GetGoals: Database error: %v", err)
 		http.Error(w, "Failed to get goals", http.StatusInternalServerError)
@@ -56,6 +58,8 @@ func (h *Handler) GetGoals(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetGoal(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -64,7 +68,7 @@ func (h *Handler) GetGoal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	goal, err := h.db.GetGoal(id)
+	goal, err := h.goals.GetGoal(userID, id)
 	if err != nil {
 		log.Printf("[ERROR] GetGoal: Database error for id=%d: %v", id, err)
 		http.Error(w, "Goal not found", http.StatusNotFound)
@@ -76,7 +80,118 @@ func (h *Handler) GetGoal(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(goal)
 }
 
+// UpdateGoal changes a goal's target and period
+func (h *Handler) UpdateGoal(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] UpdateGoal: Invalid goal ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid goal ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreateGoalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] UpdateGoal: Failed to decode request body for id=%d: %v", id, err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Normalize()
+	if err := req.Validate(time.Now()); err != nil {
+		log.Printf("[WARN] UpdateGoal: Invalid goal for id=%d: %v (type=%s, target=%f, start=%s, end=%s)", id, err, req.GoalType, req.TargetValue, req.StartDate, req.EndDate)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	goal, err := h.goals.UpdateGoal(userID, id, req)
+	if err == sql.ErrNoRows {
+		log.Printf("[WARN] UpdateGoal: Goal not found id=%d", id)
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] UpdateGoal: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to update goal", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] UpdateGoal: Updated goal id=%d, type=%s, target=%.2f", goal.ID, goal.GoalType, goal.TargetValue)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goal)
+}
+
+// GetGoalHistory returns the daily progress snapshots of a goal, oldest first
+func (h *Handler) GetGoalHistory(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] GetGoalHistory: Invalid goal ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid goal ID", http.StatusBadRequest)
+		return
+	}
+
+	snapshots, err := h.goals.GetGoalSnapshots(userID, id)
+	if err == sql.ErrNoRows {
+		log.Printf("[WARN] GetGoalHistory: Goal not found id=%d", id)
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] GetGoalHistory: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to get goal history", http.StatusInternalServerError)
+		return
+	}
+
+	if snapshots == nil {
+		snapshots = []models.GoalSnapshot{}
+	}
+
+	log.Printf("[INFO] GetGoalHistory: Retrieved %d snapshots for goal id=%d", len(snapshots), id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// GetGoalPeriods returns the outcome of every finished period of a recurring goal, oldest first
+func (h *Handler) GetGoalPeriods(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] GetGoalPeriods: Invalid goal ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid goal ID", http.StatusBadRequest)
+		return
+	}
+
+	periods, err := h.goals.GetGoalPeriods(userID, id)
+	if err == sql.ErrNoRows {
+		log.Printf("[WARN] GetGoalPeriods: Goal not found id=%d", id)
+		http.Error(w, "Goal not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] GetGoalPeriods: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to get goal periods", http.StatusInternalServerError)
+		return
+	}
+
+	if periods == nil {
+		periods = []models.GoalPeriod{}
+	}
+
+	log.Printf("[INFO] GetGoalPeriods: Retrieved %d periods for goal id=%d", len(periods), id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(periods)
+}
+
 func (h *Handler) DeleteGoal(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -85,7 +200,12 @@ func (h *Handler) DeleteGoal(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.db.DeleteGoal(id); err != nil {
+	if err := h.goals.DeleteGoal(userID, id); err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("[WARN] DeleteGoal: Goal not found id=%d", id)
+			http.Error(w, "Goal not found", http.StatusNotFound)
+			return
+		}
 		log.Printf("[ERROR] DeleteGoal: Database error for id=%d: %v", id, err)
 		http.Error(w, "Failed to delete goal", http.StatusInternalServerError)
 		return
@@ -1,34 +1,75 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/thc/runna-backend/internal/crypto"
 	"github.com/thc/runna-backend/internal/database"
+	"github.com/thc/runna-backend/internal/middleware"
 	"github.com/thc/runna-backend/internal/models"
 )
 
+// stravaService is the part of services.StravaService the handlers use
+type stravaService interface {
+	ExchangeToken(code string) (*models.StravaTokenResponse, error)
+	StartSync(ctx context.Context, userID int64) error
+}
+
+// webhookQueue is notified of every webhook event stored; implemented by services.WebhookWorker
+type webhookQueue interface {
+	Notify()
+}
+
+// Handler serves the API. Sessions, goals and Strava connections are kept in stores that
+// can be swapped for in-memory ones; everything else comes from db.
 type Handler struct {
 	db            *database.DB
-	stravaService interface {
-		ProcessWebhookEvent(event models.WebhookEvent) error
-	}
+	sessions      database.SessionStore
+	goals         database.GoalStore
+	strava        database.StravaStore
+	stravaService stravaService
+	webhookQueue  webhookQueue
+	authSecret    string
+	keyring       *crypto.Keyring
 }
 
 func New(db *database.DB) *Handler {
-	return &Handler{db: db}
+	return &Handler{db: db, sessions: db, goals: db, strava: db}
 }
 
-func (h *Handler) SetStravaService(service interface {
-	ProcessWebhookEvent(event models.WebhookEvent) error
-}) {
+// NewWithStores returns a handler keeping sessions, goals and Strava connections in the
+// given stores rather than in db
+func NewWithStores(db *database.DB, sessions database.SessionStore, goals database.GoalStore, strava database.StravaStore) *Handler {
+	return &Handler{db: db, sessions: sessions, goals: goals, strava: strava}
+}
+
+func (h *Handler) SetStravaService(service stravaService) {
 	h.stravaService = service
 }
 
+func (h *Handler) SetWebhookQueue(queue webhookQueue) {
+	h.webhookQueue = queue
+}
+
+func (h *Handler) SetAuthSecret(secret string) {
+	h.authSecret = secret
+}
+
+func (h *Handler) SetKeyring(keyring *crypto.Keyring) {
+	h.keyring = keyring
+}
+
 func (h *Handler) CreateSession(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
 	var req models.CreateSessionRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		log.Printf("[ERROR] CreateSession: Failed to decode request body: %v", err)
@@ -36,25 +77,26 @@ func (h *Handler) CreateSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Distance <= 0 {
-		log.Printf("[WARN] CreateSession: Invalid distance: %f", req.Distance)
-		http.Error(w, "Distance must be greater than 0", http.StatusBadRequest)
+	if err := req.Validate(); err != nil {
+		log.Printf("[WARN] CreateSession: Invalid session: %v (distance=%f, duration=%d)", err, req.Distance, req.Duration)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if req.Duration <= 0 {
-		log.Printf("[WARN] CreateSession: Invalid duration: %d", req.Duration)
-		http.Error(w, "Duration must be greater than 0", http.StatusBadRequest)
-		return
-	}
-
-	session, err := h.db.CreateSession(req)
+	session, err := h.sessions.CreateSession(userID, req)
 	if err != nil {
 		log.Printf("[ERROR] CreateSession: Database error: %v", err)
 		http.Error(w, "Failed to create session", http.StatusInternalServerError)
 		return
 	}
 
+	// Matching is best-effort: the session is stored either way
+	if workout, err := h.sessions.MatchSession(session); err != nil {
+		log.Printf("[ERROR] CreateSession: Failed to match session id=%d to a planned workout: %v", session.ID, err)
+	} else if workout != nil {
+		log.Printf("[INFO] CreateSession: Matched session id=%d to planned workout id=%d (compliance %.0f%%)", session.ID, workout.ID, workout.Match.Compliance)
+	}
+
 	log.Printf("[INFO] CreateSession: Created session id=%d", session.ID)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -62,35 +104,21 @@ func (h *Handler) CreateSession(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
-	startDateStr := r.URL.Query().Get("start_date")
-	endDateStr := r.URL.Query().Get("end_date")
-
-	var startDate, endDate time.Time
-	var err error
+	userID := middleware.UserID(r.Context())
 
-	if startDateStr == "" {
-		startDate = time.Now().AddDate(0, -1, 0)
-	} else {
-		startDate, err = time.Parse("2006-01-02", startDateStr)
-		if err != nil {
-			log.Printf("[WARN] GetSessions: Invalid start_date format: %s, error: %v", startDateStr, err)
-			http.Error(w, "Invalid start_date format, use YYYY-MM-DD", http.StatusBadRequest)
-			return
-		}
+	query, err := parseSessionQuery(r)
+	if err != nil {
+		log.Printf("[WARN] GetSessions: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if endDateStr == "" {
-		endDate = time.Now()
-	} else {
-		endDate, err = time.Parse("2006-01-02", endDateStr)
-		if err != nil {
-			log.Printf("[WARN] GetSessions: Invalid end_date format: %s, error: %v", endDateStr, err)
-			http.Error(w, "Invalid end_date format, use YYYY-MM-DD", http.StatusBadRequest)
-			return
-		}
+	sessions, nextCursor, err := h.sessions.ListSessions(userID, query)
+	if err == database.ErrInvalidCursor {
+		log.Printf("[WARN] GetSessions: Invalid cursor: %s", query.Cursor)
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
 	}
-
-	sessions, err := h.db.GetSessions(startDate, endDate)
 	if err != nil {
 		log.Printf("[ERROR] GetSessions: Database error: %v", err)
 		http.Error(w, "Failed to get sessions", http.StatusInternalServerError)
@@ -101,12 +129,17 @@ func (h *Handler) GetSessions(w http.ResponseWriter, r *http.Request) {
 		sessions = []models.Session{}
 	}
 
-	log.Printf("[INFO] GetSessions: Retrieved %d sessions for period %s to %s", len(sessions), startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
+	log.Printf("[INFO] GetSessions: Retrieved %d sessions for period %s to %s", len(sessions), query.StartDate.Format("2006-01-02"), query.EndDate.Format("2006-01-02"))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(sessions)
+	json.NewEncoder(w).Encode(models.SessionPage{
+		Sessions:   sessions,
+		NextCursor: nextCursor,
+	})
 }
 
 func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -115,7 +148,7 @@ func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	session, err := h.db.GetSession(id)
+	session, err := h.sessions.GetSession(userID, id)
 	if err != nil {
 		log.Printf("[ERROR] GetSession: Database error for id=%d: %v", id, err)
 		http.Error(w, "Session not found", http.StatusNotFound)
@@ -128,6 +161,8 @@ func (h *Handler) GetSession(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) UpdateSession(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -143,19 +178,13 @@ func (h *Handler) UpdateSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Distance <= 0 {
-		log.Printf("[WARN] UpdateSession: Invalid distance for id=%d: %f", id, req.Distance)
-		http.Error(w, "Distance must be greater than 0", http.StatusBadRequest)
+	if err := req.Validate(); err != nil {
+		log.Printf("[WARN] UpdateSession: Invalid session for id=%d: %v (distance=%f, duration=%d)", id, err, req.Distance, req.Duration)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	if req.Duration <= 0 {
-		log.Printf("[WARN] UpdateSession: Invalid duration for id=%d: %d", id, req.Duration)
-		http.Error(w, "Duration must be greater than 0", http.StatusBadRequest)
-		return
-	}
-
-	session, err := h.db.UpdateSession(id, req)
+	session, err := h.sessions.UpdateSession(userID, id, req)
 	if err != nil {
 		log.Printf("[ERROR] UpdateSession: Database error for id=%d: %v", id, err)
 		http.Error(w, "Failed to update session", http.StatusInternalServerError)
@@ -166,3 +195,106 @@ func (h *Handler) UpdateSession(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(session)
 }
+
+// parseDateRange reads the start_date/end_date query parameters shared by session listings,
+// defaulting to the last month
+func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
+	startDateStr := r.URL.Query().Get("start_date")
+	endDateStr := r.URL.Query().Get("end_date")
+
+	startDate := time.Now().AddDate(0, -1, 0)
+	endDate := time.Now()
+
+	if startDateStr != "" {
+		d, err := time.Parse("2006-01-02", startDateStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid start_date format, use YYYY-MM-DD")
+		}
+		startDate = d
+	}
+
+	if endDateStr != "" {
+		d, err := time.Parse("2006-01-02", endDateStr)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid end_date format, use YYYY-MM-DD")
+		}
+		endDate = d
+	}
+
+	return startDate, endDate, nil
+}
+
+const (
+	defaultSessionLimit = 50
+	maxSessionLimit     = 200
+)
+
+// parseSessionQuery reads the listing parameters of GET /api/sessions
+func parseSessionQuery(r *http.Request) (models.SessionQuery, error) {
+	params := r.URL.Query()
+
+	startDate, endDate, err := parseDateRange(r)
+	if err != nil {
+		return models.SessionQuery{}, err
+	}
+
+	q := models.SessionQuery{
+		StartDate: startDate,
+		EndDate:   endDate,
+		Sort:      "date",
+		Order:     "desc",
+		Limit:     defaultSessionLimit,
+		Cursor:    params.Get("cursor"),
+		Source:    params.Get("source"),
+		Search:    strings.TrimSpace(params.Get("q")),
+	}
+
+	if v := params.Get("sort"); v != "" {
+		switch v {
+		case "date", "distance", "duration", "pace":
+			q.Sort = v
+		default:
+			return q, errors.New("Invalid sort, use date, distance, duration or pace")
+		}
+	}
+
+	if v := params.Get("order"); v != "" {
+		if v != "asc" && v != "desc" {
+			return q, errors.New("Invalid order, use asc or desc")
+		}
+		q.Order = v
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSessionLimit {
+			return q, fmt.Errorf("Invalid limit, use a number between 1 and %d", maxSessionLimit)
+		}
+		q.Limit = limit
+	}
+
+	if q.Source != "" {
+		switch q.Source {
+		case "manual", "strava", "gpx", "fit", "csv":
+		default:
+			return q, errors.New("Invalid source, use manual, strava, gpx, fit or csv")
+		}
+	}
+
+	for name, target := range map[string]**float64{
+		"min_distance": &q.MinDistance,
+		"max_distance": &q.MaxDistance,
+	} {
+		v := params.Get(name)
+		if v == "" {
+			continue
+		}
+		d, err := strconv.ParseFloat(v, 64)
+		if err != nil || d < 0 {
+			return q, fmt.Errorf("Invalid %s, use a non-negative number of km", name)
+		}
+		*target = &d
+	}
+
+	return q, nil
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thc/runna-backend/internal/fit"
+	"github.com/thc/runna-backend/internal/gpx"
+	"github.com/thc/runna-backend/internal/middleware"
+	"github.com/thc/runna-backend/internal/models"
+)
+
+const (
+	// maxImportSize bounds the size of uploaded activity files
+	maxImportSize = 20 << 20
+
+	// importDedupeWindow is how close two start times must be to count as the same run
+	importDedupeWindow = time.Minute
+)
+
+// ImportGPX creates a session, including its track, from an uploaded GPX file
+func (h *Handler) ImportGPX(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	file, notes, err := readImportFile(w, r)
+	if err != nil {
+		log.Printf("[WARN] ImportGPX: Failed to read upload: %v", err)
+		http.Error(w, "Invalid upload, send a GPX file in the 'file' form field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	track, err := gpx.Parse(file)
+	if err != nil {
+		log.Printf("[WARN] ImportGPX: Failed to parse GPX: %v", err)
+		http.Error(w, "Invalid GPX file", http.StatusBadRequest)
+		return
+	}
+
+	summary := track.Summarize()
+	if summary.StartTime.IsZero() || summary.MovingTime <= 0 {
+		log.Printf("[WARN] ImportGPX: GPX track has no usable timestamps")
+		http.Error(w, "GPX track must contain timestamps", http.StatusBadRequest)
+		return
+	}
+
+	if summary.Distance <= 0 {
+		log.Printf("[WARN] ImportGPX: GPX track has no distance")
+		http.Error(w, "GPX track must cover a distance greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	if notes == "" {
+		notes = track.Name
+	}
+
+	elevationGain := math.Round(summary.ElevationGain*10) / 10
+	session := models.Session{
+		UserID:        userID,
+		Date:          summary.StartTime,
+		Distance:      summary.Distance / 1000, // Convert meters to km
+		Duration:      summary.MovingTime,
+		Notes:         notes,
+		ElevationGain: &elevationGain,
+		Source:        "gpx",
+	}
+
+	points := make([]models.TrackPoint, len(track.Points))
+	for i, p := range track.Points {
+		points[i] = models.TrackPoint{
+			Latitude:  p.Latitude,
+			Longitude: p.Longitude,
+			Elevation: p.Elevation,
+			Time:      p.Time,
+		}
+	}
+
+	created, err := h.sessions.CreateSessionWithTrack(session, points)
+	if err != nil {
+		log.Printf("[ERROR] ImportGPX: Database error: %v", err)
+		http.Error(w, "Failed to import session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] ImportGPX: Created session id=%d with %d track points", created.ID, len(points))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// ImportFIT creates a session with laps and device records from an uploaded FIT activity file
+func (h *Handler) ImportFIT(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	file, notes, err := readImportFile(w, r)
+	if err != nil {
+		log.Printf("[WARN] ImportFIT: Failed to read upload: %v", err)
+		http.Error(w, "Invalid upload, send a FIT file in the 'file' form field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	activity, err := fit.Decode(file)
+	if err != nil {
+		log.Printf("[WARN] ImportFIT: Failed to decode FIT: %v", err)
+		http.Error(w, "Invalid FIT file", http.StatusBadRequest)
+		return
+	}
+
+	if activity.Sport != fit.SportRunning && activity.Sport != fit.SportGeneric {
+		log.Printf("[WARN] ImportFIT: Skipping non-running activity: sport=%d", activity.Sport)
+		http.Error(w, "Only running activities can be imported", http.StatusBadRequest)
+		return
+	}
+
+	duration := int(math.Round(activity.TimerTime))
+	if activity.Distance <= 0 || duration <= 0 {
+		log.Printf("[WARN] ImportFIT: Invalid totals: distance=%f, duration=%d", activity.Distance, duration)
+		http.Error(w, "FIT activity must have a distance and duration greater than 0", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := h.sessions.FindSessionByStartTime(userID, activity.StartTime, importDedupeWindow)
+	if err != nil {
+		log.Printf("[ERROR] ImportFIT: Database error: %v", err)
+		http.Error(w, "Failed to import session", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		log.Printf("[WARN] ImportFIT: Session id=%d already exists for start time %s", existing.ID, activity.StartTime)
+		http.Error(w, fmt.Sprintf("A session starting at this time already exists (id=%d)", existing.ID), http.StatusConflict)
+		return
+	}
+
+	session := models.Session{
+		UserID:        userID,
+		Date:          activity.StartTime,
+		Distance:      activity.Distance / 1000, // Convert meters to km
+		Duration:      duration,
+		Notes:         notes,
+		ElevationGain: activity.TotalAscent,
+		AvgHeartRate:  activity.AvgHeartRate,
+		MaxHeartRate:  activity.MaxHeartRate,
+		Source:        "fit",
+	}
+
+	laps := make([]models.Lap, len(activity.Laps))
+	for i, l := range activity.Laps {
+		laps[i] = models.Lap{
+			LapIndex:      i,
+			StartTime:     l.StartTime,
+			Distance:      l.Distance / 1000,
+			Duration:      int(math.Round(l.TimerTime)),
+			ElapsedTime:   int(math.Round(l.ElapsedTime)),
+			ElevationGain: l.TotalAscent,
+			AvgHeartRate:  l.AvgHeartRate,
+			MaxHeartRate:  l.MaxHeartRate,
+			AvgCadence:    l.AvgCadence,
+			AvgPower:      l.AvgPower,
+		}
+	}
+
+	records := make([]models.SessionRecord, len(activity.Records))
+	for i, rec := range activity.Records {
+		var distance *float64
+		if rec.Distance != nil {
+			km := *rec.Distance / 1000
+			distance = &km
+		}
+
+		records[i] = models.SessionRecord{
+			Time:      rec.Timestamp,
+			Latitude:  rec.Latitude,
+			Longitude: rec.Longitude,
+			Altitude:  rec.Altitude,
+			Distance:  distance,
+			Speed:     rec.Speed,
+			HeartRate: rec.HeartRate,
+			Cadence:   rec.Cadence,
+			Power:     rec.Power,
+		}
+	}
+
+	created, err := h.sessions.CreateSessionWithRecords(session, laps, records)
+	if err != nil {
+		log.Printf("[ERROR] ImportFIT: Database error: %v", err)
+		http.Error(w, "Failed to import session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] ImportFIT: Created session id=%d with %d laps and %d records", created.ID, len(laps), len(records))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// GetSessionTrack returns the recorded track points of a session
+func (h *Handler) GetSessionTrack(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] GetSessionTrack: Invalid session ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.sessions.GetSession(userID, id); err != nil {
+		log.Printf("[ERROR] GetSessionTrack: Database error for id=%d: %v", id, err)
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	points, err := h.sessions.GetTrackPoints(userID, id)
+	if err != nil {
+		log.Printf("[ERROR] GetSessionTrack: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to get track", http.StatusInternalServerError)
+		return
+	}
+
+	if points == nil {
+		points = []models.TrackPoint{}
+	}
+
+	log.Printf("[INFO] GetSessionTrack: Retrieved %d track points for session id=%d", len(points), id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(points)
+}
+
+// GetSessionLaps returns the device-recorded laps of a session
+func (h *Handler) GetSessionLaps(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] GetSessionLaps: Invalid session ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.sessions.GetSession(userID, id); err != nil {
+		log.Printf("[ERROR] GetSessionLaps: Database error for id=%d: %v", id, err)
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	laps, err := h.sessions.GetLaps(userID, id)
+	if err != nil {
+		log.Printf("[ERROR] GetSessionLaps: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to get laps", http.StatusInternalServerError)
+		return
+	}
+
+	if laps == nil {
+		laps = []models.Lap{}
+	}
+
+	log.Printf("[INFO] GetSessionLaps: Retrieved %d laps for session id=%d", len(laps), id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(laps)
+}
+
+// GetSessionRecords returns the per-second device records of a session
+func (h *Handler) GetSessionRecords(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] GetSessionRecords: Invalid session ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.sessions.GetSession(userID, id); err != nil {
+		log.Printf("[ERROR] GetSessionRecords: Database error for id=%d: %v", id, err)
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	records, err := h.sessions.GetSessionRecords(userID, id)
+	if err != nil {
+		log.Printf("[ERROR] GetSessionRecords: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to get records", http.StatusInternalServerError)
+		return
+	}
+
+	if records == nil {
+		records = []models.SessionRecord{}
+	}
+
+	log.Printf("[INFO] GetSessionRecords: Retrieved %d records for session id=%d", len(records), id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// readImportFile returns the uploaded file from a multipart "file" field, or the raw
+// request body for non-multipart uploads, along with the optional "notes" form value
+func readImportFile(w http.ResponseWriter, r *http.Request) (io.ReadCloser, string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.Body, r.URL.Query().Get("notes"), nil
+	}
+
+	if err := r.ParseMultipartForm(maxImportSize); err != nil {
+		return nil, "", err
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+
+	return file, strings.TrimSpace(r.FormValue("notes")), nil
+}
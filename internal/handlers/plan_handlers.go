@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thc/runna-backend/internal/middleware"
+	"github.com/thc/runna-backend/internal/models"
+	"github.com/thc/runna-backend/internal/plans"
+)
+
+// buildPlan turns a plan request into the plan to store and, for race plans, its generated workouts
+func buildPlan(userID int64, req models.CreatePlanRequest) (models.TrainingPlan, []models.PlannedWorkoutRequest, error) {
+	start := time.Now()
+	if req.StartDate != "" {
+		start, _ = time.Parse("2006-01-02", req.StartDate)
+	}
+
+	plan := models.TrainingPlan{
+		UserID:       userID,
+		Name:         strings.TrimSpace(req.Name),
+		RaceDistance: req.RaceDistance,
+		RaceDate:     req.RaceDate,
+		StartDate:    start.Format("2006-01-02"),
+		WeeklyVolume: req.WeeklyVolume,
+	}
+
+	if plan.Name == "" {
+		plan.Name = plans.DefaultName(req.RaceDistance)
+	}
+
+	if req.RaceDistance == "" {
+		return plan, nil, nil
+	}
+
+	raceDate, _ := time.Parse("2006-01-02", req.RaceDate)
+	generated, err := plans.Generate(req.RaceDistance, raceDate, start, req.WeeklyVolume)
+	if err != nil {
+		return plan, nil, err
+	}
+	plan.StartDate = generated.StartDate.Format("2006-01-02")
+
+	return plan, generated.Workouts, nil
+}
+
+// CreatePlan creates a training plan, generating its workouts when a race distance is given
+func (h *Handler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	var req models.CreatePlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] CreatePlan: Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		log.Printf("[WARN] CreatePlan: Invalid plan: %v (race=%s, date=%s)", err, req.RaceDistance, req.RaceDate)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, workouts, err := buildPlan(userID, req)
+	if err != nil {
+		log.Printf("[WARN] CreatePlan: Failed to generate plan: %v", err)
+		http.Error(w, "Cannot generate plan: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	created, err := h.db.CreatePlan(plan, workouts)
+	if err != nil {
+		log.Printf("[ERROR] CreatePlan: Database error: %v", err)
+		http.Error(w, "Failed to create plan", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] CreatePlan: Created plan id=%d with %d workouts", created.ID, len(created.Workouts))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// GetPlans lists the user's training plans
+func (h *Handler) GetPlans(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	list, err := h.db.GetPlans(userID)
+	if err != nil {
+		log.Printf("[ERROR] GetPlans: Database error: %v", err)
+		http.Error(w, "Failed to get plans", http.StatusInternalServerError)
+		return
+	}
+
+	if list == nil {
+		list = []models.TrainingPlan{}
+	}
+
+	log.Printf("[INFO] GetPlans: Retrieved %d plans", len(list))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetPlan returns a training plan with its workouts
+func (h *Handler) GetPlan(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] GetPlan: Invalid plan ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
+		return
+	}
+
+	plan, err := h.db.GetPlan(userID, id)
+	if err != nil {
+		log.Printf("[ERROR] GetPlan: Database error for id=%d: %v", id, err)
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("[INFO] GetPlan: Retrieved plan id=%d", id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// UpdatePlan changes a training plan. Race plans are regenerated, replacing their workouts.
+func (h *Handler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] UpdatePlan: Invalid plan ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.CreatePlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] UpdatePlan: Failed to decode request body for id=%d: %v", id, err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		log.Printf("[WARN] UpdatePlan: Invalid plan for id=%d: %v (race=%s, date=%s)", id, err, req.RaceDistance, req.RaceDate)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	plan, workouts, err := buildPlan(userID, req)
+	if err != nil {
+		log.Printf("[WARN] UpdatePlan: Failed to generate plan for id=%d: %v", id, err)
+		http.Error(w, "Cannot generate plan: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	updated, err := h.db.UpdatePlan(userID, id, plan, workouts)
+	if err == sql.ErrNoRows {
+		log.Printf("[WARN] UpdatePlan: Plan not found id=%d", id)
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] UpdatePlan: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to update plan", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] UpdatePlan: Updated plan id=%d", id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DeletePlan removes a training plan and its workouts
+func (h *Handler) DeletePlan(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] DeletePlan: Invalid plan ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.DeletePlan(userID, id); err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("[WARN] DeletePlan: Plan not found id=%d", id)
+			http.Error(w, "Plan not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[ERROR] DeletePlan: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to delete plan", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] DeletePlan: Deleted plan id=%d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parsePlanWorkoutIDs reads the plan and workout IDs of a workout route
+func parsePlanWorkoutIDs(r *http.Request) (int, int, error) {
+	planID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return 0, 0, errors.New("Invalid plan ID")
+	}
+
+	workoutID, err := strconv.Atoi(r.PathValue("workoutId"))
+	if err != nil {
+		return 0, 0, errors.New("Invalid workout ID")
+	}
+
+	return planID, workoutID, nil
+}
+
+// CreatePlannedWorkout adds a workout to a training plan
+func (h *Handler) CreatePlannedWorkout(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	planID, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] CreatePlannedWorkout: Invalid plan ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.PlannedWorkoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] CreatePlannedWorkout: Failed to decode request body: %v", err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		log.Printf("[WARN] CreatePlannedWorkout: Invalid workout for plan id=%d: %v", planID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workout, err := h.db.CreatePlannedWorkout(userID, planID, req)
+	if err == sql.ErrNoRows {
+		log.Printf("[WARN] CreatePlannedWorkout: Plan not found id=%d", planID)
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] CreatePlannedWorkout: Database error for plan id=%d: %v", planID, err)
+		http.Error(w, "Failed to create workout", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] CreatePlannedWorkout: Created workout id=%d in plan id=%d", workout.ID, planID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(workout)
+}
+
+// UpdatePlannedWorkout changes a workout of a training plan
+func (h *Handler) UpdatePlannedWorkout(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	planID, workoutID, err := parsePlanWorkoutIDs(r)
+	if err != nil {
+		log.Printf("[WARN] UpdatePlannedWorkout: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req models.PlannedWorkoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Printf("[ERROR] UpdatePlannedWorkout: Failed to decode request body for id=%d: %v", workoutID, err)
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		log.Printf("[WARN] UpdatePlannedWorkout: Invalid workout for id=%d: %v", workoutID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	workout, err := h.db.UpdatePlannedWorkout(userID, planID, workoutID, req)
+	if err == sql.ErrNoRows {
+		log.Printf("[WARN] UpdatePlannedWorkout: Workout not found id=%d in plan id=%d", workoutID, planID)
+		http.Error(w, "Workout not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] UpdatePlannedWorkout: Database error for id=%d: %v", workoutID, err)
+		http.Error(w, "Failed to update workout", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] UpdatePlannedWorkout: Updated workout id=%d", workoutID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workout)
+}
+
+// DeletePlannedWorkout removes a workout from a training plan
+func (h *Handler) DeletePlannedWorkout(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	planID, workoutID, err := parsePlanWorkoutIDs(r)
+	if err != nil {
+		log.Printf("[WARN] DeletePlannedWorkout: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.db.DeletePlannedWorkout(userID, planID, workoutID); err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("[WARN] DeletePlannedWorkout: Workout not found id=%d in plan id=%d", workoutID, planID)
+			http.Error(w, "Workout not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[ERROR] DeletePlannedWorkout: Database error for id=%d: %v", workoutID, err)
+		http.Error(w, "Failed to delete workout", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] DeletePlannedWorkout: Deleted workout id=%d", workoutID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetScheduledWorkouts lists the user's planned workouts across all plans for a range of days,
+// defaulting to the coming week
+func (h *Handler) GetScheduledWorkouts(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	from := time.Now().Format("2006-01-02")
+	to := time.Now().AddDate(0, 0, 6).Format("2006-01-02")
+
+	if v := r.URL.Query().Get("start_date"); v != "" {
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			log.Printf("[WARN] GetScheduledWorkouts: Invalid start_date: %s", v)
+			http.Error(w, "Invalid start_date format, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		from = v
+	}
+
+	if v := r.URL.Query().Get("end_date"); v != "" {
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			log.Printf("[WARN] GetScheduledWorkouts: Invalid end_date: %s", v)
+			http.Error(w, "Invalid end_date format, use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		to = v
+	}
+
+	workouts, err := h.db.GetScheduledWorkouts(userID, from, to)
+	if err != nil {
+		log.Printf("[ERROR] GetScheduledWorkouts: Database error: %v", err)
+		http.Error(w, "Failed to get workouts", http.StatusInternalServerError)
+		return
+	}
+
+	if workouts == nil {
+		workouts = []models.PlannedWorkout{}
+	}
+
+	log.Printf("[INFO] GetScheduledWorkouts: Retrieved %d workouts for %s to %s", len(workouts), from, to)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workouts)
+}
+
+// GetPlanAdherence reports week by week how many of a plan's due workouts were completed and
+// how closely the matched sessions followed them
+func (h *Handler) GetPlanAdherence(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] GetPlanAdherence: Invalid plan ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid plan ID", http.StatusBadRequest)
+		return
+	}
+
+	adherence, err := h.db.GetPlanAdherence(userID, id, time.Now().Format("2006-01-02"))
+	if err == sql.ErrNoRows {
+		log.Printf("[WARN] GetPlanAdherence: Plan not found id=%d", id)
+		http.Error(w, "Plan not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] GetPlanAdherence: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to get plan adherence", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] GetPlanAdherence: Plan id=%d has %d of %d due workouts completed", id, adherence.Completed, adherence.Due)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(adherence)
+}
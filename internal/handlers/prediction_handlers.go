@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thc/runna-backend/internal/middleware"
+)
+
+const (
+	// defaultPredictionWeeks is how many weeks of prediction history are returned by default
+	defaultPredictionWeeks = 26
+	// maxPredictionWeeks bounds the prediction history of one request
+	maxPredictionWeeks = 104
+)
+
+// GetPredictions returns predicted race times from the user's best recent efforts, the
+// sessions they are based on and how the predictions evolved week by week
+func (h *Handler) GetPredictions(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	weeks := defaultPredictionWeeks
+	if v := r.URL.Query().Get("weeks"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPredictionWeeks {
+			log.Printf("[WARN] GetPredictions: Invalid weeks: %s", v)
+			http.Error(w, "Invalid weeks, use a number from 1 to 104", http.StatusBadRequest)
+			return
+		}
+		weeks = n
+	}
+
+	result, err := h.db.GetPredictions(userID, time.Now(), weeks)
+	if err != nil {
+		log.Printf("[ERROR] GetPredictions: Database error: %v", err)
+		http.Error(w, "Failed to get predictions", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] GetPredictions: Predicted %d races from %d sessions", len(result.Races), len(result.Evidence))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
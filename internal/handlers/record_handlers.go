@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/thc/runna-backend/internal/middleware"
+)
+
+// GetRecords returns the user's personal records with the sessions they came from and their history
+func (h *Handler) GetRecords(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	records, err := h.db.GetPersonalRecords(userID)
+	if err != nil {
+		log.Printf("[ERROR] GetRecords: Database error: %v", err)
+		http.Error(w, "Failed to get records", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] GetRecords: Retrieved records for %d categories", len(records))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
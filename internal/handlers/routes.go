@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Route is an API endpoint: a ServeMux pattern and the handler serving it
+type Route struct {
+	Pattern string
+	Handler http.HandlerFunc
+}
+
+// Routes lists every API endpoint. User routes are wrapped in requireAuth and admin routes in
+// requireAdmin; the admin routes are left out when requireAdmin is nil.
+func (h *Handler) Routes(requireAuth, requireAdmin func(http.HandlerFunc) http.HandlerFunc) []Route {
+	routes := []Route{
+		// Auth routes
+		{"POST /api/auth/signup", h.Signup},
+		{"POST /api/auth/login", h.Login},
+		{"GET /api/auth/me", requireAuth(h.GetCurrentUser)},
+
+		// Session routes
+		{"POST /api/sessions", requireAuth(h.CreateSession)},
+		{"GET /api/sessions", requireAuth(h.GetSessions)},
+		{"GET /api/sessions/{id}", requireAuth(h.GetSession)},
+		{"PUT /api/sessions/{id}", requireAuth(h.UpdateSession)},
+		{"DELETE /api/sessions/{id}", requireAuth(h.DeleteSession)},
+		{"GET /api/sessions/trash", requireAuth(h.GetTrash)},
+		{"POST /api/sessions/{id}/restore", requireAuth(h.RestoreSession)},
+		{"GET /api/sessions/{id}/track", requireAuth(h.GetSessionTrack)},
+		{"GET /api/sessions/{id}/laps", requireAuth(h.GetSessionLaps)},
+		{"GET /api/sessions/{id}/records", requireAuth(h.GetSessionRecords)},
+		{"POST /api/sessions/import/gpx", requireAuth(h.ImportGPX)},
+		{"POST /api/sessions/import/fit", requireAuth(h.ImportFIT)},
+		{"POST /api/sessions/import/csv", requireAuth(h.ImportCSV)},
+		{"GET /api/sessions/export.csv", requireAuth(h.ExportCSV)},
+
+		// Goal routes
+		{"POST /api/goals", requireAuth(h.CreateGoal)},
+		{"GET /api/goals", requireAuth(h.GetGoals)},
+		{"GET /api/goals/{id}", requireAuth(h.GetGoal)},
+		{"PUT /api/goals/{id}", requireAuth(h.UpdateGoal)},
+		{"DELETE /api/goals/{id}", requireAuth(h.DeleteGoal)},
+		{"GET /api/goals/{id}/history", requireAuth(h.GetGoalHistory)},
+		{"GET /api/goals/{id}/periods", requireAuth(h.GetGoalPeriods)},
+
+		// Personal record routes
+		{"GET /api/records", requireAuth(h.GetRecords)},
+
+		// Stats routes
+		{"GET /api/stats/summary", requireAuth(h.GetStatsSummary)},
+		{"GET /api/stats/training-load", requireAuth(h.GetTrainingLoad)},
+
+		// Race prediction routes
+		{"GET /api/predictions", requireAuth(h.GetPredictions)},
+
+		// Training plan routes
+		{"POST /api/plans", requireAuth(h.CreatePlan)},
+		{"GET /api/plans", requireAuth(h.GetPlans)},
+		{"GET /api/plans/{id}", requireAuth(h.GetPlan)},
+		{"PUT /api/plans/{id}", requireAuth(h.UpdatePlan)},
+		{"DELETE /api/plans/{id}", requireAuth(h.DeletePlan)},
+		{"GET /api/plans/{id}/adherence", requireAuth(h.GetPlanAdherence)},
+		{"POST /api/plans/{id}/workouts", requireAuth(h.CreatePlannedWorkout)},
+		{"PUT /api/plans/{id}/workouts/{workoutId}", requireAuth(h.UpdatePlannedWorkout)},
+		{"DELETE /api/plans/{id}/workouts/{workoutId}", requireAuth(h.DeletePlannedWorkout)},
+		{"GET /api/workouts", requireAuth(h.GetScheduledWorkouts)},
+
+		// Strava webhook routes
+		{"GET /api/webhooks/strava", h.VerifyWebhook},
+		{"POST /api/webhooks/strava", h.ReceiveWebhook},
+
+		// Strava OAuth routes
+		{"POST /api/strava/connect", requireAuth(h.ConnectStrava)},
+		{"GET /api/strava/status", requireAuth(h.GetStravaStatus)},
+		{"POST /api/strava/sync", requireAuth(h.SyncStrava)},
+		{"DELETE /api/strava/disconnect", requireAuth(h.DisconnectStrava)},
+
+		{"GET /health", Health},
+	}
+
+	if requireAdmin != nil {
+		routes = append(routes,
+			Route{"GET /api/admin/webhooks", requireAdmin(h.GetWebhookEvents)},
+			Route{"POST /api/admin/webhooks/{id}/replay", requireAdmin(h.ReplayWebhookEvent)},
+		)
+	}
+
+	return routes
+}
+
+// Health reports that the server is up
+func Health(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/auth"
+	"github.com/thc/runna-backend/internal/database"
+	"github.com/thc/runna-backend/internal/middleware"
+	"github.com/thc/runna-backend/internal/models"
+	"github.com/thc/runna-backend/internal/services"
+	"github.com/thc/runna-backend/internal/stravatest"
+)
+
+const (
+	testAuthSecret  = "abcdef0123456789abcdef0123456789"
+	testAdminToken  = "admin-token"
+	testVerifyToken = "verify-token"
+)
+
+const testGPX = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="test" xmlns="http://www.topografix.com/GPX/1/1">
+  <trk>
+    <name>Track Run</name>
+    <trkseg>
+      <trkpt lat="55.0000" lon="12.0000"><ele>10</ele><time>2024-01-15T10:00:00Z</time></trkpt>
+      <trkpt lat="55.0009" lon="12.0000"><ele>12</ele><time>2024-01-15T10:00:30Z</time></trkpt>
+      <trkpt lat="55.0018" lon="12.0000"><ele>16</ele><time>2024-01-15T10:01:00Z</time></trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+// newTestDB opens a fresh, migrated database in a temporary directory
+func newTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	db, err := database.New("file:" + filepath.Join(t.TempDir(), "runna.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Init(); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	return db
+}
+
+// routeTest serves every route the way cmd/api does, keeping sessions, goals and Strava
+// connections in memory and everything else in a fresh database
+type routeTest struct {
+	strava *stravatest.Server
+	db     *database.DB
+	store  *database.MemoryStore
+	routes []Route
+	mux    *http.ServeMux
+	userID int64
+	token  string
+}
+
+func newRouteTest(t *testing.T) *routeTest {
+	t.Helper()
+
+	t.Setenv("STRAVA_CLIENT_ID", "client")
+	t.Setenv("STRAVA_CLIENT_SECRET", "secret")
+	t.Setenv("STRAVA_VERIFY_TOKEN", testVerifyToken)
+
+	strava := stravatest.NewServer("client", "secret")
+	t.Cleanup(strava.Close)
+
+	db := newTestDB(t)
+	store := database.NewMemoryStore()
+
+	h := NewWithStores(db, store, store, store)
+	keyring := newTestKeyring(t)
+	h.SetAuthSecret(testAuthSecret)
+	h.SetKeyring(keyring)
+	h.SetStravaService(services.NewStravaService(store, services.NewStravaClient(strava.APIBase(), strava.TokenURL()), keyring))
+
+	rt := &routeTest{strava: strava, db: db, store: store, mux: http.NewServeMux()}
+	rt.routes = h.Routes(middleware.Auth(testAuthSecret), middleware.AdminToken(testAdminToken))
+	for _, route := range rt.routes {
+		rt.mux.HandleFunc(route.Pattern, route.Handler)
+	}
+
+	user, err := db.CreateUser("runner@example.com", "Runner", "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	rt.userID = user.ID
+
+	rt.token, _, err = auth.IssueToken(user.ID, testAuthSecret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rt
+}
+
+// Callers of a route
+const (
+	anonymous = iota
+	user
+	admin
+)
+
+type routeCase struct {
+	name    string
+	route   string // the pattern expected to serve the request
+	path    string
+	as      int
+	body    string
+	want    int
+	wantHas string // a substring of the response body, if set
+	after   func(t *testing.T)
+}
+
+func (rt *routeTest) serve(t *testing.T, tc routeCase) {
+	t.Helper()
+
+	method, _, _ := strings.Cut(tc.route, " ")
+	req := httptest.NewRequest(method, tc.path, strings.NewReader(tc.body))
+	switch tc.as {
+	case user:
+		req.Header.Set("Authorization", "Bearer "+rt.token)
+	case admin:
+		req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	}
+
+	if _, pattern := rt.mux.Handler(req); pattern != tc.route {
+		t.Fatalf("Expected %s %s to be served by %q, got %q", method, tc.path, tc.route, pattern)
+	}
+
+	rec := httptest.NewRecorder()
+	rt.mux.ServeHTTP(rec, req)
+	if rec.Code != tc.want {
+		t.Fatalf("Expected %d, got %d: %s", tc.want, rec.Code, rec.Body.String())
+	}
+	if tc.wantHas != "" && !strings.Contains(rec.Body.String(), tc.wantHas) {
+		t.Errorf("Expected the response to contain %q, got %s", tc.wantHas, rec.Body.String())
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	rt := newRouteTest(t)
+	now := time.Now()
+
+	// Seed data for the routes that read or change existing rows
+	session, err := rt.store.CreateSession(rt.userID, models.CreateSessionRequest{Date: now.AddDate(0, 0, -1), Distance: 10, Duration: 3000, Notes: "Long run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracked, err := rt.store.CreateSessionWithTrack(models.Session{UserID: rt.userID, Date: now.AddDate(0, 0, -2), Distance: 5, Duration: 1500, Source: "gpx"}, []models.TrackPoint{{Latitude: 55, Longitude: 12}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err := rt.store.CreateSessionWithRecords(models.Session{UserID: rt.userID, Date: now.AddDate(0, 0, -3), Distance: 5, Duration: 1500, Source: "fit"}, []models.Lap{{LapIndex: 0, Distance: 5}}, []models.SessionRecord{{Time: now}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	goal, err := rt.store.CreateGoal(rt.userID, models.CreateGoalRequest{GoalType: models.GoalTypeDistance, TargetValue: 100, StartDate: now.AddDate(0, 0, -7), EndDate: now.AddDate(0, 0, 7)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Records, stats, training load, predictions and plans read sessions from the database
+	// rather than the store: a 10k run long enough ago to be left alone by the routes that
+	// change data, and today's run for the plan's workout and the predictions
+	raced, err := rt.db.CreateSession(rt.userID, models.CreateSessionRequest{Date: time.Date(2024, 3, 2, 7, 0, 0, 0, time.UTC), Distance: 10, Duration: 2700, Notes: "Parkrun"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranToday, err := rt.db.CreateSession(rt.userID, models.CreateSessionRequest{Date: now, Distance: 8, Duration: 2880, Notes: "Easy run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := rt.db.CreatePlan(models.TrainingPlan{UserID: rt.userID, Name: "Base", StartDate: now.Format("2006-01-02")}, []models.PlannedWorkoutRequest{{Date: now.Format("2006-01-02"), WorkoutType: models.WorkoutEasy, Distance: 8}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadEvent := rt.deadWebhookEvent(t)
+
+	waitForSync := func(t *testing.T) {
+		waitFor(t, "the sync", func() bool {
+			conn, err := rt.store.GetStravaConnection(rt.userID)
+			return err == nil && conn != nil && conn.Sync.Status == models.StravaSyncCompleted
+		})
+	}
+
+	sessionPath := fmt.Sprintf("/api/sessions/%d", session.ID)
+	goalPath := fmt.Sprintf("/api/goals/%d", goal.ID)
+	planPath := fmt.Sprintf("/api/plans/%d", plan.ID)
+	workoutPath := fmt.Sprintf("%s/workouts/%d", planPath, plan.Workouts[0].ID)
+	goalBody := fmt.Sprintf(`{"goal_type":"distance","target_value":50,"start_date":%q,"end_date":%q}`, now.AddDate(0, 0, -7).Format(time.RFC3339), now.AddDate(0, 0, 7).Format(time.RFC3339))
+	sessionBody := fmt.Sprintf(`{"date":%q,"distance":5,"duration":1500,"notes":"Easy run"}`, now.Add(-time.Hour).Format(time.RFC3339))
+	today := now.Format("2006-01-02")
+
+	// Cases run in order against the same data
+	tests := []routeCase{
+		{name: "Health", route: "GET /health", path: "/health", want: http.StatusOK, wantHas: `"ok"`},
+
+		{name: "Signup", route: "POST /api/auth/signup", path: "/api/auth/signup", body: `{"email":"new@example.com","password":"password1","name":"New"}`, want: http.StatusCreated, wantHas: "token"},
+		{name: "Signup taken email", route: "POST /api/auth/signup", path: "/api/auth/signup", body: `{"email":"new@example.com","password":"password1"}`, want: http.StatusConflict},
+		{name: "Login", route: "POST /api/auth/login", path: "/api/auth/login", body: `{"email":"new@example.com","password":"password1"}`, want: http.StatusOK, wantHas: "token"},
+		{name: "Login wrong password", route: "POST /api/auth/login", path: "/api/auth/login", body: `{"email":"new@example.com","password":"wrong-password"}`, want: http.StatusUnauthorized},
+		{name: "Current user", route: "GET /api/auth/me", path: "/api/auth/me", as: user, want: http.StatusOK, wantHas: "runner@example.com"},
+		{name: "Current user without token", route: "GET /api/auth/me", path: "/api/auth/me", want: http.StatusUnauthorized},
+
+		{name: "Create session", route: "POST /api/sessions", path: "/api/sessions", as: user, body: sessionBody, want: http.StatusCreated, wantHas: "Easy run"},
+		{name: "Create invalid session", route: "POST /api/sessions", path: "/api/sessions", as: user, body: `{"distance":-1}`, want: http.StatusBadRequest},
+		{name: "List sessions", route: "GET /api/sessions", path: "/api/sessions?sort=distance&limit=1", as: user, want: http.StatusOK, wantHas: "Long run"},
+		{name: "List sessions bad cursor", route: "GET /api/sessions", path: "/api/sessions?cursor=nope", as: user, want: http.StatusBadRequest},
+		{name: "Get session", route: "GET /api/sessions/{id}", path: sessionPath, as: user, want: http.StatusOK, wantHas: "Long run"},
+		{name: "Get missing session", route: "GET /api/sessions/{id}", path: "/api/sessions/999999", as: user, want: http.StatusNotFound},
+		{name: "Update session", route: "PUT /api/sessions/{id}", path: sessionPath, as: user, body: strings.Replace(sessionBody, "Easy run", "Edited run", 1), want: http.StatusOK, wantHas: "Edited run"},
+		{name: "Session track", route: "GET /api/sessions/{id}/track", path: fmt.Sprintf("/api/sessions/%d/track", tracked.ID), as: user, want: http.StatusOK, wantHas: "55"},
+		{name: "Session laps", route: "GET /api/sessions/{id}/laps", path: fmt.Sprintf("/api/sessions/%d/laps", recorded.ID), as: user, want: http.StatusOK, wantHas: "lap_index"},
+		{name: "Session records", route: "GET /api/sessions/{id}/records", path: fmt.Sprintf("/api/sessions/%d/records", recorded.ID), as: user, want: http.StatusOK, wantHas: "time"},
+		{name: "Delete session", route: "DELETE /api/sessions/{id}", path: sessionPath, as: user, want: http.StatusNoContent},
+		{name: "Delete deleted session", route: "DELETE /api/sessions/{id}", path: sessionPath, as: user, want: http.StatusNotFound},
+		{name: "Trash", route: "GET /api/sessions/trash", path: "/api/sessions/trash", as: user, want: http.StatusOK, wantHas: "Edited run"},
+		{name: "Restore session", route: "POST /api/sessions/{id}/restore", path: sessionPath + "/restore", as: user, want: http.StatusOK, wantHas: "Edited run"},
+		{name: "Restore active session", route: "POST /api/sessions/{id}/restore", path: sessionPath + "/restore", as: user, want: http.StatusNotFound},
+		{name: "Import GPX", route: "POST /api/sessions/import/gpx", path: "/api/sessions/import/gpx", as: user, body: testGPX, want: http.StatusCreated, wantHas: "Track Run"},
+		{name: "Import invalid FIT", route: "POST /api/sessions/import/fit", path: "/api/sessions/import/fit", as: user, body: "not a fit file", want: http.StatusBadRequest},
+		{name: "Import CSV", route: "POST /api/sessions/import/csv", path: "/api/sessions/import/csv", as: user, body: "date,distance,duration,notes\n2024-02-01,5,25:00,From a spreadsheet\n", want: http.StatusCreated, wantHas: `"imported":1`},
+		{name: "Export CSV", route: "GET /api/sessions/export.csv", path: "/api/sessions/export.csv?start_date=2024-01-01", as: user, want: http.StatusOK, wantHas: "From a spreadsheet"},
+
+		{name: "Create goal", route: "POST /api/goals", path: "/api/goals", as: user, body: goalBody, want: http.StatusCreated},
+		{name: "Create invalid goal", route: "POST /api/goals", path: "/api/goals", as: user, body: `{"target_value":-5}`, want: http.StatusBadRequest},
+		{name: "Create goal without dates", route: "POST /api/goals", path: "/api/goals", as: user, body: `{"goal_type":"distance","target_value":50}`, want: http.StatusBadRequest, wantHas: "required"},
+		{name: "Create recurring goal far in the past", route: "POST /api/goals", path: "/api/goals", as: user, body: `{"goal_type":"run_count","target_value":1,"start_date":"2020-01-01T00:00:00Z","end_date":"2020-01-01T23:59:59Z","recurrence":"custom","recurrence_days":1}`, want: http.StatusBadRequest, wantHas: "one period"},
+		{name: "List goals", route: "GET /api/goals", path: "/api/goals", as: user, want: http.StatusOK, wantHas: "progress_percentage"},
+		{name: "Get goal", route: "GET /api/goals/{id}", path: goalPath, as: user, want: http.StatusOK, wantHas: `"current_value":20`},
+		{name: "Get missing goal", route: "GET /api/goals/{id}", path: "/api/goals/999999", as: user, want: http.StatusNotFound},
+		{name: "Update goal", route: "PUT /api/goals/{id}", path: goalPath, as: user, body: goalBody, want: http.StatusOK, wantHas: `"target_value":50`},
+		{name: "Goal history", route: "GET /api/goals/{id}/history", path: goalPath + "/history", as: user, want: http.StatusOK},
+		{name: "Goal periods", route: "GET /api/goals/{id}/periods", path: goalPath + "/periods", as: user, want: http.StatusOK},
+		{name: "Delete goal", route: "DELETE /api/goals/{id}", path: goalPath, as: user, want: http.StatusNoContent},
+		{name: "Delete missing goal", route: "DELETE /api/goals/{id}", path: goalPath, as: user, want: http.StatusNotFound},
+
+		{name: "Records", route: "GET /api/records", path: "/api/records", as: user, want: http.StatusOK, wantHas: fmt.Sprintf(`"category":"10k","session_id":%d,"distance":10,"duration":2700`, raced.ID)},
+		{name: "Stats summary", route: "GET /api/stats/summary", path: "/api/stats/summary?period=month&from=2024-03-01&to=2024-03-31", as: user, want: http.StatusOK, wantHas: `"total_distance":10,"total_duration":2700,"run_count":1`},
+		{name: "Training load", route: "GET /api/stats/training-load", path: "/api/stats/training-load?from=2024-03-01&to=2024-03-07", as: user, want: http.StatusOK, wantHas: fmt.Sprintf(`{"session_id":%d,"date":"2024-03-02"`, raced.ID)},
+		{name: "Predictions", route: "GET /api/predictions", path: "/api/predictions", as: user, want: http.StatusOK, wantHas: `"race":"5k"`},
+
+		{name: "Create plan", route: "POST /api/plans", path: "/api/plans", as: user, body: `{"name":"Build"}`, want: http.StatusCreated, wantHas: "Build"},
+		{name: "List plans", route: "GET /api/plans", path: "/api/plans", as: user, want: http.StatusOK, wantHas: "Base"},
+		{name: "Get plan", route: "GET /api/plans/{id}", path: planPath, as: user, want: http.StatusOK, wantHas: fmt.Sprintf(`"session_id":%d`, ranToday.ID)},
+		{name: "Update plan", route: "PUT /api/plans/{id}", path: planPath, as: user, body: `{"name":"Base block","start_date":"` + today + `"}`, want: http.StatusOK, wantHas: "Base block"},
+		{name: "Plan adherence", route: "GET /api/plans/{id}/adherence", path: planPath + "/adherence", as: user, want: http.StatusOK, wantHas: `"completed":1`},
+		{name: "Add workout", route: "POST /api/plans/{id}/workouts", path: planPath + "/workouts", as: user, body: `{"date":"` + today + `","workout_type":"tempo","distance":6}`, want: http.StatusCreated, wantHas: "tempo"},
+		{name: "Update workout", route: "PUT /api/plans/{id}/workouts/{workoutId}", path: workoutPath, as: user, body: `{"date":"` + today + `","workout_type":"long","distance":12}`, want: http.StatusOK, wantHas: "long"},
+		{name: "Scheduled workouts", route: "GET /api/workouts", path: "/api/workouts?start_date=" + today + "&end_date=" + today, as: user, want: http.StatusOK, wantHas: "tempo"},
+		{name: "Delete workout", route: "DELETE /api/plans/{id}/workouts/{workoutId}", path: workoutPath, as: user, want: http.StatusNoContent},
+		{name: "Delete plan", route: "DELETE /api/plans/{id}", path: planPath, as: user, want: http.StatusNoContent},
+		{name: "Get deleted plan", route: "GET /api/plans/{id}", path: planPath, as: user, want: http.StatusNotFound},
+
+		{name: "Verify webhook", route: "GET /api/webhooks/strava", path: "/api/webhooks/strava?hub.mode=subscribe&hub.verify_token=" + testVerifyToken + "&hub.challenge=abc", want: http.StatusOK, wantHas: "abc"},
+		{name: "Verify webhook wrong token", route: "GET /api/webhooks/strava", path: "/api/webhooks/strava?hub.mode=subscribe&hub.verify_token=nope&hub.challenge=abc", want: http.StatusForbidden},
+		{name: "Receive webhook", route: "POST /api/webhooks/strava", path: "/api/webhooks/strava", body: `{"object_type":"activity","aspect_type":"create","object_id":1,"owner_id":1001}`, want: http.StatusOK, wantHas: "EVENT_RECEIVED"},
+		{name: "Received webhook queued", route: "GET /api/admin/webhooks", path: "/api/admin/webhooks?status=pending", as: admin, want: http.StatusOK, wantHas: `"owner_id":1001`},
+
+		{name: "Status before connecting", route: "GET /api/strava/status", path: "/api/strava/status", as: user, want: http.StatusOK, wantHas: `"connected":false`},
+		{name: "Sync before connecting", route: "POST /api/strava/sync", path: "/api/strava/sync", as: user, want: http.StatusNotFound},
+		{name: "Disconnect before connecting", route: "DELETE /api/strava/disconnect", path: "/api/strava/disconnect", as: user, want: http.StatusNotFound},
+		{name: "Connect", route: "POST /api/strava/connect", path: "/api/strava/connect", as: user, body: `{"code":"` + rt.strava.Authorize(1001) + `"}`, want: http.StatusCreated, wantHas: `"strava_athlete_id":1001`, after: waitForSync},
+		{name: "Status", route: "GET /api/strava/status", path: "/api/strava/status", as: user, want: http.StatusOK, wantHas: `"connected":true`},
+		{name: "Sync", route: "POST /api/strava/sync", path: "/api/strava/sync", as: user, want: http.StatusAccepted, wantHas: "running", after: waitForSync},
+		{name: "Disconnect", route: "DELETE /api/strava/disconnect", path: "/api/strava/disconnect", as: user, want: http.StatusOK},
+
+		{name: "Webhook events", route: "GET /api/admin/webhooks", path: "/api/admin/webhooks?status=dead", as: admin, want: http.StatusOK, wantHas: "dead"},
+		{name: "Webhook events as user", route: "GET /api/admin/webhooks", path: "/api/admin/webhooks", as: user, want: http.StatusUnauthorized},
+		{name: "Replay webhook event", route: "POST /api/admin/webhooks/{id}/replay", path: fmt.Sprintf("/api/admin/webhooks/%d/replay", deadEvent), as: admin, want: http.StatusOK, wantHas: "pending"},
+		{name: "Replay live webhook event", route: "POST /api/admin/webhooks/{id}/replay", path: fmt.Sprintf("/api/admin/webhooks/%d/replay", deadEvent), as: admin, want: http.StatusConflict},
+	}
+
+	covered := make(map[string]bool)
+	for _, tc := range tests {
+		covered[tc.route] = true
+		ok := t.Run(tc.name, func(t *testing.T) {
+			rt.serve(t, tc)
+			if tc.after != nil {
+				tc.after(t)
+			}
+		})
+		if !ok {
+			// Later cases depend on the state left by earlier ones
+			t.FailNow()
+		}
+	}
+
+	for _, route := range rt.routes {
+		if !covered[route.Pattern] {
+			t.Errorf("No test case for %s", route.Pattern)
+		}
+	}
+}
+
+// deadWebhookEvent stores a webhook event that ran out of attempts and returns its ID
+func (rt *routeTest) deadWebhookEvent(t *testing.T) int64 {
+	t.Helper()
+
+	now := time.Now()
+	if _, err := rt.db.EnqueueWebhookEvent(models.WebhookEvent{ObjectType: "activity", AspectType: "create", ObjectID: 2, OwnerID: 2002}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	event, err := rt.db.ClaimWebhookEvent(now, now.Add(-time.Hour))
+	if err != nil || event == nil {
+		t.Fatalf("Failed to claim event: %v", err)
+	}
+	if err := rt.db.DeadLetterWebhookEvent(event.ID, errors.New("activity not found"), now); err != nil {
+		t.Fatal(err)
+	}
+
+	return event.ID
+}
+
+func TestConcurrentSignups(t *testing.T) {
+	rt := newRouteTest(t)
+
+	// Signups racing past the email check are told the email is taken rather than failing
+	const signups = 8
+	codes := make(chan int, signups)
+	var wg sync.WaitGroup
+	for range signups {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/api/auth/signup", strings.NewReader(`{"email":"racer@example.com","password":"password1"}`))
+			rec := httptest.NewRecorder()
+			rt.mux.ServeHTTP(rec, req)
+			codes <- rec.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := make(map[int]int)
+	for code := range codes {
+		counts[code]++
+	}
+	if counts[http.StatusCreated] != 1 || counts[http.StatusConflict] != signups-1 {
+		t.Errorf("Expected one signup created and the rest conflicting, got %v", counts)
+	}
+}
+
+func TestRoutesWithoutAdminToken(t *testing.T) {
+	h := New(nil)
+
+	for _, route := range h.Routes(func(next http.HandlerFunc) http.HandlerFunc { return next }, nil) {
+		if strings.Contains(route.Pattern, "/api/admin/") {
+			t.Errorf("Expected no admin routes without an admin token, got %s", route.Pattern)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/thc/runna-backend/internal/database"
+	"github.com/thc/runna-backend/internal/middleware"
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// defaultSummaryBuckets is how many periods a summary covers when from is omitted
+const defaultSummaryBuckets = 12
+
+// GetStatsSummary returns per-week, month or year totals of the user's sessions
+func (h *Handler) GetStatsSummary(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	query, err := parseSummaryQuery(r)
+	if err != nil {
+		log.Printf("[WARN] GetStatsSummary: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := h.db.GetSessionSummary(userID, query)
+	if err == database.ErrTooManyBuckets {
+		log.Printf("[WARN] GetStatsSummary: Range too large: %s to %s per %s", query.From.Format("2006-01-02"), query.To.Format("2006-01-02"), query.Period)
+		http.Error(w, "Range spans too many periods, narrow from/to or use a longer period", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] GetStatsSummary: Database error: %v", err)
+		http.Error(w, "Failed to get summary", http.StatusInternalServerError)
+		return
+	}
+
+	summary := models.StatsSummary{
+		Period:   query.Period,
+		TimeZone: query.Location.String(),
+		Buckets:  buckets,
+	}
+	if query.Period == "week" {
+		summary.WeekStart = "monday"
+		if query.WeekStart == time.Sunday {
+			summary.WeekStart = "sunday"
+		}
+	}
+
+	log.Printf("[INFO] GetStatsSummary: Retrieved %d %s buckets", len(buckets), query.Period)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// parseSummaryQuery reads the parameters of GET /api/stats/summary. Dates are calendar days
+// in the tz time zone; without from the summary covers the last defaultSummaryBuckets periods.
+func parseSummaryQuery(r *http.Request) (models.SummaryQuery, error) {
+	params := r.URL.Query()
+
+	q := models.SummaryQuery{
+		Period:    "week",
+		WeekStart: time.Monday,
+		Location:  time.UTC,
+	}
+
+	if v := params.Get("period"); v != "" {
+		switch v {
+		case "week", "month", "year":
+			q.Period = v
+		default:
+			return q, errors.New("Invalid period, use week, month or year")
+		}
+	}
+
+	if v := params.Get("tz"); v != "" {
+		loc, err := time.LoadLocation(v)
+		if err != nil {
+			return q, errors.New("Invalid tz, use an IANA time zone such as Europe/Copenhagen")
+		}
+		q.Location = loc
+	}
+
+	if v := params.Get("week_start"); v != "" {
+		switch v {
+		case "monday":
+			q.WeekStart = time.Monday
+		case "sunday":
+			q.WeekStart = time.Sunday
+		default:
+			return q, errors.New("Invalid week_start, use monday or sunday")
+		}
+	}
+
+	q.To = time.Now().In(q.Location)
+	if v := params.Get("to"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, q.Location)
+		if err != nil {
+			return q, errors.New("Invalid to format, use YYYY-MM-DD")
+		}
+		q.To = d
+	}
+
+	switch q.Period {
+	case "week":
+		q.From = q.To.AddDate(0, 0, -7*(defaultSummaryBuckets-1))
+	case "month":
+		// Step back from the first of the month so short months don't swallow a bucket
+		q.From = time.Date(q.To.Year(), q.To.Month()-(defaultSummaryBuckets-1), 1, 0, 0, 0, 0, q.Location)
+	case "year":
+		q.From = q.To.AddDate(-(defaultSummaryBuckets - 1), 0, 0)
+	}
+	if v := params.Get("from"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, q.Location)
+		if err != nil {
+			return q, errors.New("Invalid from format, use YYYY-MM-DD")
+		}
+		q.From = d
+	}
+
+	if q.To.Before(q.From) {
+		return q, errors.New("to must not be before from")
+	}
+
+	return q, nil
+}
+
+// defaultTrainingLoadDays is how many days the training load covers when from is omitted
+const defaultTrainingLoadDays = 90
+
+// GetTrainingLoad returns the user's daily acute and chronic load, training stress balance
+// and per-session stress
+func (h *Handler) GetTrainingLoad(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	from, to, err := parseTrainingLoadRange(r)
+	if err != nil {
+		log.Printf("[WARN] GetTrainingLoad: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	load, err := h.db.GetTrainingLoad(userID, from, to)
+	if err == database.ErrTooManyDays {
+		log.Printf("[WARN] GetTrainingLoad: Range too large: %s to %s", from.Format("2006-01-02"), to.Format("2006-01-02"))
+		http.Error(w, "Range spans too many days, narrow from/to", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] GetTrainingLoad: Database error: %v", err)
+		http.Error(w, "Failed to get training load", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] GetTrainingLoad: Retrieved %d days and %d sessions", len(load.Days), len(load.Sessions))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(load)
+}
+
+// parseTrainingLoadRange reads the from and to days of GET /api/stats/training-load. Without
+// them the range is the defaultTrainingLoadDays up to today.
+func parseTrainingLoadRange(r *http.Request) (time.Time, time.Time, error) {
+	params := r.URL.Query()
+
+	y, m, d := time.Now().Date()
+	to := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	if v := params.Get("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid to format, use YYYY-MM-DD")
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -(defaultTrainingLoadDays - 1))
+	if v := params.Get("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, time.Time{}, errors.New("Invalid from format, use YYYY-MM-DD")
+		}
+		from = t
+	}
+
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errors.New("to must not be before from")
+	}
+
+	return from, to, nil
+}
@@ -1,19 +1,22 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
-	"github.com/thc/runna-backend/internal/crypto"
+	"github.com/thc/runna-backend/internal/database"
+	"github.com/thc/runna-backend/internal/middleware"
 	"github.com/thc/runna-backend/internal/models"
 	"github.com/thc/runna-backend/internal/services"
 )
 
 // ConnectStrava handles OAuth token exchange
 func (h *Handler) ConnectStrava(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
 	var req models.StravaConnectRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -26,69 +29,98 @@ func (h *Handler) ConnectStrava(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.stravaService == nil || h.keyring == nil {
+		log.Printf("[ERROR] ConnectStrava: Strava service or encryption keys not configured")
+		http.Error(w, "Server configuration error", http.StatusInternalServerError)
+		return
+	}
+
 	// Exchange code for tokens
-	client := services.NewStravaClient()
-	tokenResp, err := client.ExchangeToken(req.Code)
+	tokenResp, err := h.stravaService.ExchangeToken(req.Code)
 	if err != nil {
 		log.Printf("[ERROR] ConnectStrava: Failed to exchange token: %v", err)
 		http.Error(w, "Failed to connect to Strava", http.StatusInternalServerError)
 		return
 	}
 
-	// Get encryption key
-	encryptionKey := os.Getenv("ENCRYPTION_KEY")
-	if encryptionKey == "" {
-		log.Printf("[ERROR] ConnectStrava: ENCRYPTION_KEY not set")
-		http.Error(w, "Server configuration error", http.StatusInternalServerError)
-		return
-	}
-
 	// Encrypt tokens before storage
-	encryptedAccessToken, err := crypto.Encrypt(tokenResp.AccessToken, encryptionKey)
+	encryptedAccessToken, err := h.keyring.Encrypt(tokenResp.AccessToken)
 	if err != nil {
 		log.Printf("[ERROR] ConnectStrava: Failed to encrypt access token: %v", err)
 		http.Error(w, "Failed to store connection", http.StatusInternalServerError)
 		return
 	}
 
-	encryptedRefreshToken, err := crypto.Encrypt(tokenResp.RefreshToken, encryptionKey)
+	encryptedRefreshToken, err := h.keyring.Encrypt(tokenResp.RefreshToken)
 	if err != nil {
 		log.Printf("[ERROR] ConnectStrava: Failed to encrypt refresh token: %v", err)
 		http.Error(w, "Failed to store connection", http.StatusInternalServerError)
 		return
 	}
 
-	// Store connection in database with encrypted tokens
-	conn := models.StravaConnection{
-		StravaAthleteID: tokenResp.Athlete.ID,
-		AccessToken:     encryptedAccessToken,
-		RefreshToken:    encryptedRefreshToken,
-		TokenExpiresAt:  time.Unix(tokenResp.ExpiresAt, 0),
-	}
-
-	createdConn, err := h.db.CreateStravaConnection(conn)
+	// An athlete can only be linked to one account
+	existing, err := h.strava.GetStravaConnectionByAthleteID(tokenResp.Athlete.ID)
 	if err != nil {
-		log.Printf("[ERROR] ConnectStrava: Failed to store connection: %v", err)
+		log.Printf("[ERROR] ConnectStrava: Failed to check existing connection: %v", err)
 		http.Error(w, "Failed to store connection", http.StatusInternalServerError)
 		return
 	}
+	if existing != nil && existing.UserID != userID {
+		log.Printf("[WARN] ConnectStrava: Athlete %d already linked to another user", tokenResp.Athlete.ID)
+		http.Error(w, "Strava account is already connected to another user", http.StatusConflict)
+		return
+	}
 
-	log.Printf("[INFO] ConnectStrava: Created connection for athlete %d (tokens encrypted)", createdConn.StravaAthleteID)
+	expiresAt := time.Unix(tokenResp.ExpiresAt, 0)
+	status := http.StatusCreated
+	conn := existing
+
+	if existing != nil {
+		// Re-authorizing an athlete already linked to this user replaces the stored tokens
+		if err := h.strava.UpdateStravaTokens(existing.StravaAthleteID, encryptedAccessToken, encryptedRefreshToken, expiresAt); err != nil {
+			log.Printf("[ERROR] ConnectStrava: Failed to update tokens: %v", err)
+			http.Error(w, "Failed to store connection", http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusOK
+
+		log.Printf("[INFO] ConnectStrava: Reconnected athlete %d (tokens encrypted)", existing.StravaAthleteID)
+	} else {
+		// Store connection in database with encrypted tokens
+		conn, err = h.strava.CreateStravaConnection(models.StravaConnection{
+			UserID:          userID,
+			StravaAthleteID: tokenResp.Athlete.ID,
+			AccessToken:     encryptedAccessToken,
+			RefreshToken:    encryptedRefreshToken,
+			TokenExpiresAt:  expiresAt,
+		})
+		if err != nil {
+			log.Printf("[ERROR] ConnectStrava: Failed to store connection: %v", err)
+			http.Error(w, "Failed to store connection", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("[INFO] ConnectStrava: Created connection for athlete %d (tokens encrypted)", conn.StravaAthleteID)
+	}
+
+	// Import the athlete's history in the background; the connection stands even if this fails
+	if err := h.stravaService.StartSync(context.WithoutCancel(r.Context()), userID); err != nil {
+		log.Printf("[ERROR] ConnectStrava: Failed to start backfill for athlete %d: %v", conn.StravaAthleteID, err)
+	}
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success":           true,
-		"strava_athlete_id": createdConn.StravaAthleteID,
-		"connected_at":      createdConn.ConnectedAt,
+		"strava_athlete_id": conn.StravaAthleteID,
+		"connected_at":      conn.ConnectedAt,
 	})
 }
 
-// GetStravaStatus returns the current Strava connection status
+// GetStravaStatus returns the user's Strava connection status
 func (h *Handler) GetStravaStatus(w http.ResponseWriter, r *http.Request) {
-	// For MVP, we just check if any connection exists (single-user)
-	conn, err := h.db.GetStravaConnection()
+	conn, err := h.strava.GetStravaConnection(middleware.UserID(r.Context()))
 	if err != nil {
 		log.Printf("Failed to get connection: %v", err)
 		http.Error(w, "Failed to get status", http.StatusInternalServerError)
@@ -103,16 +135,57 @@ func (h *Handler) GetStravaStatus(w http.ResponseWriter, r *http.Request) {
 		status.StravaAthleteID = conn.StravaAthleteID
 		status.ConnectedAt = conn.ConnectedAt
 		status.LastSync = conn.LastSync
+		if conn.Sync.Status != "" {
+			status.Sync = &conn.Sync
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
 
-// DisconnectStrava removes the Strava connection
+// SyncStrava starts importing the user's Strava activities since the last sync
+func (h *Handler) SyncStrava(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	if h.stravaService == nil {
+		log.Printf("[ERROR] SyncStrava: Strava service not configured")
+		http.Error(w, "Failed to start sync", http.StatusInternalServerError)
+		return
+	}
+
+	// The sync runs on after the response, so it must not end with the request
+	err := h.stravaService.StartSync(context.WithoutCancel(r.Context()), userID)
+	if errors.Is(err, services.ErrNotConnected) {
+		http.Error(w, "No Strava connection found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, database.ErrSyncInProgress) {
+		http.Error(w, "A sync is already in progress", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] SyncStrava: Failed to start sync for user %d: %v", userID, err)
+		http.Error(w, "Failed to start sync", http.StatusInternalServerError)
+		return
+	}
+
+	conn, err := h.strava.GetStravaConnection(userID)
+	if err != nil || conn == nil {
+		log.Printf("[ERROR] SyncStrava: Failed to get connection for user %d: %v", userID, err)
+		http.Error(w, "Failed to get status", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] SyncStrava: Started sync for athlete %d", conn.StravaAthleteID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(conn.Sync)
+}
+
+// DisconnectStrava removes the user's Strava connection
 func (h *Handler) DisconnectStrava(w http.ResponseWriter, r *http.Request) {
-	// For MVP, disconnect the first/only connection
-	conn, err := h.db.GetStravaConnection()
+	conn, err := h.strava.GetStravaConnection(middleware.UserID(r.Context()))
 	if err != nil {
 		log.Printf("Failed to get connection: %v", err)
 		http.Error(w, "Failed to disconnect", http.StatusInternalServerError)
@@ -124,7 +197,7 @@ func (h *Handler) DisconnectStrava(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.db.DeleteStravaConnection(conn.StravaAthleteID)
+	err = h.strava.DeleteStravaConnection(conn.StravaAthleteID)
 	if err != nil {
 		log.Printf("Failed to delete connection: %v", err)
 		http.Error(w, "Failed to disconnect", http.StatusInternalServerError)
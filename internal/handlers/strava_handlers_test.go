@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/crypto"
+	"github.com/thc/runna-backend/internal/database"
+	"github.com/thc/runna-backend/internal/middleware"
+	"github.com/thc/runna-backend/internal/models"
+	"github.com/thc/runna-backend/internal/services"
+	"github.com/thc/runna-backend/internal/stravatest"
+)
+
+const testEncryptionKey = "0123456789abcdef0123456789abcdef"
+
+// stravaTest is a handler wired to a fake Strava and a fresh database
+type stravaTest struct {
+	strava  *stravatest.Server
+	db      *database.DB
+	keyring *crypto.Keyring
+	service *services.StravaService
+	handler *Handler
+}
+
+func newStravaTest(t *testing.T) *stravaTest {
+	t.Helper()
+
+	t.Setenv("STRAVA_CLIENT_ID", "client")
+	t.Setenv("STRAVA_CLIENT_SECRET", "secret")
+
+	strava := stravatest.NewServer("client", "secret")
+	t.Cleanup(strava.Close)
+
+	db := newTestDB(t)
+	keyring := newTestKeyring(t)
+	service := services.NewStravaService(db, services.NewStravaClient(strava.APIBase(), strava.TokenURL()), keyring)
+	h := New(db)
+	h.SetStravaService(service)
+	h.SetKeyring(keyring)
+
+	return &stravaTest{strava: strava, db: db, keyring: keyring, service: service, handler: h}
+}
+
+// newTestKeyring returns a keyring of the test key under the default ID
+func newTestKeyring(t *testing.T) *crypto.Keyring {
+	t.Helper()
+
+	keyring, err := crypto.NewKeyring(crypto.DefaultKeyID, testEncryptionKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keyring
+}
+
+func (st *stravaTest) createUser(t *testing.T, email string) int64 {
+	t.Helper()
+
+	user, err := st.db.CreateUser(email, "Runner", "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	return user.ID
+}
+
+// connect runs ConnectStrava for the user with an authorization code of the athlete
+func (st *stravaTest) connect(t *testing.T, userID, athleteID int64) *httptest.ResponseRecorder {
+	t.Helper()
+
+	body := `{"code":"` + st.strava.Authorize(athleteID) + `"}`
+	req := httptest.NewRequest("POST", "/api/strava/connect", strings.NewReader(body))
+	req = req.WithContext(middleware.WithUserID(req.Context(), userID))
+
+	rec := httptest.NewRecorder()
+	st.handler.ConnectStrava(rec, req)
+	return rec
+}
+
+// waitFor polls until done reports true
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		if done() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %s", what)
+}
+
+func TestConnectStrava(t *testing.T) {
+	st := newStravaTest(t)
+	userID := st.createUser(t, "runner@example.com")
+
+	start := time.Now().AddDate(0, 0, -3)
+	st.strava.PutActivity(1001, models.StravaActivity{ID: 1, Name: "Morning Run", Type: "Run", Distance: 5000, MovingTime: 1500, StartDate: start})
+
+	rec := st.connect(t, userID, 1001)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp struct {
+		Success         bool  `json:"success"`
+		StravaAthleteID int64 `json:"strava_athlete_id"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !resp.Success || resp.StravaAthleteID != 1001 {
+		t.Errorf("Unexpected response: %+v", resp)
+	}
+
+	conn, err := st.db.GetStravaConnection(userID)
+	if err != nil || conn == nil {
+		t.Fatalf("Expected a stored connection, got %v", err)
+	}
+	accessToken, err := st.keyring.Decrypt(conn.AccessToken)
+	if err != nil || !strings.HasPrefix(accessToken, "access-1001-") {
+		t.Errorf("Expected the encrypted access token of athlete 1001, got %q (%v)", accessToken, err)
+	}
+
+	// Connecting starts the backfill of the athlete's history
+	waitFor(t, "the backfill", func() bool {
+		conn, err := st.db.GetStravaConnection(userID)
+		return err == nil && conn.Sync.Status == models.StravaSyncCompleted
+	})
+	session, err := st.db.GetSessionByStravaActivityID(userID, 1)
+	if err != nil || session == nil {
+		t.Fatalf("Expected the backfill to import the run, got %v", err)
+	}
+
+	// The athlete can't be linked to a second account
+	otherID := st.createUser(t, "other@example.com")
+	if rec := st.connect(t, otherID, 1001); rec.Code != http.StatusConflict {
+		t.Errorf("Expected 409 for an athlete linked to another user, got %d", rec.Code)
+	}
+}
+
+func TestConnectStravaReconnect(t *testing.T) {
+	st := newStravaTest(t)
+	userID := st.createUser(t, "runner@example.com")
+
+	if rec := st.connect(t, userID, 1001); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	waitFor(t, "the backfill", func() bool {
+		conn, err := st.db.GetStravaConnection(userID)
+		return err == nil && conn.Sync.Status == models.StravaSyncCompleted
+	})
+	before, err := st.db.GetStravaConnection(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Authorizing the same athlete again keeps the connection and stores the new tokens
+	rec := st.connect(t, userID, 1001)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for a reconnect, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	after, err := st.db.GetStravaConnection(userID)
+	if err != nil || after == nil {
+		t.Fatalf("Expected the connection to remain, got %v", err)
+	}
+	if after.ID != before.ID || !after.ConnectedAt.Equal(before.ConnectedAt) {
+		t.Errorf("Expected the same connection, got %+v", after)
+	}
+
+	oldToken, _ := st.keyring.Decrypt(before.AccessToken)
+	newToken, err := st.keyring.Decrypt(after.AccessToken)
+	if err != nil || newToken == oldToken || !strings.HasPrefix(newToken, "access-1001-") {
+		t.Errorf("Expected the reconnect's access token, got %q (%v)", newToken, err)
+	}
+}
+
+func TestConnectStravaRejectsBadCodes(t *testing.T) {
+	st := newStravaTest(t)
+	userID := st.createUser(t, "runner@example.com")
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"Invalid JSON", `{`, http.StatusBadRequest},
+		{"Missing code", `{}`, http.StatusBadRequest},
+		{"Unknown code", `{"code":"made-up"}`, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/strava/connect", strings.NewReader(tt.body))
+			req = req.WithContext(middleware.WithUserID(req.Context(), userID))
+
+			rec := httptest.NewRecorder()
+			st.handler.ConnectStrava(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("Expected %d, got %d", tt.want, rec.Code)
+			}
+		})
+	}
+
+	if conn, _ := st.db.GetStravaConnection(userID); conn != nil {
+		t.Errorf("Expected no connection, got %+v", conn)
+	}
+}
+
+func TestReceiveWebhook(t *testing.T) {
+	st := newStravaTest(t)
+	userID := st.createUser(t, "runner@example.com")
+	if rec := st.connect(t, userID, 1001); rec.Code != http.StatusCreated {
+		t.Fatalf("Failed to connect: %d %s", rec.Code, rec.Body.String())
+	}
+	waitFor(t, "the backfill", func() bool {
+		conn, err := st.db.GetStravaConnection(userID)
+		return err == nil && conn.Sync.Status == models.StravaSyncCompleted
+	})
+
+	worker := services.NewWebhookWorker(st.db, st.service, 2, 10*time.Millisecond)
+	st.handler.SetWebhookQueue(worker)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		worker.Run(ctx)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/webhooks/strava", st.handler.ReceiveWebhook)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	callbackURL := server.URL + "/api/webhooks/strava"
+
+	push := func(event models.WebhookEvent) {
+		t.Helper()
+
+		resp, err := st.strava.PushWebhook(callbackURL, event)
+		if err != nil {
+			t.Fatalf("Failed to push event: %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK || string(body) != "EVENT_RECEIVED" {
+			t.Fatalf("Expected the event to be acknowledged, got %d %q", resp.StatusCode, body)
+		}
+	}
+
+	st.strava.PutActivity(1001, models.StravaActivity{ID: 7, Name: "Tempo", Type: "Run", Distance: 8000, MovingTime: 2400, StartDate: time.Now().Add(-time.Hour)})
+	push(models.WebhookEvent{ObjectType: "activity", AspectType: "create", ObjectID: 7, OwnerID: 1001})
+
+	waitFor(t, "the session of the pushed activity", func() bool {
+		session, err := st.db.GetSessionByStravaActivityID(userID, 7)
+		return err == nil && session != nil
+	})
+
+	// An event that fails stays queued for a retry with its error
+	push(models.WebhookEvent{ObjectType: "activity", AspectType: "create", ObjectID: 8, OwnerID: 1001})
+
+	waitFor(t, "the failed attempt", func() bool {
+		events, err := st.db.ListWebhookEvents(models.WebhookEventPending, 10)
+		return err == nil && len(events) == 1 && events[0].Attempts == 1
+	})
+
+	events, err := st.db.ListWebhookEvents("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected both events stored, got %d", len(events))
+	}
+	if failed := events[0]; failed.Event.ObjectID != 8 || !strings.Contains(failed.LastError, "404") || failed.NextAttemptAt.Before(time.Now()) {
+		t.Errorf("Expected the failed event to wait for a retry, got %+v", failed)
+	}
+	if done := events[1]; done.Event.ObjectID != 7 || done.Status != models.WebhookEventDone || done.Event.SubscriptionID != stravatest.SubscriptionID {
+		t.Errorf("Expected the first event to be done, got %+v", done)
+	}
+
+	resp, err := http.Post(callbackURL, "application/json", strings.NewReader("{"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid event, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/thc/runna-backend/internal/middleware"
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// DeleteSession moves a session to the trash; it can be restored until it is purged
+func (h *Handler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] DeleteSession: Invalid session ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.sessions.SoftDeleteSession(userID, id); err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("[WARN] DeleteSession: Session not found id=%d", id)
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[ERROR] DeleteSession: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to delete session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] DeleteSession: Moved session id=%d to trash", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTrash lists the user's deleted sessions
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	sessions, err := h.sessions.GetDeletedSessions(userID)
+	if err != nil {
+		log.Printf("[ERROR] GetTrash: Database error: %v", err)
+		http.Error(w, "Failed to get trash", http.StatusInternalServerError)
+		return
+	}
+
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+
+	log.Printf("[INFO] GetTrash: Retrieved %d deleted sessions", len(sessions))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// RestoreSession moves a session out of the trash
+func (h *Handler) RestoreSession(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.UserID(r.Context())
+
+	idStr := r.PathValue("id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		log.Printf("[WARN] RestoreSession: Invalid session ID format: %s, error: %v", idStr, err)
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.sessions.RestoreSession(userID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("[WARN] RestoreSession: Deleted session not found id=%d", id)
+			http.Error(w, "Deleted session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("[ERROR] RestoreSession: Database error for id=%d: %v", id, err)
+		http.Error(w, "Failed to restore session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[INFO] RestoreSession: Restored session id=%d", id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
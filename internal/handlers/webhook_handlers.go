@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/thc/runna-backend/internal/models"
 )
@@ -55,24 +56,21 @@ func (h *Handler) ReceiveWebhook(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Received webhook event: type=%s, aspect=%s, object_id=%d, owner_id=%d",
 		event.ObjectType, event.AspectType, event.ObjectID, event.OwnerID)
 
-	// Queue the event for async processing
-	// For now, we'll use a simple goroutine. In production, use a proper job queue.
-	go h.processWebhookEvent(event)
-
-	// Respond immediately with 200 OK (must respond within 2 seconds)
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("EVENT_RECEIVED"))
-}
-
-// processWebhookEvent processes webhook events asynchronously
-func (h *Handler) processWebhookEvent(event models.WebhookEvent) {
-	if h.stravaService == nil {
-		log.Println("Strava service not initialized")
+	// Store the event before acknowledging so it survives failures and restarts; without the
+	// acknowledgement Strava delivers it again
+	queued, err := h.db.EnqueueWebhookEvent(event, time.Now())
+	if err != nil {
+		log.Printf("[ERROR] ReceiveWebhook: Failed to store event: %v", err)
+		http.Error(w, "Failed to store event", http.StatusInternalServerError)
 		return
 	}
 
-	// Process the event using the Strava service
-	if err := h.stravaService.ProcessWebhookEvent(event); err != nil {
-		log.Printf("Failed to process webhook event: %v", err)
+	log.Printf("Queued webhook event %d", queued.ID)
+	if h.webhookQueue != nil {
+		h.webhookQueue.Notify()
 	}
+
+	// Respond immediately with 200 OK (must respond within 2 seconds)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("EVENT_RECEIVED"))
 }
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/thc/runna-backend/internal/auth"
+)
+
+type contextKey int
+
+const userIDKey contextKey = iota
+
+// Auth returns a wrapper that rejects requests without a valid bearer token
+// and stores the authenticated user ID in the request context
+func Auth(secret string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok || token == "" {
+				log.Printf("[WARN] Auth: Missing bearer token for %s %s", r.Method, r.URL.Path)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			userID, err := auth.ParseToken(token, secret)
+			if err != nil {
+				log.Printf("[WARN] Auth: Rejected token for %s %s: %v", r.Method, r.URL.Path, err)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next(w, r.WithContext(WithUserID(r.Context(), userID)))
+		}
+	}
+}
+
+// WithUserID returns a copy of ctx carrying the authenticated user ID
+func WithUserID(ctx context.Context, userID int64) context.Context {
+	return context.WithValue(ctx, userIDKey, userID)
+}
+
+// UserID returns the authenticated user ID stored by Auth, or 0 if none
+func UserID(ctx context.Context) int64 {
+	userID, _ := ctx.Value(userIDKey).(int64)
+	return userID
+}
@@ -1,27 +1,189 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Goal types; the target of each is measured in the unit noted
+const (
+	GoalTypeDistance  = "distance"  // km
+	GoalTypeDuration  = "duration"  // seconds of running
+	GoalTypeRunCount  = "run_count" // number of sessions
+	GoalTypeElevation = "elevation" // meters of elevation gain
+	GoalTypePace      = "pace"      // average seconds per km, lower is better
+)
+
+// Goal recurrences; a goal without one covers a single period
+const (
+	GoalRecurrenceWeekly  = "weekly"
+	GoalRecurrenceMonthly = "monthly"
+	GoalRecurrenceCustom  = "custom" // every RecurrenceDays days
+)
+
+// AdvanceRecurrence moves t forward by one period of the given recurrence
+func AdvanceRecurrence(t time.Time, recurrence string, days int) time.Time {
+	switch recurrence {
+	case GoalRecurrenceWeekly:
+		return t.AddDate(0, 0, 7)
+	case GoalRecurrenceMonthly:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, days)
+	}
+}
 
 type Goal struct {
 	ID             int64     `json:"id"`
-	TargetDistance float64   `json:"target_distance"`
+	UserID         int64     `json:"user_id"`
+	GoalType       string    `json:"goal_type"`
+	TargetValue    float64   `json:"target_value"`
+	TargetDistance float64   `json:"target_distance"` // same as TargetValue for distance goals, 0 otherwise
 	StartDate      time.Time `json:"start_date"`
 	EndDate        time.Time `json:"end_date"`
+	Recurrence     string    `json:"recurrence,omitempty"`
+	RecurrenceDays int       `json:"recurrence_days,omitempty"`
 	CreatedAt      time.Time `json:"created_at"`
 	UpdatedAt      time.Time `json:"updated_at"`
 }
 
+// CreateGoalRequest describes a goal. GoalType defaults to distance, and distance goals
+// may give their target as TargetDistance instead of TargetValue. Recurring goals use
+// StartDate and EndDate as their first period.
 type CreateGoalRequest struct {
+	GoalType       string    `json:"goal_type"`
+	TargetValue    float64   `json:"target_value"`
 	TargetDistance float64   `json:"target_distance"`
 	StartDate      time.Time `json:"start_date"`
 	EndDate        time.Time `json:"end_date"`
+	Recurrence     string    `json:"recurrence"`
+	RecurrenceDays int       `json:"recurrence_days"`
+}
+
+// Normalize fills in the goal type and target defaults before validation
+func (r *CreateGoalRequest) Normalize() {
+	if r.GoalType == "" {
+		r.GoalType = GoalTypeDistance
+	}
+
+	if r.GoalType == GoalTypeDistance {
+		if r.TargetValue == 0 {
+			r.TargetValue = r.TargetDistance
+		}
+		r.TargetDistance = r.TargetValue
+	} else {
+		r.TargetDistance = 0
+	}
+
+	if r.Recurrence != GoalRecurrenceCustom {
+		r.RecurrenceDays = 0
+	}
+}
+
+// Validate checks the rules every created or updated goal must satisfy as of now
+func (r CreateGoalRequest) Validate(now time.Time) error {
+	switch r.GoalType {
+	case GoalTypeDistance:
+		if r.TargetValue <= 0 {
+			return errors.New("Target distance must be greater than 0")
+		}
+	case GoalTypeDuration, GoalTypeElevation, GoalTypePace:
+		if r.TargetValue <= 0 {
+			return errors.New("Target value must be greater than 0")
+		}
+	case GoalTypeRunCount:
+		if r.TargetValue < 1 || r.TargetValue != math.Trunc(r.TargetValue) {
+			return errors.New("Run count target must be a whole number of at least 1")
+		}
+	default:
+		return errors.New("Invalid goal type, use distance, duration, run_count, elevation or pace")
+	}
+
+	if r.StartDate.IsZero() || r.EndDate.IsZero() {
+		return errors.New("Start date and end date are required")
+	}
+
+	if r.EndDate.Before(r.StartDate) {
+		return errors.New("End date must be after start date")
+	}
+
+	switch r.Recurrence {
+	case "":
+		return nil
+	case GoalRecurrenceWeekly:
+	case GoalRecurrenceMonthly:
+		// Later months may be shorter, so the calendar day must exist in every month
+		if r.StartDate.Day() > 28 {
+			return errors.New("Monthly goals must start on or before the 28th")
+		}
+	case GoalRecurrenceCustom:
+		if r.RecurrenceDays < 1 {
+			return errors.New("Custom recurrence needs recurrence_days of at least 1")
+		}
+	default:
+		return errors.New("Invalid recurrence, use weekly, monthly or custom")
+	}
+
+	next := AdvanceRecurrence(r.StartDate, r.Recurrence, r.RecurrenceDays)
+	if !r.EndDate.Before(next) {
+		return errors.New("End date must be before the start of the next period")
+	}
+
+	// Every period that has ended is closed and recorded, so the goal may start at most one
+	// period before the current one
+	if !AdvanceRecurrence(next, r.Recurrence, r.RecurrenceDays).After(now) {
+		return errors.New("Recurring goals must start no more than one period before the current one")
+	}
+
+	return nil
 }
 
 type GoalProgress struct {
 	Goal
-	CurrentDistance    float64   `json:"current_distance"`
+	CurrentValue       float64       `json:"current_value"`  // in the unit of the goal type
+	ExpectedValue      float64       `json:"expected_value"` // where a goal on schedule would be now
+	CurrentDistance    float64       `json:"current_distance"`
+	ProgressPercentage float64       `json:"progress_percentage"`
+	Status             string        `json:"status"` // "On Track", "Behind", "Ahead", "Completed"
+	ExpectedDistance   float64       `json:"expected_distance"`
+	Streak             int           `json:"streak"`      // consecutive completed periods up to now
+	BestStreak         int           `json:"best_streak"` // longest run of completed periods
+	Forecast           *GoalForecast `json:"forecast,omitempty"`
+	Sessions           []Session     `json:"sessions,omitempty"`
+}
+
+// GoalForecast projects where a goal will end up and what it takes to reach it.
+// Values are in the unit of the goal type; pace goals have no forecast.
+type GoalForecast struct {
+	DaysRemaining   float64 `json:"days_remaining"`
+	RecentDailyRate float64 `json:"recent_daily_rate"` // average per day over the last four weeks
+	ProjectedValue  float64 `json:"projected_value"`   // at the end of the period at the recent rate
+	RequiredPerDay  float64 `json:"required_per_day"`
+	RequiredPerWeek float64 `json:"required_per_week"`
+	Confidence      float64 `json:"confidence"` // estimated probability of reaching the target, 0 to 1
+}
+
+// GoalSnapshot is the progress of a goal as recorded on one day
+type GoalSnapshot struct {
+	ID                 int64     `json:"id"`
+	GoalID             int64     `json:"goal_id"`
+	Date               string    `json:"date"` // YYYY-MM-DD, UTC
+	Current            float64   `json:"current"`
+	Expected           float64   `json:"expected"`
 	ProgressPercentage float64   `json:"progress_percentage"`
-	Status             string    `json:"status"` // "On Track", "Behind", "Ahead", "Completed"
-	ExpectedDistance   float64   `json:"expected_distance"`
-	Sessions           []Session `json:"sessions,omitempty"`
+	Status             string    `json:"status"`
+	RecordedAt         time.Time `json:"recorded_at"`
+}
+
+// GoalPeriod is the outcome of a finished period of a recurring goal
+type GoalPeriod struct {
+	ID          int64     `json:"id"`
+	GoalID      int64     `json:"goal_id"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	TargetValue float64   `json:"target_value"`
+	FinalValue  float64   `json:"final_value"`
+	Status      string    `json:"status"` // "Completed" or "Missed"
+	ClosedAt    time.Time `json:"closed_at"`
 }
@@ -0,0 +1,16 @@
+package models
+
+// CSVRowError lists the validation problems of one CSV data row
+type CSVRowError struct {
+	Row    int      `json:"row"` // line number in the file, header is line 1
+	Errors []string `json:"errors"`
+}
+
+// CSVImportReport is returned by the CSV import endpoint
+type CSVImportReport struct {
+	DryRun    bool          `json:"dry_run"`
+	TotalRows int           `json:"total_rows"`
+	ValidRows int           `json:"valid_rows"`
+	Imported  int           `json:"imported"`
+	Errors    []CSVRowError `json:"errors"`
+}
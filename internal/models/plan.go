@@ -0,0 +1,172 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Race distances training plans can be generated for
+const (
+	RaceDistance5K           = "5k"
+	RaceDistance10K          = "10k"
+	RaceDistanceHalfMarathon = "half_marathon"
+	RaceDistanceMarathon     = "marathon"
+)
+
+// Planned workout types
+const (
+	WorkoutEasy      = "easy"
+	WorkoutLong      = "long"
+	WorkoutTempo     = "tempo"
+	WorkoutIntervals = "intervals"
+	WorkoutRecovery  = "recovery"
+	WorkoutRace      = "race"
+	WorkoutRest      = "rest"
+)
+
+// TrainingPlan schedules workouts towards a race, or holds hand-written workouts when
+// RaceDistance is empty. Dates are calendar days in YYYY-MM-DD format.
+type TrainingPlan struct {
+	ID           int64            `json:"id"`
+	UserID       int64            `json:"user_id"`
+	Name         string           `json:"name"`
+	RaceDistance string           `json:"race_distance,omitempty"`
+	RaceDate     string           `json:"race_date,omitempty"`
+	StartDate    string           `json:"start_date"`
+	WeeklyVolume float64          `json:"weekly_volume"` // km per week when the plan was made
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+	Workouts     []PlannedWorkout `json:"workouts,omitempty"`
+}
+
+// CreatePlanRequest describes a training plan. Plans with a race distance are generated
+// from RaceDate and WeeklyVolume; StartDate defaults to today.
+type CreatePlanRequest struct {
+	Name         string  `json:"name"`
+	RaceDistance string  `json:"race_distance"`
+	RaceDate     string  `json:"race_date"`
+	StartDate    string  `json:"start_date"`
+	WeeklyVolume float64 `json:"weekly_volume"`
+}
+
+// Validate checks the rules every created or updated plan must satisfy
+func (r CreatePlanRequest) Validate() error {
+	if strings.TrimSpace(r.Name) == "" && r.RaceDistance == "" {
+		return errors.New("Name is required for plans without a race distance")
+	}
+
+	if r.StartDate != "" {
+		if _, err := time.Parse("2006-01-02", r.StartDate); err != nil {
+			return errors.New("Invalid start_date format, use YYYY-MM-DD")
+		}
+	}
+
+	if r.WeeklyVolume < 0 {
+		return errors.New("Weekly volume must not be negative")
+	}
+
+	switch r.RaceDistance {
+	case "":
+		return nil
+	case RaceDistance5K, RaceDistance10K, RaceDistanceHalfMarathon, RaceDistanceMarathon:
+	default:
+		return errors.New("Invalid race_distance, use 5k, 10k, half_marathon or marathon")
+	}
+
+	if _, err := time.Parse("2006-01-02", r.RaceDate); err != nil {
+		return errors.New("Invalid race_date format, use YYYY-MM-DD")
+	}
+
+	return nil
+}
+
+// PlannedWorkout is a workout scheduled on a day of a training plan
+type PlannedWorkout struct {
+	ID          int64         `json:"id"`
+	PlanID      int64         `json:"plan_id"`
+	Date        string        `json:"date"` // YYYY-MM-DD
+	WorkoutType string        `json:"workout_type"`
+	Distance    float64       `json:"distance"`              // km
+	Duration    *int          `json:"duration,omitempty"`    // seconds
+	TargetPace  *float64      `json:"target_pace,omitempty"` // seconds per km
+	Description string        `json:"description"`
+	Match       *WorkoutMatch `json:"match,omitempty"` // the session run for it, if any
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// WorkoutMatch links a planned workout to the session run on its day and scores how closely
+// the session followed the plan. Deviations are percentages of the planned value, positive
+// when the session went further, longer or slower, and nil when the plan sets no target.
+type WorkoutMatch struct {
+	SessionID         int64     `json:"session_id"`
+	ActualDistance    float64   `json:"actual_distance"` // km
+	ActualDuration    int       `json:"actual_duration"` // seconds
+	DistanceDeviation *float64  `json:"distance_deviation"`
+	DurationDeviation *float64  `json:"duration_deviation"`
+	PaceDeviation     *float64  `json:"pace_deviation"`
+	Compliance        float64   `json:"compliance"` // 0-100
+	MatchedAt         time.Time `json:"matched_at"`
+}
+
+// WeekAdherence summarizes how well one week of a plan was followed. Due counts the
+// workouts scheduled up to today; rest days are not counted.
+type WeekAdherence struct {
+	WeekStart         string   `json:"week_start"`
+	WeekEnd           string   `json:"week_end"`
+	Planned           int      `json:"planned"`
+	Due               int      `json:"due"`
+	Completed         int      `json:"completed"`
+	PlannedDistance   float64  `json:"planned_distance"`   // km of the due workouts
+	CompletedDistance float64  `json:"completed_distance"` // km of the matched sessions
+	Adherence         *float64 `json:"adherence"`          // percent of due workouts completed
+	AvgCompliance     *float64 `json:"avg_compliance"`
+}
+
+// PlanAdherence is a plan's adherence week by week and overall
+type PlanAdherence struct {
+	PlanID        int64           `json:"plan_id"`
+	Due           int             `json:"due"`
+	Completed     int             `json:"completed"`
+	Adherence     *float64        `json:"adherence"`
+	AvgCompliance *float64        `json:"avg_compliance"`
+	Weeks         []WeekAdherence `json:"weeks"`
+}
+
+// PlannedWorkoutRequest describes a workout to add to or change in a plan
+type PlannedWorkoutRequest struct {
+	Date        string   `json:"date"`
+	WorkoutType string   `json:"workout_type"`
+	Distance    float64  `json:"distance"`
+	Duration    *int     `json:"duration"`
+	TargetPace  *float64 `json:"target_pace"`
+	Description string   `json:"description"`
+}
+
+// Validate checks the rules every created or updated workout must satisfy
+func (r PlannedWorkoutRequest) Validate() error {
+	if _, err := time.Parse("2006-01-02", r.Date); err != nil {
+		return errors.New("Invalid date format, use YYYY-MM-DD")
+	}
+
+	switch r.WorkoutType {
+	case WorkoutEasy, WorkoutLong, WorkoutTempo, WorkoutIntervals, WorkoutRecovery, WorkoutRace, WorkoutRest:
+	default:
+		return errors.New("Invalid workout_type, use easy, long, tempo, intervals, recovery, race or rest")
+	}
+
+	if r.Distance < 0 {
+		return errors.New("Distance must not be negative")
+	}
+
+	if r.Duration != nil && *r.Duration < 0 {
+		return errors.New("Duration must not be negative")
+	}
+
+	if r.TargetPace != nil && *r.TargetPace <= 0 {
+		return errors.New("Target pace must be greater than 0")
+	}
+
+	return nil
+}
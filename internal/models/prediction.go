@@ -0,0 +1,35 @@
+package models
+
+// RacePrediction is the predicted finish time of one race distance. Time averages the VDOT
+// and Riegel predictions.
+type RacePrediction struct {
+	Race       string  `json:"race"`     // "5k", "10k", "half_marathon" or "marathon"
+	Distance   float64 `json:"distance"` // km
+	Time       int     `json:"time"`     // seconds
+	Pace       float64 `json:"pace"`     // seconds per km
+	VDOTTime   int     `json:"vdot_time"`
+	RiegelTime int     `json:"riegel_time"`
+}
+
+// PredictionEvidence is a session a prediction is based on, with the VDOT it scores
+type PredictionEvidence struct {
+	Session Session `json:"session"`
+	VDOT    float64 `json:"vdot"`
+}
+
+// PredictionPoint is the fitness estimate and predicted race times as of one day, keyed by race.
+// VDOT is nil when there were no efforts to base a prediction on.
+type PredictionPoint struct {
+	Date  string         `json:"date"`
+	VDOT  *float64       `json:"vdot"`
+	Times map[string]int `json:"times"`
+}
+
+// Predictions is the response of GET /api/predictions
+type Predictions struct {
+	AsOf     string               `json:"as_of"`
+	VDOT     *float64             `json:"vdot"`
+	Evidence []PredictionEvidence `json:"evidence"`
+	Races    []RacePrediction     `json:"races"`
+	History  []PredictionPoint    `json:"history"` // weekly, oldest first
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// PersonalRecord is a best effort in one record category. Race distance records
+// hold the time projected from the session's average pace.
+type PersonalRecord struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	Category     string     `json:"category"` // "1k", "5k", "10k", "half_marathon", "marathon" or "longest_run"
+	SessionID    int64      `json:"session_id"`
+	Distance     float64    `json:"distance"` // km
+	Duration     int        `json:"duration"` // seconds
+	AchievedAt   time.Time  `json:"achieved_at"`
+	SupersededAt *time.Time `json:"superseded_at,omitempty"`
+}
+
+// PersonalRecordEntry is the current record of a category with the session it came from
+// and the records it replaced, most recent first
+type PersonalRecordEntry struct {
+	Category string           `json:"category"`
+	Record   *PersonalRecord  `json:"record"`
+	Session  *Session         `json:"session"`
+	History  []PersonalRecord `json:"history"`
+}
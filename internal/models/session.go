@@ -1,17 +1,25 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 type Session struct {
-	ID               int64     `json:"id"`
-	Date             time.Time `json:"date"`
-	Distance         float64   `json:"distance"`
-	Duration         int       `json:"duration"`
-	Notes            string    `json:"notes"`
-	StravaActivityID *int64    `json:"strava_activity_id,omitempty"`
-	Source           string    `json:"source"` // "manual" or "strava"
-	CreatedAt        time.Time `json:"created_at"`
-	UpdatedAt        time.Time `json:"updated_at"`
+	ID               int64      `json:"id"`
+	UserID           int64      `json:"user_id"`
+	Date             time.Time  `json:"date"`
+	Distance         float64    `json:"distance"`
+	Duration         int        `json:"duration"`
+	Notes            string     `json:"notes"`
+	ElevationGain    *float64   `json:"elevation_gain,omitempty"` // meters
+	AvgHeartRate     *int       `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate     *int       `json:"max_heart_rate,omitempty"`
+	StravaActivityID *int64     `json:"strava_activity_id,omitempty"`
+	Source           string     `json:"source"` // "manual", "strava", "gpx", "fit" or "csv"
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	DeletedAt        *time.Time `json:"deleted_at,omitempty"`
 }
 
 type CreateSessionRequest struct {
@@ -20,3 +28,71 @@ type CreateSessionRequest struct {
 	Duration int       `json:"duration"`
 	Notes    string    `json:"notes"`
 }
+
+// Validate checks the rules every created or updated session must satisfy
+func (r CreateSessionRequest) Validate() error {
+	if r.Distance <= 0 {
+		return errors.New("Distance must be greater than 0")
+	}
+
+	if r.Duration <= 0 {
+		return errors.New("Duration must be greater than 0")
+	}
+
+	return nil
+}
+
+// TrackPoint is a recorded GPS position belonging to an imported session
+type TrackPoint struct {
+	Latitude  float64    `json:"lat"`
+	Longitude float64    `json:"lon"`
+	Elevation *float64   `json:"elevation,omitempty"` // meters
+	Time      *time.Time `json:"time,omitempty"`
+}
+
+// Lap is a device-recorded lap of an imported session
+type Lap struct {
+	LapIndex      int       `json:"lap_index"`
+	StartTime     time.Time `json:"start_time"`
+	Distance      float64   `json:"distance"`     // km
+	Duration      int       `json:"duration"`     // moving seconds
+	ElapsedTime   int       `json:"elapsed_time"` // seconds including pauses
+	ElevationGain *float64  `json:"elevation_gain,omitempty"`
+	AvgHeartRate  *int      `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate  *int      `json:"max_heart_rate,omitempty"`
+	AvgCadence    *int      `json:"avg_cadence,omitempty"`
+	AvgPower      *int      `json:"avg_power,omitempty"`
+}
+
+// SessionRecord is a per-second device sample of an imported session
+type SessionRecord struct {
+	Time      time.Time `json:"time"`
+	Latitude  *float64  `json:"lat,omitempty"`
+	Longitude *float64  `json:"lon,omitempty"`
+	Altitude  *float64  `json:"altitude,omitempty"` // meters
+	Distance  *float64  `json:"distance,omitempty"` // km from start
+	Speed     *float64  `json:"speed,omitempty"`    // m/s
+	HeartRate *int      `json:"heart_rate,omitempty"`
+	Cadence   *int      `json:"cadence,omitempty"`
+	Power     *int      `json:"power,omitempty"`
+}
+
+// SessionQuery selects, filters, sorts and pages a user's session listing
+type SessionQuery struct {
+	StartDate   time.Time
+	EndDate     time.Time
+	Sort        string // "date", "distance", "duration" or "pace"
+	Order       string // "asc" or "desc"
+	Limit       int
+	Cursor      string // opaque, from a previous SessionPage.NextCursor
+	Source      string // optional exact source match
+	MinDistance *float64
+	MaxDistance *float64
+	Search      string // optional case-insensitive substring of notes
+}
+
+// SessionPage is one page of a session listing
+type SessionPage struct {
+	Sessions   []Session `json:"sessions"`
+	NextCursor *string   `json:"next_cursor"`
+}
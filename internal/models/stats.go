@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// SummaryQuery selects the buckets of a training summary. From and To are calendar days
+// in Location and are widened to whole periods.
+type SummaryQuery struct {
+	Period    string // "week", "month" or "year"
+	From      time.Time
+	To        time.Time
+	WeekStart time.Weekday
+	Location  *time.Location
+}
+
+// SummaryBucket aggregates a user's sessions over one week, month or year
+type SummaryBucket struct {
+	PeriodStart   string   `json:"period_start"` // YYYY-MM-DD in the requested time zone
+	PeriodEnd     string   `json:"period_end"`   // last day of the period, inclusive
+	TotalDistance float64  `json:"total_distance"`
+	TotalDuration int      `json:"total_duration"` // seconds
+	RunCount      int      `json:"run_count"`
+	AvgPace       *float64 `json:"avg_pace"` // seconds per km, null without runs
+	LongestRun    float64  `json:"longest_run"`
+}
+
+// StatsSummary is the response of GET /api/stats/summary
+type StatsSummary struct {
+	Period    string          `json:"period"`
+	TimeZone  string          `json:"time_zone"`
+	WeekStart string          `json:"week_start,omitempty"`
+	Buckets   []SummaryBucket `json:"buckets"`
+}
+
+// Methods used to estimate a session's intensity
+const (
+	StressMethodHeartRate = "heart_rate"
+	StressMethodPace      = "pace"
+	StressMethodEstimated = "estimated" // neither pace nor heart rate is known
+)
+
+// SessionStress is the training stress of one session: an hour at threshold intensity
+// scores 100. Intensity is relative to the user's threshold, 1.0 being threshold effort.
+type SessionStress struct {
+	SessionID int64   `json:"session_id"`
+	Date      string  `json:"date"` // YYYY-MM-DD the session was run on
+	Stress    float64 `json:"stress"`
+	Intensity float64 `json:"intensity"`
+	Method    string  `json:"method"` // "heart_rate", "pace" or "estimated"
+}
+
+// TrainingLoadDay holds the stress of one day and the load it leaves behind. ATL (fatigue)
+// and CTL (fitness) are 7 and 42 day exponentially weighted averages of daily stress; TSB
+// (form) is the CTL minus ATL going into the day.
+type TrainingLoadDay struct {
+	Date   string  `json:"date"`
+	Stress float64 `json:"stress"`
+	ATL    float64 `json:"atl"`
+	CTL    float64 `json:"ctl"`
+	TSB    float64 `json:"tsb"`
+}
+
+// TrainingLoad is the response of GET /api/stats/training-load
+type TrainingLoad struct {
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Days     []TrainingLoadDay `json:"days"`
+	Sessions []SessionStress   `json:"sessions"`
+}
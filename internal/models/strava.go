@@ -5,21 +5,43 @@ import "time"
 // StravaConnection represents a connection to a Strava account
 type StravaConnection struct {
 	ID              int64      `json:"id"`
-	UserID          *int64     `json:"user_id,omitempty"` // Future-proofing for multi-user
+	UserID          int64      `json:"user_id"`
 	StravaAthleteID int64      `json:"strava_athlete_id"`
 	AccessToken     string     `json:"-"` // Never expose in JSON
 	RefreshToken    string     `json:"-"` // Never expose in JSON
 	TokenExpiresAt  time.Time  `json:"token_expires_at"`
 	ConnectedAt     time.Time  `json:"connected_at"`
 	LastSync        *time.Time `json:"last_sync,omitempty"`
+	Sync            StravaSync `json:"sync"`
+}
+
+// Strava sync states; an empty status means no sync has run yet
+const (
+	StravaSyncRunning   = "running"
+	StravaSyncCompleted = "completed"
+	StravaSyncFailed    = "failed"
+)
+
+// StravaSync is the progress of the latest activity backfill. Fetched counts the activities
+// read from Strava so far and Imported the sessions created from them. ResumeAt is set while
+// a running sync waits for Strava's rate limits to reset.
+type StravaSync struct {
+	Status     string     `json:"status"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	ResumeAt   *time.Time `json:"resume_at,omitempty"`
+	Fetched    int        `json:"fetched"`
+	Imported   int        `json:"imported"`
+	Error      string     `json:"error,omitempty"`
 }
 
 // StravaConnectionStatus is returned to the frontend
 type StravaConnectionStatus struct {
-	Connected       bool       `json:"connected"`
-	StravaAthleteID int64      `json:"strava_athlete_id,omitempty"`
-	ConnectedAt     time.Time  `json:"connected_at,omitempty"`
-	LastSync        *time.Time `json:"last_sync,omitempty"`
+	Connected       bool        `json:"connected"`
+	StravaAthleteID int64       `json:"strava_athlete_id,omitempty"`
+	ConnectedAt     time.Time   `json:"connected_at,omitempty"`
+	LastSync        *time.Time  `json:"last_sync,omitempty"`
+	Sync            *StravaSync `json:"sync,omitempty"`
 }
 
 // WebhookEvent represents a Strava webhook event
@@ -33,6 +55,27 @@ type WebhookEvent struct {
 	Updates        map[string]interface{} `json:"updates"`         // Changed fields
 }
 
+// Webhook event states: pending events wait for their next attempt, processing ones are
+// claimed by a worker, done ones succeeded and dead ones ran out of attempts
+const (
+	WebhookEventPending    = "pending"
+	WebhookEventProcessing = "processing"
+	WebhookEventDone       = "done"
+	WebhookEventDead       = "dead"
+)
+
+// QueuedWebhookEvent is a webhook event stored in the queue with its delivery state
+type QueuedWebhookEvent struct {
+	ID            int64        `json:"id"`
+	Event         WebhookEvent `json:"event"`
+	Status        string       `json:"status"`
+	Attempts      int          `json:"attempts"`
+	LastError     string       `json:"last_error,omitempty"`
+	ReceivedAt    time.Time    `json:"received_at"`
+	NextAttemptAt time.Time    `json:"next_attempt_at"`
+	ProcessedAt   *time.Time   `json:"processed_at,omitempty"`
+}
+
 // StravaActivity represents a Strava activity from the API
 type StravaActivity struct {
 	ID         int64     `json:"id"`
@@ -0,0 +1,204 @@
+// Package plans generates training plans that build towards a race.
+package plans
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// ErrUnknownRace is returned for race distances without a plan template
+var ErrUnknownRace = errors.New("unknown race distance")
+
+// template shapes the plan for one race distance. Volumes are km per week.
+type template struct {
+	Name         string
+	Weeks        int // preferred plan length
+	MinWeeks     int // shortest plan that still makes sense
+	TaperWeeks   int // reduced weeks before the race, including race week
+	BaseVolume   float64
+	PeakVolume   float64
+	LongRunCap   float64 // km
+	RaceKm       float64
+	IntervalDesc string
+}
+
+var templates = map[string]template{
+	models.RaceDistance5K: {
+		Name: "5K", Weeks: 8, MinWeeks: 4, TaperWeeks: 1,
+		BaseVolume: 15, PeakVolume: 35, LongRunCap: 12, RaceKm: 5,
+		IntervalDesc: "8 x 400m at mile pace with 200m jog recoveries",
+	},
+	models.RaceDistance10K: {
+		Name: "10K", Weeks: 10, MinWeeks: 6, TaperWeeks: 1,
+		BaseVolume: 20, PeakVolume: 45, LongRunCap: 16, RaceKm: 10,
+		IntervalDesc: "5 x 1km at 5K pace with 400m jog recoveries",
+	},
+	models.RaceDistanceHalfMarathon: {
+		Name: "Half Marathon", Weeks: 12, MinWeeks: 8, TaperWeeks: 2,
+		BaseVolume: 25, PeakVolume: 55, LongRunCap: 21, RaceKm: 21.0975,
+		IntervalDesc: "4 x 2km at 10K pace with 400m jog recoveries",
+	},
+	models.RaceDistanceMarathon: {
+		Name: "Marathon", Weeks: 16, MinWeeks: 12, TaperWeeks: 3,
+		BaseVolume: 30, PeakVolume: 70, LongRunCap: 32, RaceKm: 42.195,
+		IntervalDesc: "3 x 3km at half marathon pace with 800m jog recoveries",
+	},
+}
+
+// taperFactors scale the peak volume in the final weeks, indexed by weeks before race week
+var taperFactors = []float64{0.5, 0.7, 0.85}
+
+const (
+	// weeklyIncrease is the build-up between consecutive weeks
+	weeklyIncrease = 1.1
+	// cutbackFactor reduces every fourth week to absorb the training
+	cutbackFactor = 0.8
+	// minRunKm keeps generated runs worth lacing up for
+	minRunKm = 3
+)
+
+// dayShare is how a week's volume is spread over its days, counted from the first day of
+// the plan week. Days without a share are rest days.
+var dayShare = []struct {
+	Offset int
+	Type   string
+	Share  float64
+}{
+	{Offset: 1, Type: models.WorkoutEasy, Share: 0.20},
+	{Offset: 2, Type: models.WorkoutIntervals, Share: 0.15}, // alternates with tempo
+	{Offset: 3, Type: models.WorkoutEasy, Share: 0.15},
+	{Offset: 5, Type: models.WorkoutRecovery, Share: 0.15},
+	{Offset: 6, Type: models.WorkoutLong, Share: 0.35},
+}
+
+// Plan is a generated schedule; StartDate is the first day of its first week
+type Plan struct {
+	StartDate time.Time
+	Workouts  []models.PlannedWorkoutRequest
+}
+
+// DefaultName returns the name given to a generated plan for a race distance
+func DefaultName(raceDistance string) string {
+	if t, ok := templates[raceDistance]; ok {
+		return t.Name + " Plan"
+	}
+	return "Training Plan"
+}
+
+// Generate schedules the workouts of a plan that starts on or after start and ends with the
+// race on raceDate. The plan is as long as its template prefers when there is time, and
+// builds from the runner's current weekly volume, in km, towards the template's peak.
+func Generate(raceDistance string, raceDate, start time.Time, weeklyVolume float64) (*Plan, error) {
+	t, ok := templates[raceDistance]
+	if !ok {
+		return nil, ErrUnknownRace
+	}
+
+	raceDay := day(raceDate)
+	days := int(math.Round(raceDay.Sub(day(start)).Hours()/24)) + 1
+	weeks := min(days/7, t.Weeks)
+	if weeks < t.MinWeeks {
+		return nil, fmt.Errorf("the race is %d days away but a %s plan needs at least %d weeks", days, t.Name, t.MinWeeks)
+	}
+
+	// The race falls on the last day of the last plan week
+	planStart := raceDay.AddDate(0, 0, -(weeks*7 - 1))
+
+	volumes := weeklyVolumes(t, weeks, weeklyVolume)
+
+	var workouts []models.PlannedWorkoutRequest
+	for w, volume := range volumes {
+		weekStart := planStart.AddDate(0, 0, 7*w)
+		raceWeek := w == weeks-1
+
+		for _, d := range dayShare {
+			date := weekStart.AddDate(0, 0, d.Offset).Format("2006-01-02")
+
+			if raceWeek && d.Type == models.WorkoutLong {
+				workouts = append(workouts, models.PlannedWorkoutRequest{
+					Date:        date,
+					WorkoutType: models.WorkoutRace,
+					Distance:    t.RaceKm,
+					Description: t.Name + " race day",
+				})
+				continue
+			}
+
+			workout := models.PlannedWorkoutRequest{
+				Date:        date,
+				WorkoutType: d.Type,
+				Distance:    roundKm(volume * d.Share),
+			}
+
+			switch d.Type {
+			case models.WorkoutEasy:
+				workout.Description = "Easy run at conversational pace"
+			case models.WorkoutRecovery:
+				workout.Description = "Short recovery run, keep it very easy"
+			case models.WorkoutLong:
+				workout.Distance = math.Min(workout.Distance, t.LongRunCap)
+				workout.Description = "Long run at easy pace"
+			case models.WorkoutIntervals:
+				if raceWeek {
+					workout.WorkoutType = models.WorkoutTempo
+					workout.Description = "Easy run with 4 x 1 min at race pace to stay sharp"
+				} else if w%2 == 1 {
+					workout.WorkoutType = models.WorkoutTempo
+					workout.Description = "Tempo: 20-30 min at comfortably hard effort, with easy warm-up and cool-down"
+				} else {
+					workout.Description = "Intervals: " + t.IntervalDesc + ", with easy warm-up and cool-down"
+				}
+			}
+
+			workouts = append(workouts, workout)
+		}
+	}
+
+	return &Plan{StartDate: planStart, Workouts: workouts}, nil
+}
+
+// weeklyVolumes plans the km of every week: a steady build with a cutback every fourth
+// week, then a taper into the race
+func weeklyVolumes(t template, weeks int, current float64) []float64 {
+	base := math.Max(current, t.BaseVolume)
+	peak := math.Max(t.PeakVolume, base)
+
+	taperWeeks := min(t.TaperWeeks, weeks)
+	buildWeeks := weeks - taperWeeks
+
+	volumes := make([]float64, 0, weeks)
+	volume := base
+	top := base
+	for w := 0; w < buildWeeks; w++ {
+		if w%4 == 3 {
+			volumes = append(volumes, volume*cutbackFactor)
+			continue
+		}
+		if w > 0 {
+			volume = math.Min(volume*weeklyIncrease, peak)
+		}
+		top = math.Max(top, volume)
+		volumes = append(volumes, volume)
+	}
+
+	for w := taperWeeks - 1; w >= 0; w-- {
+		volumes = append(volumes, top*taperFactors[min(w, len(taperFactors)-1)])
+	}
+
+	return volumes
+}
+
+// roundKm rounds to the nearest half kilometer, with a floor of minRunKm
+func roundKm(km float64) float64 {
+	return math.Max(math.Round(km*2)/2, minRunKm)
+}
+
+// day truncates t to midnight UTC of its calendar date
+func day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
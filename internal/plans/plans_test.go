@@ -0,0 +1,101 @@
+package plans
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+func TestGenerate(t *testing.T) {
+	start := time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		race      string
+		raceDate  time.Time
+		wantWeeks int
+		wantKm    float64
+	}{
+		{models.RaceDistance5K, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), 8, 5},
+		{models.RaceDistance10K, time.Date(2024, 2, 25, 0, 0, 0, 0, time.UTC), 8, 10},
+		{models.RaceDistanceHalfMarathon, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), 12, 21.0975},
+		{models.RaceDistanceMarathon, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), 16, 42.195},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.race, func(t *testing.T) {
+			plan, err := Generate(tt.race, tt.raceDate, start, 20)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			workouts := plan.Workouts
+
+			if len(workouts) != tt.wantWeeks*len(dayShare) {
+				t.Fatalf("Expected %d workouts, got %d", tt.wantWeeks*len(dayShare), len(workouts))
+			}
+
+			race := workouts[len(workouts)-1]
+			if race.WorkoutType != models.WorkoutRace || race.Date != tt.raceDate.Format("2006-01-02") || race.Distance != tt.wantKm {
+				t.Errorf("Expected the plan to end with the race, got %+v", race)
+			}
+
+			if plan.StartDate.Before(start.Truncate(24*time.Hour)) || plan.StartDate.Weekday() != tt.raceDate.AddDate(0, 0, 1).Weekday() {
+				t.Errorf("Unexpected plan start %s for a race on %s", plan.StartDate.Format("2006-01-02"), tt.raceDate.Format("2006-01-02"))
+			}
+
+			tmpl := templates[tt.race]
+			prev := ""
+			for _, w := range workouts {
+				if err := w.Validate(); err != nil {
+					t.Errorf("Generated an invalid workout %+v: %v", w, err)
+				}
+				if w.Date <= prev {
+					t.Errorf("Workouts out of order at %s", w.Date)
+				}
+				prev = w.Date
+				if w.WorkoutType == models.WorkoutLong && w.Distance > tmpl.LongRunCap {
+					t.Errorf("Long run of %.1fkm exceeds the %.1fkm cap", w.Distance, tmpl.LongRunCap)
+				}
+				if w.WorkoutType == models.WorkoutIntervals && !strings.HasPrefix(w.Description, "Intervals:") {
+					t.Errorf("Unexpected interval description %q", w.Description)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateRaceTooSoon(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := Generate(models.RaceDistanceMarathon, start.AddDate(0, 0, 40), start, 30)
+	if err == nil || !strings.Contains(err.Error(), "at least 12 weeks") {
+		t.Fatalf("Expected a too-soon error, got %v", err)
+	}
+
+	if _, err := Generate("ultra", start.AddDate(1, 0, 0), start, 30); err != ErrUnknownRace {
+		t.Fatalf("Expected ErrUnknownRace, got %v", err)
+	}
+}
+
+func TestWeeklyVolumes(t *testing.T) {
+	volumes := weeklyVolumes(templates[models.RaceDistanceHalfMarathon], 12, 20)
+
+	want := []float64{25, 27.5, 30.25, 24.2, 33.28, 36.6, 40.26, 32.21, 44.29, 48.72, 34.1, 24.36}
+	if len(volumes) != len(want) {
+		t.Fatalf("Expected %d weeks, got %d", len(want), len(volumes))
+	}
+	for i := range want {
+		if diff := volumes[i] - want[i]; diff > 0.01 || diff < -0.01 {
+			t.Errorf("Week %d: expected %.2fkm, got %.2fkm", i+1, want[i], volumes[i])
+		}
+	}
+
+	// A runner already above the template's peak keeps their volume
+	high := weeklyVolumes(templates[models.RaceDistance5K], 8, 60)
+	for i, v := range high[:7] {
+		if v > 60 {
+			t.Errorf("Week %d: volume %.2f exceeds the runner's current 60km", i+1, v)
+		}
+	}
+}
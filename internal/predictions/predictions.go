@@ -0,0 +1,151 @@
+// Package predictions estimates running fitness from recent sessions and predicts race times.
+package predictions
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+const (
+	// RiegelExponent is the fatigue factor of Riegel's race time formula
+	RiegelExponent = 1.06
+
+	// Window is how far back sessions count as evidence of current fitness
+	Window = 90 * 24 * time.Hour
+	// MaxEvidence is how many of the best efforts are reported as evidence
+	MaxEvidence = 3
+
+	// minEffortDuration and minEffortDistance keep short efforts, where the VDOT model
+	// doesn't hold, out of the evidence
+	minEffortDuration = 600 // seconds
+	minEffortDistance = 1.5 // km
+
+	// minVDOT and maxVDOT bound plausible scores; anything outside is most likely bad GPS data
+	minVDOT = 20
+	maxVDOT = 90
+)
+
+// Race is a distance race times are predicted for
+type Race struct {
+	Name     string
+	Distance float64 // km
+}
+
+// Races are the distances every prediction covers
+var Races = []Race{
+	{Name: models.RaceDistance5K, Distance: 5},
+	{Name: models.RaceDistance10K, Distance: 10},
+	{Name: models.RaceDistanceHalfMarathon, Distance: 21.0975},
+	{Name: models.RaceDistanceMarathon, Distance: 42.195},
+}
+
+// VDOT scores a run of distance km in seconds with Daniels and Gilbert's formulas: the VO2
+// the run's speed demands divided by the share of VO2max that can be held for its duration
+func VDOT(distance float64, seconds float64) float64 {
+	minutes := seconds / 60
+	velocity := distance * 1000 / minutes // meters per minute
+
+	vo2 := -4.60 + 0.182258*velocity + 0.000104*velocity*velocity
+	fraction := 0.8 + 0.1894393*math.Exp(-0.012778*minutes) + 0.2989558*math.Exp(-0.1932605*minutes)
+
+	return vo2 / fraction
+}
+
+// TimeForVDOT returns the seconds in which a runner of the given VDOT covers distance km
+func TimeForVDOT(vdot, distance float64) float64 {
+	// VDOT falls as time rises, so bisect between 2:00 and 30:00 per km
+	lo, hi := distance*120, distance*1800
+	for i := 0; i < 100; i++ {
+		mid := (lo + hi) / 2
+		if VDOT(distance, mid) > vdot {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return (lo + hi) / 2
+}
+
+// Riegel projects a time of seconds over distance km to the target distance
+func Riegel(distance, seconds, target float64) float64 {
+	return seconds * math.Pow(target/distance, RiegelExponent)
+}
+
+// Estimate is the fitness estimate and race predictions as of a day
+type Estimate struct {
+	VDOT     float64
+	Evidence []models.PredictionEvidence // best efforts first
+	Races    []models.RacePrediction
+}
+
+// Predict estimates fitness from the best effort among the sessions run in the Window up
+// to asOf. VDOT predictions come from that effort; Riegel predictions project each race
+// from the evidence session closest to it in distance. Returns nil without any efforts.
+func Predict(sessions []models.Session, asOf time.Time) *Estimate {
+	since := asOf.Add(-Window)
+
+	var efforts []models.PredictionEvidence
+	for _, s := range sessions {
+		if s.Date.After(asOf) || !s.Date.After(since) {
+			continue
+		}
+		if s.Duration < minEffortDuration || s.Distance < minEffortDistance {
+			continue
+		}
+
+		vdot := VDOT(s.Distance, float64(s.Duration))
+		if vdot < minVDOT || vdot > maxVDOT {
+			continue
+		}
+		efforts = append(efforts, models.PredictionEvidence{Session: s, VDOT: round2(vdot)})
+	}
+
+	if len(efforts) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(efforts, func(i, j int) bool {
+		return efforts[i].VDOT > efforts[j].VDOT
+	})
+	if len(efforts) > MaxEvidence {
+		efforts = efforts[:MaxEvidence]
+	}
+
+	estimate := &Estimate{VDOT: efforts[0].VDOT, Evidence: efforts}
+	for _, race := range Races {
+		vdotTime := TimeForVDOT(estimate.VDOT, race.Distance)
+
+		closest := efforts[0].Session
+		for _, e := range efforts[1:] {
+			if distanceRatio(e.Session.Distance, race.Distance) < distanceRatio(closest.Distance, race.Distance) {
+				closest = e.Session
+			}
+		}
+		riegelTime := Riegel(closest.Distance, float64(closest.Duration), race.Distance)
+
+		predicted := (vdotTime + riegelTime) / 2
+		estimate.Races = append(estimate.Races, models.RacePrediction{
+			Race:       race.Name,
+			Distance:   race.Distance,
+			Time:       int(math.Round(predicted)),
+			Pace:       round2(predicted / race.Distance),
+			VDOTTime:   int(math.Round(vdotTime)),
+			RiegelTime: int(math.Round(riegelTime)),
+		})
+	}
+
+	return estimate
+}
+
+// distanceRatio measures how far apart two distances are, independent of which is longer
+func distanceRatio(a, b float64) float64 {
+	return math.Abs(math.Log(a / b))
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,96 @@
+package predictions
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+func TestTimeForVDOT(t *testing.T) {
+	// Race times of a VDOT 50 runner from Daniels' tables
+	tests := []struct {
+		distance float64
+		want     float64
+	}{
+		{5, 19*60 + 57},
+		{10, 41*60 + 21},
+		{21.0975, 1*3600 + 31*60 + 35},
+		{42.195, 3*3600 + 10*60 + 49},
+	}
+
+	for _, tt := range tests {
+		got := TimeForVDOT(50, tt.distance)
+		if math.Abs(got-tt.want) > 15 {
+			t.Errorf("%.1fkm: expected about %.0fs, got %.0fs", tt.distance, tt.want, got)
+		}
+		if vdot := VDOT(tt.distance, got); math.Abs(vdot-50) > 0.001 {
+			t.Errorf("%.1fkm: round trip gave VDOT %.3f", tt.distance, vdot)
+		}
+	}
+}
+
+func TestRiegel(t *testing.T) {
+	got := Riegel(10, 2400, 21.0975)
+	if math.Abs(got-5295.37) > 0.01 {
+		t.Errorf("Expected 5295.37s, got %.2f", got)
+	}
+}
+
+func TestPredict(t *testing.T) {
+	asOf := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	session := func(id int64, daysAgo int, distance float64, duration int) models.Session {
+		return models.Session{ID: id, Date: asOf.AddDate(0, 0, -daysAgo), Distance: distance, Duration: duration}
+	}
+
+	sessions := []models.Session{
+		session(1, 10, 5, 1200),    // 20:00 5k, VDOT 49.81
+		session(2, 20, 10, 2700),   // 45:00 10k
+		session(3, 30, 21.1, 6600), // 1:50 half
+		session(4, 5, 8, 3600),     // easy run
+		session(5, 120, 5, 1080),   // faster 5k, but outside the window
+		session(6, 3, 1, 200),      // too short
+		session(7, 2, 10, 1200),    // bad GPS: 10k in 20 minutes
+		session(8, -1, 5, 1100),    // after asOf
+	}
+
+	estimate := Predict(sessions, asOf)
+	if estimate == nil {
+		t.Fatal("Expected an estimate")
+	}
+
+	if estimate.VDOT != 49.81 {
+		t.Errorf("Expected VDOT 49.81, got %.2f", estimate.VDOT)
+	}
+
+	if len(estimate.Evidence) != MaxEvidence {
+		t.Fatalf("Expected %d evidence sessions, got %d", MaxEvidence, len(estimate.Evidence))
+	}
+	for i, want := range []int64{1, 2, 3} {
+		if estimate.Evidence[i].Session.ID != want {
+			t.Errorf("Evidence %d: expected session %d, got %d", i, want, estimate.Evidence[i].Session.ID)
+		}
+	}
+
+	if len(estimate.Races) != len(Races) {
+		t.Fatalf("Expected %d races, got %d", len(Races), len(estimate.Races))
+	}
+
+	// The 5k is projected from the 5k itself, the half from the half
+	fiveK := estimate.Races[0]
+	if fiveK.Race != models.RaceDistance5K || fiveK.RiegelTime != 1200 {
+		t.Errorf("Expected the 5k Riegel time to be the 5k run, got %+v", fiveK)
+	}
+	half := estimate.Races[2]
+	if want := int(math.Round(Riegel(21.1, 6600, 21.0975))); half.RiegelTime != want {
+		t.Errorf("Expected the half to be projected from the half, got %d want %d", half.RiegelTime, want)
+	}
+	if half.Time != int(math.Round((TimeForVDOT(49.81, 21.0975)+Riegel(21.1, 6600, 21.0975))/2)) {
+		t.Errorf("Expected the average of both predictions, got %+v", half)
+	}
+
+	if Predict(sessions, asOf.AddDate(1, 0, 0)) != nil {
+		t.Error("Expected no estimate once every session is outside the window")
+	}
+}
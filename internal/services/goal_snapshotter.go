@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/thc/runna-backend/internal/database"
+)
+
+// GoalSnapshotter periodically rolls recurring goals into their current period and
+// records the daily progress snapshot of every active goal
+type GoalSnapshotter struct {
+	db       *database.DB
+	interval time.Duration
+}
+
+func NewGoalSnapshotter(db *database.DB, interval time.Duration) *GoalSnapshotter {
+	return &GoalSnapshotter{
+		db:       db,
+		interval: interval,
+	}
+}
+
+// Run records once immediately and then on every interval until ctx is cancelled
+func (s *GoalSnapshotter) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.record()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *GoalSnapshotter) record() {
+	now := time.Now()
+
+	rolled, err := s.db.RollRecurringGoals(now)
+	if err != nil {
+		log.Printf("[ERROR] GoalSnapshotter: Failed to roll recurring goals: %v", err)
+	} else if rolled > 0 {
+		log.Printf("[INFO] GoalSnapshotter: Rolled %d recurring goals into a new period", rolled)
+	}
+
+	recorded, err := s.db.RecordGoalSnapshots(now)
+	if err != nil {
+		log.Printf("[ERROR] GoalSnapshotter: Failed to record goal snapshots: %v", err)
+		return
+	}
+
+	if recorded > 0 {
+		log.Printf("[INFO] GoalSnapshotter: Recorded snapshots for %d goals", recorded)
+	}
+}
@@ -7,32 +7,64 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/thc/runna-backend/internal/models"
 )
 
+// Strava's production endpoints, the defaults for NewStravaClient
 const (
-	stravaAPIBase  = "https://www.strava.com/api/v3"
-	stravaTokenURL = "https://www.strava.com/oauth/token"
+	StravaAPIBase  = "https://www.strava.com/api/v3"
+	StravaTokenURL = "https://www.strava.com/oauth/token"
 )
 
 type StravaClient struct {
 	httpClient *http.Client
+	limiter    *rateLimiter
+	apiBase    string
+	tokenURL   string
 }
 
-func NewStravaClient() *StravaClient {
+// NewStravaClient returns a client of the API at apiBase that exchanges and refreshes tokens
+// at tokenURL; usually StravaAPIBase and StravaTokenURL
+func NewStravaClient(apiBase, tokenURL string) *StravaClient {
 	return &StravaClient{
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
+		limiter:  &rateLimiter{},
+		apiBase:  strings.TrimSuffix(apiBase, "/"),
+		tokenURL: tokenURL,
 	}
 }
 
+// doAPI sends a request to the rate-limited API. It returns a *RateLimitError without sending
+// the request when the budget is used up, and in place of a 429 response.
+func (c *StravaClient) doAPI(req *http.Request) (*http.Response, error) {
+	if err := c.limiter.reserve(time.Now()); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.limiter.update(resp.Header, time.Now())
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		resp.Body.Close()
+		return nil, &RateLimitError{RetryAt: c.limiter.retryAt(time.Now())}
+	}
+
+	return resp, nil
+}
+
 // GetActivity fetches activity details from Strava API
 func (c *StravaClient) GetActivity(accessToken string, activityID int64) (*models.StravaActivity, error) {
-	url := fmt.Sprintf("%s/activities/%d", stravaAPIBase, activityID)
+	url := fmt.Sprintf("%s/activities/%d", c.apiBase, activityID)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -41,7 +73,7 @@ func (c *StravaClient) GetActivity(accessToken string, activityID int64) (*model
 
 	req.Header.Set("Authorization", "Bearer "+accessToken)
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.doAPI(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch activity: %w", err)
 	}
@@ -60,6 +92,40 @@ func (c *StravaClient) GetActivity(accessToken string, activityID int64) (*model
 	return &activity, nil
 }
 
+// ListActivities fetches one page of the athlete's activities that started after the given
+// Unix time, oldest first. An empty page means there are no more.
+func (c *StravaClient) ListActivities(accessToken string, after int64, page, perPage int) ([]models.StravaActivity, error) {
+	params := url.Values{}
+	params.Set("after", strconv.FormatInt(after, 10))
+	params.Set("page", strconv.Itoa(page))
+	params.Set("per_page", strconv.Itoa(perPage))
+
+	req, err := http.NewRequest("GET", c.apiBase+"/athlete/activities?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := c.doAPI(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch activities: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("strava API error: status=%d, body=%s", resp.StatusCode, string(body))
+	}
+
+	var activities []models.StravaActivity
+	if err := json.NewDecoder(resp.Body).Decode(&activities); err != nil {
+		return nil, fmt.Errorf("failed to decode activities: %w", err)
+	}
+
+	return activities, nil
+}
+
 // RefreshToken exchanges a refresh token for a new access token
 func (c *StravaClient) RefreshToken(refreshToken string) (*models.StravaTokenResponse, error) {
 	clientID := os.Getenv("STRAVA_CLIENT_ID")
@@ -75,7 +141,7 @@ func (c *StravaClient) RefreshToken(refreshToken string) (*models.StravaTokenRes
 	data.Set("grant_type", "refresh_token")
 	data.Set("refresh_token", refreshToken)
 
-	req, err := http.NewRequest("POST", stravaTokenURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequest("POST", c.tokenURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -116,7 +182,7 @@ func (c *StravaClient) ExchangeToken(code string) (*models.StravaTokenResponse,
 	data.Set("code", code)
 	data.Set("grant_type", "authorization_code")
 
-	req, err := http.NewRequest("POST", stravaTokenURL, strings.NewReader(data.Encode()))
+	req, err := http.NewRequest("POST", c.tokenURL, strings.NewReader(data.Encode()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
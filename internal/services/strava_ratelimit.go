@@ -0,0 +1,135 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// rateLimitWindow is Strava's short rate limit window; windows start at every quarter hour
+	// and the daily window at midnight UTC
+	rateLimitWindow = 15 * time.Minute
+	// rateLimitMargin keeps a few requests of each budget spare for requests already in flight
+	rateLimitMargin = 2
+)
+
+// RateLimitError is returned instead of calling Strava when a request would exceed the
+// application's rate limits, or when Strava rejected it for exceeding them. The work can be
+// retried from RetryAt, when the exhausted window resets.
+type RateLimitError struct {
+	RetryAt time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("strava rate limit reached, retry at %s", e.RetryAt.Format(time.RFC3339))
+}
+
+// rateLimiter tracks the application's usage of Strava's 15-minute and daily request budgets,
+// as last reported by the X-RateLimit-Limit and X-RateLimit-Usage headers, and counts the
+// requests sent since
+type rateLimiter struct {
+	mu         sync.Mutex
+	shortLimit int
+	shortUsage int
+	dailyLimit int
+	dailyUsage int
+	observed   time.Time // when the usage was last reported or counted
+}
+
+// reserve counts a request about to be sent at now, or returns a *RateLimitError if either
+// budget is used up. Until Strava has reported its limits every request is let through.
+func (l *rateLimiter) reserve(now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.observed.IsZero() {
+		return nil
+	}
+
+	l.resetElapsed(now)
+
+	if l.dailyLimit > 0 && l.dailyUsage >= l.dailyLimit-rateLimitMargin {
+		return &RateLimitError{RetryAt: nextRateLimitDay(now)}
+	}
+	if l.shortLimit > 0 && l.shortUsage >= l.shortLimit-rateLimitMargin {
+		return &RateLimitError{RetryAt: nextRateLimitWindow(now)}
+	}
+
+	l.shortUsage++
+	l.dailyUsage++
+	return nil
+}
+
+// update records the limits and usage reported in a response's headers. Responses without
+// them, such as those of the OAuth endpoints, are ignored.
+func (l *rateLimiter) update(header http.Header, now time.Time) {
+	shortLimit, dailyLimit, ok := parseRateLimitPair(header.Get("X-RateLimit-Limit"))
+	if !ok {
+		return
+	}
+	shortUsage, dailyUsage, ok := parseRateLimitPair(header.Get("X-RateLimit-Usage"))
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.shortLimit, l.dailyLimit = shortLimit, dailyLimit
+	l.shortUsage, l.dailyUsage = shortUsage, dailyUsage
+	l.observed = now
+}
+
+// retryAt returns when a request Strava rejected with 429 at now can be retried: tomorrow if
+// the daily budget is spent, otherwise when the 15-minute window resets
+func (l *rateLimiter) retryAt(now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.dailyLimit > 0 && l.dailyUsage >= l.dailyLimit {
+		return nextRateLimitDay(now)
+	}
+	return nextRateLimitWindow(now)
+}
+
+// resetElapsed forgets the usage of windows that have ended since it was observed
+func (l *rateLimiter) resetElapsed(now time.Time) {
+	if !now.UTC().Truncate(24 * time.Hour).Equal(l.observed.UTC().Truncate(24 * time.Hour)) {
+		l.dailyUsage = 0
+	}
+	if !now.Truncate(rateLimitWindow).Equal(l.observed.Truncate(rateLimitWindow)) {
+		l.shortUsage = 0
+	}
+	l.observed = now
+}
+
+func nextRateLimitWindow(now time.Time) time.Time {
+	return now.Truncate(rateLimitWindow).Add(rateLimitWindow)
+}
+
+func nextRateLimitDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// parseRateLimitPair reads a "15-minute,daily" header value
+func parseRateLimitPair(value string) (int, int, bool) {
+	short, daily, ok := strings.Cut(value, ",")
+	if !ok {
+		return 0, 0, false
+	}
+
+	s, err := strconv.Atoi(strings.TrimSpace(short))
+	if err != nil {
+		return 0, 0, false
+	}
+	d, err := strconv.Atoi(strings.TrimSpace(daily))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return s, d, true
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func rateLimitHeader(limit, usage string) http.Header {
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", limit)
+	header.Set("X-RateLimit-Usage", usage)
+	return header
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	observed := time.Date(2024, 3, 1, 10, 5, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		usage       string
+		now         time.Time
+		wantRetryAt time.Time // zero if the request may be sent
+	}{
+		{"Plenty left", "100,1000", observed.Add(time.Minute), time.Time{}},
+		{"Short budget spent", "198,1000", observed.Add(time.Minute), time.Date(2024, 3, 1, 10, 15, 0, 0, time.UTC)},
+		{"Short window reset", "200,1000", time.Date(2024, 3, 1, 10, 15, 0, 0, time.UTC), time.Time{}},
+		{"Daily budget spent", "10,1998", observed.Add(time.Minute), time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"Daily budget spent across short windows", "10,1998", observed.Add(time.Hour), time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"Day reset", "200,2000", time.Date(2024, 3, 2, 0, 0, 1, 0, time.UTC), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &rateLimiter{}
+			l.update(rateLimitHeader("200,2000", tt.usage), observed)
+
+			err := l.reserve(tt.now)
+			if tt.wantRetryAt.IsZero() {
+				if err != nil {
+					t.Fatalf("Expected the request to be let through, got %v", err)
+				}
+				return
+			}
+
+			var rateLimited *RateLimitError
+			if !errors.As(err, &rateLimited) {
+				t.Fatalf("Expected a rate limit error, got %v", err)
+			}
+			if !rateLimited.RetryAt.Equal(tt.wantRetryAt) {
+				t.Errorf("Expected retry at %s, got %s", tt.wantRetryAt, rateLimited.RetryAt)
+			}
+		})
+	}
+}
+
+func TestRateLimiterCountsRequests(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 5, 0, 0, time.UTC)
+
+	l := &rateLimiter{}
+	if err := l.reserve(now); err != nil {
+		t.Fatalf("Expected requests to be let through before any limits are known, got %v", err)
+	}
+
+	l.update(rateLimitHeader("200,2000", "195,500"), now)
+	for i := 0; i < 3; i++ {
+		if err := l.reserve(now); err != nil {
+			t.Fatalf("Request %d: expected to be let through, got %v", i+1, err)
+		}
+	}
+	if err := l.reserve(now); err == nil {
+		t.Error("Expected the request past the budget to be refused")
+	}
+}
+
+func TestRateLimiterIgnoresMissingHeaders(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 5, 0, 0, time.UTC)
+
+	l := &rateLimiter{}
+	l.update(rateLimitHeader("200,2000", "200,2000"), now)
+	l.update(http.Header{}, now)
+	l.update(rateLimitHeader("200", "5"), now)
+
+	if err := l.reserve(now); err == nil {
+		t.Error("Expected the last reported usage to be kept")
+	}
+}
+
+func TestRateLimiterRetryAt(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 50, 0, 0, time.UTC)
+
+	l := &rateLimiter{}
+	l.update(rateLimitHeader("200,2000", "201,900"), now)
+	if got, want := l.retryAt(now), time.Date(2024, 3, 1, 11, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Expected retry at %s, got %s", want, got)
+	}
+
+	l.update(rateLimitHeader("200,2000", "150,2001"), now)
+	if got, want := l.retryAt(now), time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("Expected retry at %s, got %s", want, got)
+	}
+}
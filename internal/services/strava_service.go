@@ -3,7 +3,6 @@ package services
 import (
 	"fmt"
 	"log"
-	"os"
 	"time"
 
 	"github.com/thc/runna-backend/internal/crypto"
@@ -11,18 +10,33 @@ import (
 	"github.com/thc/runna-backend/internal/models"
 )
 
+// stravaStore is the storage the Strava service works on; implemented by database.DB and
+// database.MemoryStore
+type stravaStore interface {
+	database.StravaStore
+	MatchSession(session *models.Session) (*models.PlannedWorkout, error)
+}
+
 type StravaService struct {
-	db     *database.DB
-	client *StravaClient
+	db      stravaStore
+	client  *StravaClient
+	keyring *crypto.Keyring
 }
 
-func NewStravaService(db *database.DB) *StravaService {
+// NewStravaService returns a service storing Strava tokens encrypted with keyring
+func NewStravaService(db stravaStore, client *StravaClient, keyring *crypto.Keyring) *StravaService {
 	return &StravaService{
-		db:     db,
-		client: NewStravaClient(),
+		db:      db,
+		client:  client,
+		keyring: keyring,
 	}
 }
 
+// ExchangeToken exchanges the authorization code of a user connecting Strava for tokens
+func (s *StravaService) ExchangeToken(code string) (*models.StravaTokenResponse, error) {
+	return s.client.ExchangeToken(code)
+}
+
 // ProcessWebhookEvent processes incoming Strava webhook events
 func (s *StravaService) ProcessWebhookEvent(event models.WebhookEvent) error {
 	switch event.ObjectType {
@@ -44,7 +58,7 @@ func (s *StravaService) processActivityEvent(event models.WebhookEvent) error {
 	case "update":
 		return s.ProcessActivityUpdated(event.ObjectID, event.OwnerID, event.Updates)
 	case "delete":
-		return s.ProcessActivityDeleted(event.ObjectID)
+		return s.ProcessActivityDeleted(event.ObjectID, event.OwnerID)
 	default:
 		log.Printf("Unknown aspect type: %s", event.AspectType)
 		return nil
@@ -94,7 +108,7 @@ func (s *StravaService) ProcessActivityCreated(activityID, ownerID int64) error
 	}
 
 	// Check if activity already exists
-	existing, err := s.db.GetSessionByStravaActivityID(activityID)
+	existing, err := s.db.GetSessionByStravaActivityID(conn.UserID, activityID)
 	if err != nil {
 		return fmt.Errorf("failed to check existing session: %w", err)
 	}
@@ -103,8 +117,15 @@ func (s *StravaService) ProcessActivityCreated(activityID, ownerID int64) error
 		return nil
 	}
 
-	// Convert Strava activity to session
-	session := models.Session{
+	_, err = s.importActivity(conn.UserID, *activity)
+	return err
+}
+
+// activitySession converts a running activity to the user's session
+func activitySession(userID int64, activity models.StravaActivity) models.Session {
+	activityID := activity.ID
+	return models.Session{
+		UserID:           userID,
 		Date:             activity.StartDate,
 		Distance:         activity.Distance / 1000, // Convert meters to km
 		Duration:         activity.MovingTime,
@@ -112,15 +133,32 @@ func (s *StravaService) ProcessActivityCreated(activityID, ownerID int64) error
 		StravaActivityID: &activityID,
 		Source:           "strava",
 	}
+}
+
+// importActivity creates a session from a running activity and matches it to the day's
+// planned workout. Returns nil, nil if the activity was already imported.
+func (s *StravaService) importActivity(userID int64, activity models.StravaActivity) (*models.Session, error) {
+	activityID := activity.ID
 
 	// Create session
-	createdSession, err := s.db.CreateStravaSession(session)
+	createdSession, err := s.db.CreateStravaSession(activitySession(userID, activity))
 	if err != nil {
-		return fmt.Errorf("failed to create session: %w", err)
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	if createdSession == nil {
+		log.Printf("Session already exists for activity %d", activityID)
+		return nil, nil
 	}
 
 	log.Printf("Created session %d from Strava activity %d", createdSession.ID, activityID)
-	return nil
+
+	if workout, err := s.db.MatchSession(createdSession); err != nil {
+		log.Printf("Failed to match session %d to a planned workout: %v", createdSession.ID, err)
+	} else if workout != nil {
+		log.Printf("Matched session %d to planned workout %d (compliance %.0f%%)", createdSession.ID, workout.ID, workout.Match.Compliance)
+	}
+
+	return createdSession, nil
 }
 
 // ProcessActivityUpdated handles activity updates
@@ -152,17 +190,17 @@ func (s *StravaService) ProcessActivityUpdated(activityID, ownerID int64, update
 	// Check if activity type changed to non-running
 	if activity.Type != "Run" {
 		log.Printf("Activity type changed to non-running, deleting session: type=%s", activity.Type)
-		return s.ProcessActivityDeleted(activityID)
+		return s.ProcessActivityDeleted(activityID, ownerID)
 	}
 
 	// Handle privacy changes (activity becomes private for apps without activity:read_all)
 	if private, ok := updates["private"].(string); ok && private == "true" {
 		log.Printf("Activity became private, treating as delete")
-		return s.ProcessActivityDeleted(activityID)
+		return s.ProcessActivityDeleted(activityID, ownerID)
 	}
 
 	// Get existing session
-	session, err := s.db.GetSessionByStravaActivityID(activityID)
+	session, err := s.db.GetSessionByStravaActivityID(conn.UserID, activityID)
 	if err != nil {
 		return fmt.Errorf("failed to get session: %w", err)
 	}
@@ -180,7 +218,7 @@ func (s *StravaService) ProcessActivityUpdated(activityID, ownerID int64, update
 		Notes:    activity.Name,
 	}
 
-	_, err = s.db.UpdateStravaSession(activityID, updatedSession)
+	_, err = s.db.UpdateStravaSession(conn.UserID, activityID, updatedSession)
 	if err != nil {
 		return fmt.Errorf("failed to update session: %w", err)
 	}
@@ -190,10 +228,20 @@ func (s *StravaService) ProcessActivityUpdated(activityID, ownerID int64, update
 }
 
 // ProcessActivityDeleted handles activity deletion
-func (s *StravaService) ProcessActivityDeleted(activityID int64) error {
-	log.Printf("Processing activity deleted: activityID=%d", activityID)
+func (s *StravaService) ProcessActivityDeleted(activityID, ownerID int64) error {
+	log.Printf("Processing activity deleted: activityID=%d, ownerID=%d", activityID, ownerID)
+
+	// Get athlete's connection to find the owning user
+	conn, err := s.db.GetStravaConnectionByAthleteID(ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	if conn == nil {
+		log.Printf("No connection found for athlete %d", ownerID)
+		return nil
+	}
 
-	err := s.db.DeleteSessionByStravaActivityID(activityID)
+	err = s.db.DeleteSessionByStravaActivityID(conn.UserID, activityID)
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
@@ -218,13 +266,8 @@ func (s *StravaService) ProcessAthleteDeauthorized(athleteID int64) error {
 // ensureValidToken checks if token is expired and refreshes if necessary
 // Returns the decrypted access token ready for use
 func (s *StravaService) ensureValidToken(conn *models.StravaConnection) (string, error) {
-	encryptionKey := os.Getenv("ENCRYPTION_KEY")
-	if encryptionKey == "" {
-		return "", fmt.Errorf("ENCRYPTION_KEY not set")
-	}
-
 	// Decrypt the access token
-	accessToken, err := crypto.Decrypt(conn.AccessToken, encryptionKey)
+	accessToken, err := s.keyring.Decrypt(conn.AccessToken)
 	if err != nil {
 		return "", fmt.Errorf("failed to decrypt access token: %w", err)
 	}
@@ -238,7 +281,7 @@ func (s *StravaService) ensureValidToken(conn *models.StravaConnection) (string,
 	log.Printf("Token expired or expiring soon, refreshing for athlete %d", conn.StravaAthleteID)
 
 	// Decrypt refresh token for API call
-	refreshToken, err := crypto.Decrypt(conn.RefreshToken, encryptionKey)
+	refreshToken, err := s.keyring.Decrypt(conn.RefreshToken)
 	if err != nil {
 		return "", fmt.Errorf("failed to decrypt refresh token: %w", err)
 	}
@@ -250,12 +293,12 @@ func (s *StravaService) ensureValidToken(conn *models.StravaConnection) (string,
 	}
 
 	// Encrypt new tokens before storing
-	encryptedAccessToken, err := crypto.Encrypt(tokenResp.AccessToken, encryptionKey)
+	encryptedAccessToken, err := s.keyring.Encrypt(tokenResp.AccessToken)
 	if err != nil {
 		return "", fmt.Errorf("failed to encrypt new access token: %w", err)
 	}
 
-	encryptedRefreshToken, err := crypto.Encrypt(tokenResp.RefreshToken, encryptionKey)
+	encryptedRefreshToken, err := s.keyring.Encrypt(tokenResp.RefreshToken)
 	if err != nil {
 		return "", fmt.Errorf("failed to encrypt new refresh token: %w", err)
 	}
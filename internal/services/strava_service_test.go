@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/crypto"
+	"github.com/thc/runna-backend/internal/database"
+	"github.com/thc/runna-backend/internal/models"
+	"github.com/thc/runna-backend/internal/stravatest"
+)
+
+const testEncryptionKey = "0123456789abcdef0123456789abcdef"
+
+// newTestStrava starts a fake Strava and returns it with a service using it and a fresh
+// database
+func newTestStrava(t *testing.T) (*stravatest.Server, *StravaService, *database.DB) {
+	t.Helper()
+
+	t.Setenv("STRAVA_CLIENT_ID", "client")
+	t.Setenv("STRAVA_CLIENT_SECRET", "secret")
+
+	strava := stravatest.NewServer("client", "secret")
+	t.Cleanup(strava.Close)
+
+	db, err := database.New("file:" + filepath.Join(t.TempDir(), "runna.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Init(); err != nil {
+		t.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	keyring, err := crypto.NewKeyring(crypto.DefaultKeyID, testEncryptionKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strava, NewStravaService(db, NewStravaClient(strava.APIBase(), strava.TokenURL()), keyring), db
+}
+
+// connectAthlete stores a new user's connection to the athlete the way ConnectStrava does
+func connectAthlete(t *testing.T, strava *stravatest.Server, service *StravaService, db *database.DB, athleteID int64) int64 {
+	t.Helper()
+
+	user, err := db.CreateUser("runner@example.com", "Runner", "hash")
+	if err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	tokens, err := service.ExchangeToken(strava.Authorize(athleteID))
+	if err != nil {
+		t.Fatalf("Failed to exchange token: %v", err)
+	}
+
+	accessToken, err := service.keyring.Encrypt(tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refreshToken, err := service.keyring.Encrypt(tokens.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.CreateStravaConnection(models.StravaConnection{
+		UserID:          user.ID,
+		StravaAthleteID: tokens.Athlete.ID,
+		AccessToken:     accessToken,
+		RefreshToken:    refreshToken,
+		TokenExpiresAt:  time.Unix(tokens.ExpiresAt, 0),
+	})
+	if err != nil {
+		t.Fatalf("Failed to store connection: %v", err)
+	}
+
+	return user.ID
+}
+
+func run(id int64, name string, start time.Time) models.StravaActivity {
+	return models.StravaActivity{ID: id, Name: name, Type: "Run", Distance: 10000, MovingTime: 3000, StartDate: start}
+}
+
+func TestStravaServiceActivityEvents(t *testing.T) {
+	strava, service, db := newTestStrava(t)
+	userID := connectAthlete(t, strava, service, db, 1001)
+	start := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+
+	activityEvent := func(aspect string, updates map[string]interface{}) models.WebhookEvent {
+		return models.WebhookEvent{ObjectType: "activity", AspectType: aspect, ObjectID: 1, OwnerID: 1001, Updates: updates}
+	}
+	session := func() *models.Session {
+		t.Helper()
+		s, err := db.GetSessionByStravaActivityID(userID, 1)
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		return s
+	}
+
+	strava.PutActivity(1001, run(1, "Morning Run", start))
+	for i := 0; i < 2; i++ {
+		if err := service.ProcessWebhookEvent(activityEvent("create", nil)); err != nil {
+			t.Fatalf("Create %d: %v", i+1, err)
+		}
+	}
+
+	s := session()
+	if s == nil {
+		t.Fatal("Expected a session for the activity")
+	}
+	if s.Distance != 10 || s.Duration != 3000 || s.Notes != "Morning Run" || s.Source != "strava" || !s.Date.Equal(start) {
+		t.Errorf("Unexpected session: %+v", s)
+	}
+
+	strava.PutActivity(1001, run(1, "Evening Run", start))
+	if err := service.ProcessWebhookEvent(activityEvent("update", map[string]interface{}{"title": "Evening Run"})); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if s := session(); s == nil || s.Notes != "Evening Run" {
+		t.Errorf("Expected the session to be renamed, got %+v", s)
+	}
+
+	ride := run(1, "Evening Run", start)
+	ride.Type = "Ride"
+	strava.PutActivity(1001, ride)
+	if err := service.ProcessWebhookEvent(activityEvent("update", map[string]interface{}{"type": "Ride"})); err != nil {
+		t.Fatalf("Update to ride: %v", err)
+	}
+	if s := session(); s != nil {
+		t.Errorf("Expected the session to be removed once the activity became a ride, got %+v", s)
+	}
+
+	strava.PutActivity(1001, run(1, "Evening Run", start))
+	if err := service.ProcessWebhookEvent(activityEvent("update", map[string]interface{}{"type": "Run"})); err != nil {
+		t.Fatalf("Update back to run: %v", err)
+	}
+	if session() == nil {
+		t.Error("Expected an update of an unknown run to create its session")
+	}
+
+	strava.DeleteActivity(1)
+	if err := service.ProcessWebhookEvent(activityEvent("delete", nil)); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if s := session(); s != nil {
+		t.Errorf("Expected the session to be deleted, got %+v", s)
+	}
+
+	deauthorize := models.WebhookEvent{ObjectType: "athlete", AspectType: "update", ObjectID: 1001, OwnerID: 1001, Updates: map[string]interface{}{"authorized": "false"}}
+	if err := service.ProcessWebhookEvent(deauthorize); err != nil {
+		t.Fatalf("Deauthorize: %v", err)
+	}
+	if conn, err := db.GetStravaConnection(userID); err != nil || conn != nil {
+		t.Errorf("Expected the connection to be removed, got %+v (%v)", conn, err)
+	}
+}
+
+func TestStravaServiceRefreshesExpiredTokens(t *testing.T) {
+	strava, service, db := newTestStrava(t)
+
+	strava.SetTokenLifetime(-time.Minute)
+	userID := connectAthlete(t, strava, service, db, 1001)
+	strava.SetTokenLifetime(6 * time.Hour)
+
+	before, err := db.GetStravaConnection(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strava.PutActivity(1001, run(1, "Morning Run", time.Now().Add(-time.Hour)))
+	event := models.WebhookEvent{ObjectType: "activity", AspectType: "create", ObjectID: 1, OwnerID: 1001}
+	if err := service.ProcessWebhookEvent(event); err != nil {
+		t.Fatalf("Expected the expired token to be refreshed, got %v", err)
+	}
+
+	after, err := db.GetStravaConnection(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !after.TokenExpiresAt.After(time.Now()) {
+		t.Errorf("Expected the new expiry to be stored, got %s", after.TokenExpiresAt)
+	}
+
+	oldToken, _ := service.keyring.Decrypt(before.AccessToken)
+	newToken, err := service.keyring.Decrypt(after.AccessToken)
+	if err != nil || newToken == oldToken {
+		t.Errorf("Expected a new encrypted access token, got %q (%v)", newToken, err)
+	}
+	if after.RefreshToken == before.RefreshToken {
+		t.Error("Expected the new refresh token to be stored")
+	}
+}
+
+// waitForSync waits for the user's running sync to end and returns its final state
+func waitForSync(t *testing.T, db *database.DB, userID int64) *models.StravaConnection {
+	t.Helper()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := db.GetStravaConnection(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.Sync.Status != models.StravaSyncRunning {
+			return conn
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("Sync did not finish")
+	return nil
+}
+
+func TestStravaServiceSync(t *testing.T) {
+	strava, service, db := newTestStrava(t)
+	userID := connectAthlete(t, strava, service, db, 1001)
+
+	// 250 activities a day apart, every fifth of them a ride, spanning more than a page
+	now := time.Now()
+	for i := 0; i < 250; i++ {
+		a := run(int64(i+1), "Run", now.AddDate(0, 0, -250+i))
+		if i%5 == 0 {
+			a.Type = "Ride"
+		}
+		strava.PutActivity(1001, a)
+	}
+	strava.PutActivity(2002, run(999, "Someone else's run", now.AddDate(0, 0, -1)))
+
+	if err := service.StartSync(context.Background(), userID); err != nil {
+		t.Fatalf("Failed to start sync: %v", err)
+	}
+
+	conn := waitForSync(t, db, userID)
+	if conn.Sync.Status != models.StravaSyncCompleted || conn.Sync.Error != "" {
+		t.Fatalf("Expected the sync to complete, got %+v", conn.Sync)
+	}
+	if conn.Sync.Fetched != 250 || conn.Sync.Imported != 200 {
+		t.Errorf("Expected 250 activities fetched and 200 imported, got %d and %d", conn.Sync.Fetched, conn.Sync.Imported)
+	}
+	if conn.LastSync == nil {
+		t.Error("Expected last_sync to be set")
+	}
+
+	for id, want := range map[int64]bool{1: false, 2: true, 250: true, 999: false} {
+		s, err := db.GetSessionByStravaActivityID(userID, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (s != nil) != want {
+			t.Errorf("Activity %d: expected a session %v, got %+v", id, want, s)
+		}
+	}
+
+	// The next sync only reads the last week again and imports nothing twice
+	requests := strava.Requests()
+	if err := service.StartSync(context.Background(), userID); err != nil {
+		t.Fatalf("Failed to start second sync: %v", err)
+	}
+
+	conn = waitForSync(t, db, userID)
+	if conn.Sync.Status != models.StravaSyncCompleted || conn.Sync.Fetched > 8 || conn.Sync.Imported != 0 {
+		t.Errorf("Expected the second sync to only fetch the last week, got %+v", conn.Sync)
+	}
+	if got := strava.Requests() - requests; got != 2 {
+		t.Errorf("Expected one page and the empty page after it, got %d requests", got)
+	}
+}
+
+func TestStravaServiceSyncCancelledWhilePaused(t *testing.T) {
+	strava, service, db := newTestStrava(t)
+	userID := connectAthlete(t, strava, service, db, 1001)
+
+	strava.PutActivity(1001, run(1, "Morning Run", time.Now().Add(-time.Hour)))
+	strava.SetRateLimit(0, 1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := service.StartSync(ctx, userID); err != nil {
+		t.Fatalf("Failed to start sync: %v", err)
+	}
+
+	// Wait for the sync to pause until the next rate limit window, then cancel it
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		conn, err := db.GetStravaConnection(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.Sync.ResumeAt != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Sync did not pause")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	conn := waitForSync(t, db, userID)
+	if conn.Sync.Status != models.StravaSyncFailed || conn.Sync.Error != context.Canceled.Error() {
+		t.Errorf("Expected the cancelled sync to fail, got %+v", conn.Sync)
+	}
+}
+
+func TestStravaServiceSyncWithoutConnection(t *testing.T) {
+	_, service, db := newTestStrava(t)
+
+	user, err := db.CreateUser("runner@example.com", "Runner", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.StartSync(context.Background(), user.ID); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Expected ErrNotConnected, got %v", err)
+	}
+}
+
+func TestStravaServiceRateLimits(t *testing.T) {
+	strava, service, db := newTestStrava(t)
+	connectAthlete(t, strava, service, db, 1001)
+
+	strava.PutActivity(1001, run(1, "Morning Run", time.Now().Add(-time.Hour)))
+	event := models.WebhookEvent{ObjectType: "activity", AspectType: "create", ObjectID: 1, OwnerID: 1001}
+
+	// Strava rejects the request, and the client reports when to try again
+	strava.SetRateLimit(0, 1000)
+	err := service.ProcessWebhookEvent(event)
+
+	var rateLimited *RateLimitError
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("Expected a rate limit error from a 429, got %v", err)
+	}
+	if want := nextRateLimitWindow(time.Now()); !rateLimited.RetryAt.Equal(want) {
+		t.Errorf("Expected retry at %s, got %s", want, rateLimited.RetryAt)
+	}
+
+	// Once the budget is known to be nearly spent the client stops calling Strava
+	strava.SetRateLimit(3, 1000)
+	if err := service.ProcessWebhookEvent(event); err != nil {
+		t.Fatalf("Expected the first request within the budget to succeed, got %v", err)
+	}
+
+	requests := strava.Requests()
+	if err := service.ProcessWebhookEvent(event); !errors.As(err, &rateLimited) {
+		t.Fatalf("Expected the client to hold back the request, got %v", err)
+	}
+	if strava.Requests() != requests {
+		t.Error("Expected no request to reach Strava past the budget")
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+const (
+	// syncPageSize is how many activities are requested per page, Strava's maximum
+	syncPageSize = 200
+	// syncOverlap re-reads activities that started shortly before the last sync, so runs
+	// uploaded late are still imported
+	syncOverlap = 7 * 24 * time.Hour
+	// syncStaleAfter is how long a sync may run, or stay paused past its resume time, before
+	// another is allowed to replace it
+	syncStaleAfter = time.Hour
+)
+
+// ErrNotConnected is returned when syncing a user without a Strava connection
+var ErrNotConnected = errors.New("no strava connection")
+
+// StartSync starts importing the user's Strava activities in the background. The first sync
+// reads the athlete's whole history, later ones only what started since the last sync.
+// The sync stops when ctx is cancelled, so ctx should outlive the request that started it.
+// Returns database.ErrSyncInProgress if a sync is already running.
+func (s *StravaService) StartSync(ctx context.Context, userID int64) error {
+	conn, err := s.db.GetStravaConnection(userID)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	if conn == nil {
+		return ErrNotConnected
+	}
+
+	startedAt := time.Now()
+	if err := s.db.StartStravaSync(userID, startedAt, startedAt.Add(-syncStaleAfter)); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotConnected
+		}
+		return err
+	}
+
+	go func() {
+		syncErr := s.syncActivities(ctx, conn)
+		if syncErr != nil {
+			log.Printf("Strava sync failed for user %d: %v", userID, syncErr)
+		}
+
+		if err := s.db.FinishStravaSync(userID, startedAt, syncErr); err != nil {
+			log.Printf("Failed to record end of Strava sync for user %d: %v", userID, err)
+		}
+	}()
+
+	return nil
+}
+
+// syncActivities pages through the athlete's activities and imports the runs, recording
+// progress after every page. When Strava's rate limits are reached the sync pauses until they
+// reset and continues with the same page. The data derived from the imported sessions is
+// refreshed once, by FinishStravaSync, rather than per activity.
+func (s *StravaService) syncActivities(ctx context.Context, conn *models.StravaConnection) error {
+	var after int64
+	if conn.LastSync != nil {
+		after = conn.LastSync.Add(-syncOverlap).Unix()
+	}
+
+	accessToken, err := s.ensureValidToken(conn)
+	if err != nil {
+		return fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	fetched, imported := 0, 0
+	for page := 1; ; {
+		activities, err := s.client.ListActivities(accessToken, after, page, syncPageSize)
+
+		var rateLimited *RateLimitError
+		if errors.As(err, &rateLimited) {
+			accessToken, err = s.waitForRateLimit(ctx, conn.UserID, rateLimited.RetryAt)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch page %d: %w", page, err)
+		}
+
+		if len(activities) == 0 {
+			log.Printf("Strava sync for user %d done: %d activities fetched, %d imported", conn.UserID, fetched, imported)
+			return nil
+		}
+
+		var runs []models.Session
+		for _, activity := range activities {
+			fetched++
+
+			if activity.Type == "Run" {
+				runs = append(runs, activitySession(conn.UserID, activity))
+			}
+		}
+
+		created, err := s.db.ImportStravaSessions(conn.UserID, runs)
+		if err != nil {
+			return fmt.Errorf("failed to import page %d: %w", page, err)
+		}
+		imported += len(created)
+
+		if err := s.db.UpdateStravaSyncProgress(conn.UserID, fetched, imported); err != nil {
+			return fmt.Errorf("failed to record progress: %w", err)
+		}
+		page++
+	}
+}
+
+// waitForRateLimit pauses the user's sync until resumeAt and returns a fresh access token,
+// since the old one may have expired in the meantime. Returns ctx's error if it is cancelled
+// first.
+func (s *StravaService) waitForRateLimit(ctx context.Context, userID int64, resumeAt time.Time) (string, error) {
+	log.Printf("Strava rate limit reached, pausing sync for user %d until %s", userID, resumeAt.Format(time.RFC3339))
+
+	if err := s.db.PauseStravaSync(userID, resumeAt); err != nil {
+		return "", fmt.Errorf("failed to record pause: %w", err)
+	}
+
+	timer := time.NewTimer(time.Until(resumeAt))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	conn, err := s.db.GetStravaConnection(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get connection: %w", err)
+	}
+	if conn == nil {
+		return "", ErrNotConnected
+	}
+
+	accessToken, err := s.ensureValidToken(conn)
+	if err != nil {
+		return "", fmt.Errorf("failed to refresh token: %w", err)
+	}
+
+	return accessToken, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/thc/runna-backend/internal/database"
+)
+
+// TrashPurger periodically removes sessions that have been in the trash longer than the retention window
+type TrashPurger struct {
+	db        *database.DB
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewTrashPurger(db *database.DB, retention, interval time.Duration) *TrashPurger {
+	return &TrashPurger{
+		db:        db,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// Run purges once immediately and then on every interval until ctx is cancelled
+func (p *TrashPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *TrashPurger) purge() {
+	purged, err := p.db.PurgeDeletedSessions(time.Now().Add(-p.retention))
+	if err != nil {
+		log.Printf("[ERROR] TrashPurger: Failed to purge deleted sessions: %v", err)
+		return
+	}
+
+	if purged > 0 {
+		log.Printf("[INFO] TrashPurger: Purged %d sessions deleted more than %s ago", purged, p.retention)
+	}
+}
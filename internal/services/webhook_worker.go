@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/thc/runna-backend/internal/database"
+	"github.com/thc/runna-backend/internal/models"
+)
+
+const (
+	// webhookMaxAttempts is how often an event is tried before it is dead-lettered
+	webhookMaxAttempts = 8
+	// webhookBaseDelay is the wait before the first retry; it doubles with every further attempt
+	webhookBaseDelay = 30 * time.Second
+	// webhookMaxDelay caps the wait between attempts
+	webhookMaxDelay = time.Hour
+	// webhookStaleAfter is how long an event may stay claimed before another worker retries it
+	webhookStaleAfter = 10 * time.Minute
+)
+
+// webhookProcessor is what the worker hands events to; implemented by StravaService
+type webhookProcessor interface {
+	ProcessWebhookEvent(event models.WebhookEvent) error
+}
+
+// WebhookWorker works off the stored webhook event queue with a pool of workers, retrying
+// failed events with exponential backoff and dead-lettering them after webhookMaxAttempts.
+// Events that hit Strava's rate limits are deferred until the limit resets.
+type WebhookWorker struct {
+	db        *database.DB
+	processor webhookProcessor
+	workers   int
+	interval  time.Duration
+	wake      chan struct{}
+}
+
+func NewWebhookWorker(db *database.DB, processor webhookProcessor, workers int, interval time.Duration) *WebhookWorker {
+	return &WebhookWorker{
+		db:        db,
+		processor: processor,
+		workers:   workers,
+		interval:  interval,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes an idle worker so a newly stored event is processed without waiting for the
+// next poll
+func (q *WebhookWorker) Notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run starts the workers and blocks until ctx is cancelled and they have stopped. Each
+// worker processes due events until none are left, then waits for a Notify or the interval.
+func (q *WebhookWorker) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < q.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *WebhookWorker) work(ctx context.Context) {
+	ticker := time.NewTicker(q.interval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil && q.processNext() {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNext claims and processes one due event. Returns false if there was none, or the
+// queue couldn't be read.
+func (q *WebhookWorker) processNext() bool {
+	now := time.Now()
+	event, err := q.db.ClaimWebhookEvent(now, now.Add(-webhookStaleAfter))
+	if err != nil {
+		log.Printf("[ERROR] WebhookWorker: Failed to claim event: %v", err)
+		return false
+	}
+	if event == nil {
+		return false
+	}
+
+	processErr := q.processor.ProcessWebhookEvent(event.Event)
+
+	var rateLimited *RateLimitError
+	now = time.Now()
+	switch {
+	case processErr == nil:
+		err = q.db.CompleteWebhookEvent(event.ID, now)
+	case errors.As(processErr, &rateLimited):
+		// Nothing went wrong with the event itself, so the attempt doesn't count
+		log.Printf("[WARN] WebhookWorker: Strava rate limit reached, deferring event id=%d until %s", event.ID, rateLimited.RetryAt.Format(time.RFC3339))
+		err = q.db.DeferWebhookEvent(event.ID, rateLimited.RetryAt)
+	case event.Attempts >= webhookMaxAttempts:
+		log.Printf("[ERROR] WebhookWorker: Dead-lettering event id=%d after %d attempts: %v", event.ID, event.Attempts, processErr)
+		err = q.db.DeadLetterWebhookEvent(event.ID, processErr, now)
+	default:
+		delay := webhookBackoff(event.Attempts)
+		log.Printf("[WARN] WebhookWorker: Attempt %d of event id=%d failed, retrying in %s: %v", event.Attempts, event.ID, delay, processErr)
+		err = q.db.RetryWebhookEvent(event.ID, processErr, now.Add(delay))
+	}
+	if err != nil {
+		log.Printf("[ERROR] WebhookWorker: Failed to record outcome of event id=%d: %v", event.ID, err)
+	}
+
+	return true
+}
+
+// webhookBackoff returns the wait after the given failed attempt: webhookBaseDelay after
+// the first, doubling after each further one up to webhookMaxDelay
+func webhookBackoff(attempt int) time.Duration {
+	delay := webhookBaseDelay
+	for i := 1; i < attempt && delay < webhookMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookMaxDelay)
+}
@@ -0,0 +1,324 @@
+// Package sessioncsv converts between training-log spreadsheets and sessions.
+package sessioncsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// Distance units accepted in Mapping.DistanceUnit
+const (
+	UnitKilometers = "km"
+	UnitMiles      = "mi"
+	UnitMeters     = "m"
+)
+
+const kmPerMile = 1.609344
+
+// defaultDateFormats are tried in order when Mapping.DateFormat is empty
+var defaultDateFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Mapping names the CSV header of each session field and how to interpret the values
+type Mapping struct {
+	Date         string
+	Distance     string
+	Duration     string
+	Notes        string // optional
+	DistanceUnit string // km, mi or m
+	DateFormat   string // Go time layout; empty tries common formats
+}
+
+// DefaultMapping matches the columns written by Write
+func DefaultMapping() Mapping {
+	return Mapping{
+		Date:         "date",
+		Distance:     "distance",
+		Duration:     "duration",
+		Notes:        "notes",
+		DistanceUnit: UnitKilometers,
+	}
+}
+
+// Row is one parsed data row; Request is only meaningful when Errors is empty
+type Row struct {
+	Line    int
+	Request models.CreateSessionRequest
+	Errors  []string
+}
+
+// Parse reads a CSV with a header row and converts each data row using the mapping.
+// Row-level problems are reported on the row; only structural problems return an error.
+func Parse(r io.Reader, m Mapping) ([]Row, error) {
+	if m.DistanceUnit == "" {
+		m.DistanceUnit = UnitKilometers
+	}
+	if m.DistanceUnit != UnitKilometers && m.DistanceUnit != UnitMiles && m.DistanceUnit != UnitMeters {
+		return nil, fmt.Errorf("unsupported distance unit %q, use km, mi or m", m.DistanceUnit)
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+
+	index := func(name string, required bool) (int, error) {
+		if name == "" {
+			if required {
+				return -1, errors.New("column mapping is incomplete")
+			}
+			return -1, nil
+		}
+		i, ok := columns[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			if required {
+				return -1, fmt.Errorf("column %q not found in header", name)
+			}
+			return -1, nil
+		}
+		return i, nil
+	}
+
+	dateCol, err := index(m.Date, true)
+	if err != nil {
+		return nil, err
+	}
+	distanceCol, err := index(m.Distance, true)
+	if err != nil {
+		return nil, err
+	}
+	durationCol, err := index(m.Duration, true)
+	if err != nil {
+		return nil, err
+	}
+	notesCol, err := index(m.Notes, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, Row{Line: parseErr.Line, Errors: []string{parseErr.Err.Error()}})
+				continue
+			}
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		if isBlank(record) {
+			continue
+		}
+
+		// Only a row that was read has field positions
+		line, _ := reader.FieldPos(0)
+		row := Row{Line: line}
+		field := func(col int) string {
+			if col < 0 || col >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[col])
+		}
+
+		if date, err := parseDate(field(dateCol), m.DateFormat); err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("date: %v", err))
+		} else {
+			row.Request.Date = date
+		}
+
+		if distance, err := parseDistance(field(distanceCol), m.DistanceUnit); err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("distance: %v", err))
+		} else {
+			row.Request.Distance = distance
+		}
+
+		if duration, err := ParseDuration(field(durationCol)); err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("duration: %v", err))
+		} else {
+			row.Request.Duration = duration
+		}
+
+		row.Request.Notes = field(notesCol)
+
+		// Apply the same rules as the create endpoint once the values parsed
+		if len(row.Errors) == 0 {
+			if err := row.Request.Validate(); err != nil {
+				row.Errors = append(row.Errors, err.Error())
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+// Write exports sessions with a header row that Parse reads back using DefaultMapping
+func Write(w io.Writer, sessions []models.Session) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"id", "date", "distance", "duration", "pace", "notes", "source", "elevation_gain", "avg_heart_rate", "max_heart_rate"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		record := []string{
+			strconv.FormatInt(s.ID, 10),
+			s.Date.Format(time.RFC3339),
+			strconv.FormatFloat(s.Distance, 'f', -1, 64),
+			strconv.Itoa(s.Duration),
+			formatPace(s.Distance, s.Duration),
+			s.Notes,
+			s.Source,
+			formatOptionalFloat(s.ElevationGain),
+			formatOptionalInt(s.AvgHeartRate),
+			formatOptionalInt(s.MaxHeartRate),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// ParseDuration accepts seconds ("1800"), "mm:ss" or "hh:mm:ss"
+func ParseDuration(value string) (int, error) {
+	if value == "" {
+		return 0, errors.New("value is required")
+	}
+
+	if !strings.Contains(value, ":") {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		return int(math.Round(seconds)), nil
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	total := 0
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		total = total*60 + n
+	}
+
+	return total, nil
+}
+
+func parseDate(value, layout string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("value is required")
+	}
+
+	if layout != "" {
+		t, err := time.Parse(layout, value)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%q does not match format %q", value, layout)
+		}
+		return t, nil
+	}
+
+	for _, format := range defaultDateFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date %q", value)
+}
+
+func parseDistance(value, unit string) (float64, error) {
+	if value == "" {
+		return 0, errors.New("value is required")
+	}
+
+	distance, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+
+	switch unit {
+	case UnitMiles:
+		distance *= kmPerMile
+	case UnitMeters:
+		distance /= 1000
+	}
+
+	return distance, nil
+}
+
+// formatPace renders min/km as m:ss, or empty when undefined
+func formatPace(distance float64, duration int) string {
+	if distance <= 0 || duration <= 0 {
+		return ""
+	}
+	secondsPerKm := int(math.Round(float64(duration) / distance))
+	return fmt.Sprintf("%d:%02d", secondsPerKm/60, secondsPerKm%60)
+}
+
+func formatOptionalFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func isBlank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package sessioncsv
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+func TestParseCustomMapping(t *testing.T) {
+	input := "Day,Miles,Time,Comment\n" +
+		"2024-01-15,3.1,25:30,Easy run\n" +
+		"2024-01-16,0,30:00,Zero distance\n" +
+		"not-a-date,5,1:02:03,\n" +
+		",,,\n"
+
+	rows, err := Parse(strings.NewReader(input), Mapping{
+		Date:         "day",
+		Distance:     "Miles",
+		Duration:     "Time",
+		Notes:        "Comment",
+		DistanceUnit: UnitMiles,
+	})
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows (blank row skipped), got %d", len(rows))
+	}
+
+	first := rows[0]
+	if len(first.Errors) != 0 {
+		t.Fatalf("Expected first row to be valid, got %v", first.Errors)
+	}
+	if math.Abs(first.Request.Distance-4.989) > 0.001 {
+		t.Fatalf("Expected ~4.989km, got %f", first.Request.Distance)
+	}
+	if first.Request.Duration != 1530 {
+		t.Fatalf("Expected 1530s, got %d", first.Request.Duration)
+	}
+	if first.Request.Notes != "Easy run" || first.Line != 2 {
+		t.Fatalf("Unexpected notes or line: %q line=%d", first.Request.Notes, first.Line)
+	}
+
+	if len(rows[1].Errors) != 1 || rows[1].Errors[0] != "Distance must be greater than 0" {
+		t.Fatalf("Expected create validation error, got %v", rows[1].Errors)
+	}
+
+	if len(rows[2].Errors) != 1 || !strings.HasPrefix(rows[2].Errors[0], "date:") {
+		t.Fatalf("Expected date error, got %v", rows[2].Errors)
+	}
+}
+
+func TestParseMissingColumn(t *testing.T) {
+	_, err := Parse(strings.NewReader("date,distance\n2024-01-01,5\n"), DefaultMapping())
+	if err == nil {
+		t.Fatal("Expected error for missing duration column, got nil")
+	}
+}
+
+func TestParseMalformedFirstField(t *testing.T) {
+	input := "date,distance,duration\n" +
+		"20\"24-01-02,5,1800\n" +
+		"2024-01-03,5,1800\n"
+
+	rows, err := Parse(strings.NewReader(input), DefaultMapping())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(rows))
+	}
+	if rows[0].Line != 2 || len(rows[0].Errors) != 1 || !strings.Contains(rows[0].Errors[0], "quote") {
+		t.Fatalf("Expected a quote error on line 2, got line=%d %v", rows[0].Line, rows[0].Errors)
+	}
+	if rows[1].Line != 3 || len(rows[1].Errors) != 0 {
+		t.Fatalf("Expected a valid row on line 3, got line=%d %v", rows[1].Line, rows[1].Errors)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	hr := 150
+	sessions := []models.Session{{
+		ID:           7,
+		Date:         time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC),
+		Distance:     5.5,
+		Duration:     1800,
+		Notes:        "Morning, windy",
+		Source:       "manual",
+		AvgHeartRate: &hr,
+	}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, sessions); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	rows, err := Parse(&buf, DefaultMapping())
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if len(rows) != 1 || len(rows[0].Errors) != 0 {
+		t.Fatalf("Expected one valid row, got %+v", rows)
+	}
+
+	got := rows[0].Request
+	if !got.Date.Equal(sessions[0].Date) || got.Distance != 5.5 || got.Duration != 1800 || got.Notes != "Morning, windy" {
+		t.Fatalf("Round trip mismatch: %+v", got)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := map[string]int{
+		"1800":    1800,
+		"30:00":   1800,
+		"1:00:00": 3600,
+		"90.4":    90,
+	}
+
+	for input, expected := range cases {
+		got, err := ParseDuration(input)
+		if err != nil {
+			t.Fatalf("ParseDuration(%q) failed: %v", input, err)
+		}
+		if got != expected {
+			t.Fatalf("ParseDuration(%q) = %d, expected %d", input, got, expected)
+		}
+	}
+
+	if _, err := ParseDuration("1:2:3:4"); err == nil {
+		t.Fatal("Expected error for too many parts, got nil")
+	}
+}
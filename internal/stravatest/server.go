@@ -0,0 +1,304 @@
+// Package stravatest provides a fake Strava server for tests: the OAuth token endpoint, the
+// activity endpoints of the API with rate limit headers, and webhook event delivery.
+package stravatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thc/runna-backend/internal/models"
+)
+
+// SubscriptionID is the webhook subscription ID of every pushed event
+const SubscriptionID = 1
+
+// Server is a fake Strava serving the OAuth token endpoint under /oauth and the API under
+// /api/v3. Athletes authorize through Authorize and own the activities added to them.
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	mu            sync.Mutex
+	tokenLifetime time.Duration
+	activities    map[int64]activity
+	codes         map[string]int64 // authorization code to athlete ID
+	accessTokens  map[string]accessToken
+	refreshTokens map[string]int64 // refresh token to athlete ID
+	issued        int
+	shortLimit    int
+	dailyLimit    int
+	usage         int
+	requests      int
+}
+
+type activity struct {
+	athleteID int64
+	models.StravaActivity
+}
+
+type accessToken struct {
+	athleteID int64
+	expiresAt time.Time
+}
+
+// NewServer starts a fake Strava accepting the given client credentials. Tokens are valid
+// for six hours and the rate limits are Strava's defaults of 200 requests per 15 minutes
+// and 2000 a day. Close it when done.
+func NewServer(clientID, clientSecret string) *Server {
+	s := &Server{
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		tokenLifetime: 6 * time.Hour,
+		activities:    make(map[int64]activity),
+		codes:         make(map[string]int64),
+		accessTokens:  make(map[string]accessToken),
+		refreshTokens: make(map[string]int64),
+		shortLimit:    200,
+		dailyLimit:    2000,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /oauth/token", s.token)
+	mux.HandleFunc("GET /api/v3/activities/{id}", s.api(s.getActivity))
+	mux.HandleFunc("GET /api/v3/athlete/activities", s.api(s.listActivities))
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// APIBase is the base URL of the fake API, for services.NewStravaClient
+func (s *Server) APIBase() string {
+	return s.URL + "/api/v3"
+}
+
+// TokenURL is the URL of the fake token endpoint, for services.NewStravaClient
+func (s *Server) TokenURL() string {
+	return s.URL + "/oauth/token"
+}
+
+// Authorize returns an authorization code of the athlete, as Strava passes to the app's
+// redirect URL. Each code can be exchanged once.
+func (s *Server) Authorize(athleteID int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.issued++
+	code := fmt.Sprintf("code-%d-%d", athleteID, s.issued)
+	s.codes[code] = athleteID
+	return code
+}
+
+// SetTokenLifetime changes how long tokens issued from now on are valid. A negative lifetime
+// issues tokens that have already expired, so clients have to refresh them before use.
+func (s *Server) SetTokenLifetime(lifetime time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokenLifetime = lifetime
+}
+
+// PutActivity adds the activity to the athlete's, or replaces it
+func (s *Server) PutActivity(athleteID int64, a models.StravaActivity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.activities[a.ID] = activity{athleteID: athleteID, StravaActivity: a}
+}
+
+// DeleteActivity removes an activity
+func (s *Server) DeleteActivity(activityID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.activities, activityID)
+}
+
+// SetRateLimit sets the 15-minute and daily request budgets and resets their usage. API
+// requests past either are rejected with 429.
+func (s *Server) SetRateLimit(short, daily int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shortLimit, s.dailyLimit = short, daily
+	s.usage = 0
+}
+
+// Requests returns how many API requests reached the server, including rejected ones
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// PushWebhook delivers an event to a webhook callback URL as Strava does, filling in the
+// event time and subscription
+func (s *Server) PushWebhook(callbackURL string, event models.WebhookEvent) (*http.Response, error) {
+	if event.EventTime == 0 {
+		event.EventTime = time.Now().Unix()
+	}
+	event.SubscriptionID = SubscriptionID
+	if event.Updates == nil {
+		event.Updates = map[string]interface{}{}
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	return http.Post(callbackURL, "application/json", bytes.NewReader(body))
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	if r.PostForm.Get("client_id") != s.ClientID || r.PostForm.Get("client_secret") != s.ClientSecret {
+		writeFault(w, http.StatusUnauthorized, "Authorization Error")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var athleteID int64
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		code := r.PostForm.Get("code")
+		id, ok := s.codes[code]
+		if !ok {
+			writeFault(w, http.StatusBadRequest, "Bad Request")
+			return
+		}
+		delete(s.codes, code)
+		athleteID = id
+	case "refresh_token":
+		refreshToken := r.PostForm.Get("refresh_token")
+		id, ok := s.refreshTokens[refreshToken]
+		if !ok {
+			writeFault(w, http.StatusBadRequest, "Bad Request")
+			return
+		}
+		delete(s.refreshTokens, refreshToken)
+		athleteID = id
+	default:
+		writeFault(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+
+	s.issued++
+	expiresAt := time.Now().Add(s.tokenLifetime)
+	resp := models.StravaTokenResponse{
+		AccessToken:  fmt.Sprintf("access-%d-%d", athleteID, s.issued),
+		RefreshToken: fmt.Sprintf("refresh-%d-%d", athleteID, s.issued),
+		ExpiresAt:    expiresAt.Unix(),
+	}
+	resp.Athlete.ID = athleteID
+
+	s.accessTokens[resp.AccessToken] = accessToken{athleteID: athleteID, expiresAt: expiresAt}
+	s.refreshTokens[resp.RefreshToken] = athleteID
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// api wraps an API handler with rate limiting and authentication, passing it the athlete
+// the bearer token belongs to. The server's lock is held while the handler runs.
+func (s *Server) api(next func(w http.ResponseWriter, r *http.Request, athleteID int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.requests++
+		s.usage++
+		w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d,%d", s.shortLimit, s.dailyLimit))
+		w.Header().Set("X-RateLimit-Usage", fmt.Sprintf("%d,%d", s.usage, s.usage))
+		if s.usage > s.shortLimit || s.usage > s.dailyLimit {
+			writeFault(w, http.StatusTooManyRequests, "Rate Limit Exceeded")
+			return
+		}
+
+		bearer, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		token, ok := s.accessTokens[bearer]
+		if !ok || time.Now().After(token.expiresAt) {
+			writeFault(w, http.StatusUnauthorized, "Authorization Error")
+			return
+		}
+
+		next(w, r, token.athleteID)
+	}
+}
+
+func (s *Server) getActivity(w http.ResponseWriter, r *http.Request, athleteID int64) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeFault(w, http.StatusNotFound, "Record Not Found")
+		return
+	}
+
+	a, ok := s.activities[id]
+	if !ok || a.athleteID != athleteID {
+		writeFault(w, http.StatusNotFound, "Record Not Found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.StravaActivity)
+}
+
+// listActivities pages through the athlete's activities that started after the "after"
+// parameter, oldest first, as Strava does when given one
+func (s *Server) listActivities(w http.ResponseWriter, r *http.Request, athleteID int64) {
+	query := r.URL.Query()
+	after, _ := strconv.ParseInt(query.Get("after"), 10, 64)
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = 30
+	}
+
+	activities := []models.StravaActivity{}
+	for _, a := range s.activities {
+		if a.athleteID == athleteID && a.StartDate.Unix() > after {
+			activities = append(activities, a.StravaActivity)
+		}
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		if !activities[i].StartDate.Equal(activities[j].StartDate) {
+			return activities[i].StartDate.Before(activities[j].StartDate)
+		}
+		return activities[i].ID < activities[j].ID
+	})
+
+	start := min((page-1)*perPage, len(activities))
+	end := min(start+perPage, len(activities))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(activities[start:end])
+}
+
+// writeFault writes an error in Strava's fault format
+func writeFault(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": message,
+		"errors":  []interface{}{},
+	})
+}